@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"ssh_manager/internal/auth"
+	"ssh_manager/internal/utils"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// newWebAuthn configures the passkey relying party from WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS.
+// Without WEBAUTHN_RP_ID the handlers use the host of each request.
+func newWebAuthn() (*webauthn.WebAuthn, error) {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		return nil, nil
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: utils.GetEnv("WEBAUTHN_RP_NAME", "SSH Manager"),
+		RPOrigins:     splitList(utils.GetEnv("WEBAUTHN_ORIGINS", "https://"+rpID), ","),
+	})
+}
+
+// newOIDCProvider configures single sign-on from the OIDC_* variables, it is off without OIDC_ISSUER.
+func newOIDCProvider() (*auth.OIDCProvider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	mapping, err := parseRoleMapping("OIDC_ROLE_MAPPING")
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:        issuer,
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:        splitList(utils.GetEnv("OIDC_SCOPES", "profile email"), " "),
+		UsernameClaim: utils.GetEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		GroupsClaim:   utils.GetEnv("OIDC_GROUPS_CLAIM", "groups"),
+		RoleMapping:   mapping,
+		DefaultRole:   os.Getenv("OIDC_DEFAULT_ROLE"),
+		AutoProvision: utils.GetBoolEnv("OIDC_AUTO_PROVISION", true),
+	})
+}
+
+// newLDAPProvider configures the LDAP login from the LDAP_* variables, it is off without LDAP_URL.
+func newLDAPProvider() (*auth.LDAP, error) {
+	url := os.Getenv("LDAP_URL")
+	if url == "" {
+		return nil, nil
+	}
+
+	mapping, err := parseRoleMapping("LDAP_ROLE_MAPPING")
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: utils.GetBoolEnv("LDAP_INSECURE_SKIP_VERIFY", false)}
+	if caFile := os.Getenv("LDAP_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+	}
+
+	return auth.NewLDAP(auth.LDAPConfig{
+		URL:               url,
+		StartTLS:          utils.GetBoolEnv("LDAP_START_TLS", false),
+		TLSConfig:         tlsConfig,
+		UserDN:            os.Getenv("LDAP_USER_DN"),
+		BindDN:            os.Getenv("LDAP_BIND_DN"),
+		BindPassword:      os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:            os.Getenv("LDAP_BASE_DN"),
+		UserFilter:        utils.GetEnv("LDAP_USER_FILTER", "(uid={username})"),
+		UsernameAttribute: utils.GetEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+		GroupAttribute:    utils.GetEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		GroupBaseDN:       os.Getenv("LDAP_GROUP_BASE_DN"),
+		GroupFilter:       utils.GetEnv("LDAP_GROUP_FILTER", "(|(member={dn})(uniqueMember={dn})(memberUid={username}))"),
+		AllowedGroups:     splitList(os.Getenv("LDAP_ALLOWED_GROUPS"), ","),
+		RoleMapping:       mapping,
+		DefaultRole:       os.Getenv("LDAP_DEFAULT_ROLE"),
+		Provision:         utils.GetBoolEnv("LDAP_AUTO_PROVISION", true),
+		Timeout:           utils.GetDurationEnv("LDAP_TIMEOUT", "10s"),
+	})
+}
+
+// pruneLoginFailures deletes old failed logins at startup and then every hour.
+func pruneLoginFailures(throttle *auth.Throttle) {
+	for {
+		if err := throttle.Prune(context.Background()); err != nil {
+			log.Printf("[ERROR] Failed to prune the failed logins: %v", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// parseRoleMapping reads group=role pairs, e.g. "ssh-admins=admin,developers=operator".
+func parseRoleMapping(key string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, pair := range splitList(os.Getenv(key), ",") {
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s entry %q, expected group=role", key, pair)
+		}
+		mapping[strings.TrimSpace(group)] = strings.TrimSpace(role)
+	}
+	return mapping, nil
+}
+
+// splitList splits a list from an environment variable, blank entries are skipped.
+func splitList(value, sep string) []string {
+	var items []string
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"ssh_manager/internal/encryption"
+	"ssh_manager/internal/repository"
+	"ssh_manager/internal/sshkeys"
+	"ssh_manager/internal/utils"
+	"text/tabwriter"
+)
+
+// usage help for the maintenance subcommands.
+const usage = `Usage: ssh-manager [command]
+
+Without a command the web server is started.
+
+Commands:
+  migrate          apply pending database migrations
+  migrate status   show applied and pending migrations
+  reencrypt        re-encrypt stored keys and passwords with the newest key of ENCRYPTION_KEYS`
+
+// runCommand runs a maintenance subcommand of the server binary.
+func runCommand(db *sql.DB, dbType string, args []string) error {
+	switch {
+	case args[0] == "migrate" && len(args) == 1:
+		return repository.Migrate(context.Background(), db, dbType)
+	case args[0] == "migrate" && len(args) == 2 && args[1] == "status":
+		return migrateStatus(db, dbType)
+	case args[0] == "reencrypt" && len(args) == 1:
+		return reencrypt(db)
+	case args[0] == "help" || args[0] == "-h" || args[0] == "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return errors.New("unknown command")
+	}
+}
+
+// migrateStatus prints every migration with the time it was applied.
+func migrateStatus(db *sql.DB, dbType string) error {
+	states, err := repository.MigrationStatus(context.Background(), db, dbType)
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+	for _, s := range states {
+		status := "pending"
+		switch {
+		case !s.Known:
+			status = "applied " + s.AppliedAt.Local().Format("2006-01-02 15:04:05") + " (unknown to this binary)"
+		case s.AppliedAt != nil:
+			status = "applied " + s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		default:
+			pending++
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, status)
+	}
+	tw.Flush()
+
+	fmt.Printf("\n%s: %d migration(s) pending\n", dbType, pending)
+	return nil
+}
+
+// loadKeyring sets up the encryption keys from ENCRYPTION_KEY and ENCRYPTION_KEYS.
+func loadKeyring() error {
+	keys, err := encryption.ParseKeyring(os.Getenv("ENCRYPTION_KEY"), os.Getenv("ENCRYPTION_KEYS"))
+	if err != nil {
+		return err
+	}
+	return encryption.SetKeyring(keys)
+}
+
+// reencrypt moves every stored secret to the newest encryption key.
+func reencrypt(db *sql.DB) error {
+	if err := loadKeyring(); err != nil {
+		return fmt.Errorf("encryption key error: %w", err)
+	}
+
+	stats, err := repository.ReencryptSecrets(context.Background(), db)
+	if err != nil {
+		return fmt.Errorf("re-encryption failed, nothing was changed: %w", err)
+	}
+
+	for _, s := range stats {
+		utils.LogInfo("Re-encrypted", "column", s.Table+"."+s.Column, "total", s.Total, "reencrypted", s.Reencrypted)
+	}
+	fmt.Printf("All secrets use key version %d, older keys can be removed\n", encryption.CurrentVersion())
+	return nil
+}
+
+// backfillPublicKeys derives the public half of the keys stored before it was kept.
+// Keys that cannot be parsed are logged and retried on the next start, protected keys without
+// a stored passphrase are skipped quietly.
+func backfillPublicKeys(ctx context.Context, keys *repository.KeyRepository) {
+	missing, err := keys.GetWithoutPublicKey(ctx)
+	if err != nil {
+		utils.LogErrorf("Failed to load keys without a public key", err)
+		return
+	}
+
+	for _, k := range missing {
+		privateKey, err := encryption.Decrypt(k.KeyData)
+		if err != nil {
+			utils.LogErrorf("Failed to decrypt key", err, "key_id", k.ID)
+			continue
+		}
+		passphrase := ""
+		if k.Passphrase != "" {
+			if passphrase, err = encryption.Decrypt(k.Passphrase); err != nil {
+				utils.LogErrorf("Failed to decrypt key passphrase", err, "key_id", k.ID)
+				continue
+			}
+		}
+		info, err := sshkeys.Inspect(privateKey, passphrase)
+		if errors.Is(err, sshkeys.ErrPassphraseRequired) {
+			// A protected key whose passphrase is asked for when connecting, this cannot change on the next start either
+			continue
+		}
+		if err != nil {
+			utils.LogErrorf("Failed to derive the public key", err, "key_id", k.ID, "name", k.Name)
+			continue
+		}
+		k.PublicKey, k.Fingerprint, k.KeyType = info.PublicKey, info.Fingerprint, info.Type
+		if err := keys.SetPublicKey(ctx, &k); err != nil {
+			utils.LogErrorf("Failed to store the public key", err, "key_id", k.ID)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// openDB opens and checks the database selected by DB_TYPE.
+func openDB(dbType string) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+
+	if dbType == "postgres" {
+		dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+			os.Getenv("DB_HOST"), os.Getenv("DB_PORT"),
+			os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"))
+		db, err = sql.Open("postgres", dsn)
+	} else {
+		// Get the database name from ENV or set the default
+		dbName := os.Getenv("DB_NAME")
+		if dbName == "" {
+			dbName = "ssh_manager"
+		}
+
+		// Create a path. Add the .db extension if it's not in the config.
+		dbPath := fmt.Sprintf("./data/%s.db", dbName)
+
+		os.MkdirAll("./data", os.ModePerm)
+		// Writers wait for each other instead of failing at once (e.g. two replicas migrating)
+		db, err = sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(10000)")
+		log.Printf("Using SQLite database file: %s", dbPath)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Setting up a pool for sql.DB
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+
+	// Checking the connection to the database (Ping)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot reach database: %w", err)
+	}
+	return db, nil
+}
@@ -1,13 +1,11 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/hex"
-	"fmt"
+	"context"
 	"log"
 	"net/http"
 	"os"
-	"ssh_manager/internal/encryption"
+	"ssh_manager/internal/auth"
 	"ssh_manager/internal/handlers"
 	"ssh_manager/internal/middleware"
 	"ssh_manager/internal/repository"
@@ -16,66 +14,39 @@ import (
 
 	"github.com/gorilla/sessions"
 	"github.com/joho/godotenv"
-
-	_ "github.com/lib/pq"
-	_ "modernc.org/sqlite"
 )
 
 func main() {
-	// Logger initialization and page template cache
+	// Logger initialization
 	utils.InitLogger()
-	utils.InitTemplates()
 
 	// Loading environment variables
 	_ = godotenv.Load()
 
 	// Database initialization
-	var db *sql.DB
-	var err error
-	dbType := os.Getenv("DB_TYPE")
-	if dbType == "" {
-		dbType = "sqlite"
-	}
-
-	if dbType == "postgres" {
-		dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-			os.Getenv("DB_HOST"), os.Getenv("DB_PORT"),
-			os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"))
-		db, err = sql.Open("postgres", dsn)
-	} else {
-		// Get the database name from ENV or set the default
-		dbName := os.Getenv("DB_NAME")
-		if dbName == "" {
-			dbName = "ssh_manager"
-		}
-
-		// Create a path. Add the .db extension if it's not in the config.
-		dbPath := fmt.Sprintf("./data/%s.db", dbName)
-
-		os.MkdirAll("./data", os.ModePerm)
-		db, err = sql.Open("sqlite", dbPath)
-		log.Printf("Using SQLite database file: %s", dbPath)
-	}
-
+	dbType := utils.GetEnv("DB_TYPE", "sqlite")
+	db, err := openDB(dbType)
 	if err != nil {
 		log.Fatal("Failed to open DB:", err)
 	}
 	defer db.Close()
 
-	// Setting up a pool for sql.DB
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-
-	// Checking the connection to the database (Ping)
-	if err := db.Ping(); err != nil {
-		log.Fatalf("Cannot reach database: %v", err)
+	// Maintenance subcommands (e.g. "migrate status") run instead of the server
+	if len(os.Args) > 1 {
+		if err := runCommand(db, dbType, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
 	// Rolling out tables (Migrations)
-	if err := repository.InitDB(db, dbType); err != nil {
-		log.Fatalf("Failed to initialize database schema: %v", err)
+	if err := repository.Migrate(context.Background(), db, dbType); err != nil {
+		log.Fatalf("Failed to migrate database schema: %v", err)
 	}
 
+	// Page template cache
+	utils.InitTemplates()
+
 	// Create an initial admin
 	adminUser := utils.GetEnv("INITIAL_ADMIN_USER", "admin")
 	adminPass := utils.GetEnv("INITIAL_ADMIN_PASSWORD", "admin")
@@ -96,25 +67,85 @@ func main() {
 	}
 
 	// Encryption
-	hexKey := os.Getenv("ENCRYPTION_KEY")
-	encryptionKey, err := hex.DecodeString(hexKey)
-	if err != nil || len(encryptionKey) != 32 {
+	if err := loadKeyring(); err != nil {
 		log.Fatalf("Encryption key error: %v", err)
 	}
-	encryption.SetEncryptionKey(encryptionKey)
 
 	// Services and repositories
 	uRepo := &repository.UserRepository{DB: db}
 	hRepo := &repository.HostRepository{DB: db}
 	kRepo := &repository.KeyRepository{DB: db}
-	sshService := services.NewSSHService(hRepo, kRepo, cleanupInterval, sessionTimeout)
+	hkRepo := &repository.HostKeyRepository{DB: db}
+	rRepo := &repository.RecordingRepository{DB: db}
+	gRepo := &repository.GroupRepository{DB: db}
+	tRepo := &repository.TunnelRepository{DB: db}
+	jRepo := &repository.JobRepository{DB: db}
+	snRepo := &repository.SnippetRepository{DB: db}
+	stRepo := &repository.SettingsRepository{DB: db}
+	waRepo := &repository.WebAuthnRepository{DB: db}
+	lRepo := &repository.LoginRepository{DB: db}
+	recordingsDir := utils.GetEnv("RECORDINGS_DIR", "./data/recordings")
+	sshService := services.NewSSHService(hRepo, kRepo, hkRepo, rRepo, recordingsDir, cleanupInterval, sessionTimeout)
+	jobService := services.NewJobService(sshService, jRepo)
+
+	// Keys stored before the public key was kept
+	backfillPublicKeys(context.Background(), kRepo)
+
+	// Jobs of a previous run cannot continue
+	if err := jRepo.MarkInterrupted(context.Background()); err != nil {
+		log.Printf("[ERROR] Failed to close interrupted jobs: %v", err)
+	}
+
+	// Passkeys
+	webAuthn, err := newWebAuthn()
+	if err != nil {
+		log.Fatalf("Invalid WebAuthn configuration: %v", err)
+	}
+
+	// Single sign-on, the local login stays as the break-glass way in unless it is turned off
+	oidcProvider, err := newOIDCProvider()
+	if err != nil {
+		log.Fatalf("Invalid OIDC configuration: %v", err)
+	}
+	ldapProvider, err := newLDAPProvider()
+	if err != nil {
+		log.Fatalf("Invalid LDAP configuration: %v", err)
+	}
+	localLogin := utils.GetBoolEnv("LOCAL_LOGIN", true)
+	if !localLogin && oidcProvider == nil && ldapProvider == nil {
+		log.Fatal("LOCAL_LOGIN=false needs another login, set OIDC_ISSUER or LDAP_URL")
+	}
+	// The login form asks the local accounts first, so the default admin stays the way in when the directory is down
+	var authProviders []auth.Provider
+	if localLogin {
+		authProviders = append(authProviders, &auth.Local{Users: uRepo})
+	}
+	if ldapProvider != nil {
+		authProviders = append(authProviders, ldapProvider)
+	}
+
+	// Failed logins, the waits and lockouts are kept in the database
+	throttle, err := auth.NewThrottle(auth.ThrottleConfig{
+		MaxFailures:   utils.GetIntEnv("LOGIN_MAX_FAILURES", 10),
+		MaxIPFailures: utils.GetIntEnv("LOGIN_MAX_IP_FAILURES", 50),
+		BaseDelay:     utils.GetDurationEnv("LOGIN_BACKOFF", "1s"),
+		Lockout:       utils.GetDurationEnv("LOGIN_LOCKOUT", "15m"),
+		Window:        utils.GetDurationEnv("LOGIN_FAILURE_WINDOW", "1h"),
+		Retention:     utils.GetDurationEnv("LOGIN_FAILURE_RETENTION", "720h"),
+	}, lRepo)
+	if err != nil {
+		log.Fatalf("Invalid login limits: %v", err)
+	}
+	go pruneLoginFailures(throttle)
 
 	handler := &handlers.Handlers{
-		UserRepo: uRepo, KeyRepo: kRepo, HostRepo: hRepo,
-		Store: store, SSHService: sshService,
+		UserRepo: uRepo, KeyRepo: kRepo, HostRepo: hRepo, HostKeyRepo: hkRepo, RecordingRepo: rRepo, GroupRepo: gRepo, TunnelRepo: tRepo, JobRepo: jRepo, SnippetRepo: snRepo, SettingsRepo: stRepo,
+		WebAuthnRepo: waRepo, Store: store, SSHService: sshService, JobService: jobService, WebAuthn: webAuthn,
+		LoginRepo: lRepo, OIDC: oidcProvider, AuthProviders: authProviders, Throttle: throttle,
+		DisableLocalLogin: !localLogin, TrustProxy: utils.GetBoolEnv("TRUST_PROXY", false),
 	}
 
-	authMiddleware := &middleware.Middleware{Store: store}
+	authMiddleware := &middleware.Middleware{Store: store, UserRepo: uRepo, SettingsRepo: stRepo}
 
 	// Router
 	r := SetupRoutes(handler, authMiddleware, store)
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"ssh_manager/internal/handlers"
 	"ssh_manager/internal/middleware"
+	"ssh_manager/internal/models"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
@@ -24,12 +25,22 @@ func SetupRoutes(h *handlers.Handlers, m *middleware.Middleware, store *sessions
 	// --- Public routes ---
 	r.HandleFunc("/login", h.LoginHandler).Methods("GET")
 	r.HandleFunc("/login", h.LoginPostHandler).Methods("POST")
+	r.HandleFunc("/login/2fa", h.LoginTwoFactorHandler).Methods("POST")
+	r.HandleFunc("/login/2fa/passkey/begin", h.BeginPasskeySecondFactorHandler).Methods("POST")
+	r.HandleFunc("/login/2fa/passkey/finish", h.FinishPasskeySecondFactorHandler).Methods("POST")
+	r.HandleFunc("/login/passkey/begin", h.BeginPasskeyLoginHandler).Methods("POST")
+	r.HandleFunc("/login/passkey/finish", h.FinishPasskeyLoginHandler).Methods("POST")
+	r.HandleFunc("/login/oidc", h.OIDCLoginHandler).Methods("GET")
+	r.HandleFunc("/login/oidc/callback", h.OIDCCallbackHandler).Methods("GET")
 
 	// --- Protected routes ---
 	protected := r.PathPrefix("/").Subrouter()
 	protected.Use(m.AuthMiddleware)
 	protected.Use(middleware.CSRFValidationMiddleware)
 
+	// Changing data and terminal input are not allowed for read-only users
+	writers := middleware.RequireRole(models.RoleAdmin, models.RoleOperator)
+
 	// Home and exit
 	protected.HandleFunc("/", h.HomeHandler).Methods("GET")
 	protected.HandleFunc("/logout", h.LogoutHandler).Methods("GET")
@@ -38,33 +49,138 @@ func SetupRoutes(h *handlers.Handlers, m *middleware.Middleware, store *sessions
 	protected.HandleFunc("/profile", h.ProfileHandler).Methods("GET")
 	protected.HandleFunc("/profile/update-username", h.UpdateUsernameHandler).Methods("POST")
 	protected.HandleFunc("/profile/update-password", h.UpdatePasswordHandler).Methods("POST")
+	protected.HandleFunc("/profile/2fa/setup", h.SetupTwoFactorHandler).Methods("POST")
+	protected.HandleFunc("/profile/2fa/enable", h.EnableTwoFactorHandler).Methods("POST")
+	protected.HandleFunc("/profile/2fa/disable", h.DisableTwoFactorHandler).Methods("POST")
+	protected.HandleFunc("/profile/2fa/recovery-codes", h.RegenerateRecoveryCodesHandler).Methods("POST")
+	protected.HandleFunc("/profile/passkeys", h.ListPasskeysHandler).Methods("GET")
+	protected.HandleFunc("/profile/passkeys/begin", h.BeginPasskeyRegistrationHandler).Methods("POST")
+	protected.HandleFunc("/profile/passkeys/finish", h.FinishPasskeyRegistrationHandler).Methods("POST")
+	protected.HandleFunc("/profile/passkeys/delete/{id:[0-9]+}", h.DeletePasskeyHandler).Methods("POST")
 
 	// Keys
 	keys := protected.PathPrefix("/keys").Subrouter()
 	keys.HandleFunc("", h.KeysHandler).Methods("GET")
 	keys.HandleFunc("/list", h.ListKeysHandler).Methods("GET")
-	keys.HandleFunc("/add", h.AddKeyHandler).Methods("POST")
 	keys.HandleFunc("/edit/{id:[0-9]+}", h.GetKeyDataHandler).Methods("GET")
-	keys.HandleFunc("/edit/{id:[0-9]+}", h.EditKeyHandler).Methods("POST")
-	keys.HandleFunc("/delete/{id:[0-9]+}", h.DeleteKeyHandler).Methods("POST")
+	keysWrite := keys.NewRoute().Subrouter()
+	keysWrite.Use(writers)
+	keysWrite.HandleFunc("/add", h.AddKeyHandler).Methods("POST")
+	keysWrite.HandleFunc("/generate", h.GenerateKeyHandler).Methods("POST")
+	keysWrite.HandleFunc("/edit/{id:[0-9]+}", h.EditKeyHandler).Methods("POST")
+	keysWrite.HandleFunc("/delete/{id:[0-9]+}", h.DeleteKeyHandler).Methods("POST")
 
 	// Hosts
 	hosts := protected.PathPrefix("/hosts").Subrouter()
-	hosts.HandleFunc("/add", h.AddHostHandler).Methods("POST")
 	hosts.HandleFunc("/data/{id:[0-9]+}", h.GetHostDataHandler).Methods("GET")
-	hosts.HandleFunc("/edit/{id:[0-9]+}", h.EditHostHandler).Methods("POST")
-	hosts.HandleFunc("/delete/{id:[0-9]+}", h.DeleteHostHandler).Methods("POST")
+	hosts.HandleFunc("/search", h.SearchHostsHandler).Methods("GET")
+	hosts.HandleFunc("/export", h.ExportSSHConfigHandler).Methods("GET")
+	hostsWrite := hosts.NewRoute().Subrouter()
+	hostsWrite.Use(writers)
+	hostsWrite.HandleFunc("/add", h.AddHostHandler).Methods("POST")
+	hostsWrite.HandleFunc("/edit/{id:[0-9]+}", h.EditHostHandler).Methods("POST")
+	hostsWrite.HandleFunc("/delete/{id:[0-9]+}", h.DeleteHostHandler).Methods("POST")
+	hostsWrite.HandleFunc("/host-keys/reset/{id:[0-9]+}", h.ResetHostKeysHandler).Methods("POST")
+	hostsWrite.HandleFunc("/install-key/{id:[0-9]+}", h.InstallKeyHandler).Methods("POST")
+	hostsWrite.HandleFunc("/import/preview", h.PreviewSSHConfigHandler).Methods("POST")
+	hostsWrite.HandleFunc("/import", h.ImportSSHConfigHandler).Methods("POST")
+
+	// Inventory of hosts and keys as JSON or CSV
+	inventory := protected.PathPrefix("/inventory").Subrouter()
+	inventory.HandleFunc("/export", h.ExportInventoryHandler).Methods("POST")
+	inventory.Handle("/import", writers(http.HandlerFunc(h.ImportInventoryHandler))).Methods("POST")
+
+	// Session recordings
+	recordings := protected.PathPrefix("/recordings").Subrouter()
+	recordings.HandleFunc("", h.RecordingsHandler).Methods("GET")
+	recordings.HandleFunc("/list", h.ListRecordingsHandler).Methods("GET")
+	recordings.HandleFunc("/cast/{id:[0-9]+}", h.GetRecordingCastHandler).Methods("GET")
 
 	// Websocket and termination
 	protected.HandleFunc("/ws/ssh", h.SSHWebsocketHandler)
-	protected.HandleFunc("/ssh/terminate", h.TerminateSessionHandler).Methods("POST")
+	protected.Handle("/ssh/terminate", writers(http.HandlerFunc(h.TerminateSessionHandler))).Methods("POST")
+
+	// Shells (several terminals on one host connection)
+	shells := protected.PathPrefix("/ssh/shells").Subrouter()
+	shells.HandleFunc("", h.ListShellsHandler).Methods("GET")
+	shellsWrite := shells.NewRoute().Subrouter()
+	shellsWrite.Use(writers)
+	shellsWrite.HandleFunc("/open", h.OpenShellHandler).Methods("POST")
+	shellsWrite.HandleFunc("/close", h.CloseShellHandler).Methods("POST")
+
+	// Port forwarding tunnels
+	tunnels := protected.PathPrefix("/tunnels").Subrouter()
+	tunnels.HandleFunc("", h.ListTunnelsHandler).Methods("GET")
+	tunnelsWrite := tunnels.NewRoute().Subrouter()
+	tunnelsWrite.Use(writers)
+	tunnelsWrite.HandleFunc("/add", h.AddTunnelHandler).Methods("POST")
+	tunnelsWrite.HandleFunc("/delete/{id:[0-9]+}", h.DeleteTunnelHandler).Methods("POST")
+	tunnelsWrite.HandleFunc("/start/{id:[0-9]+}", h.StartTunnelHandler).Methods("POST")
+	tunnelsWrite.HandleFunc("/stop/{id:[0-9]+}", h.StopTunnelHandler).Methods("POST")
+
+	// SOCKS5 proxies (like ssh -D)
+	proxies := protected.PathPrefix("/proxies").Subrouter()
+	proxies.HandleFunc("", h.ListProxiesHandler).Methods("GET")
+	proxiesWrite := proxies.NewRoute().Subrouter()
+	proxiesWrite.Use(writers)
+	proxiesWrite.HandleFunc("/start", h.StartProxyHandler).Methods("POST")
+	proxiesWrite.HandleFunc("/stop", h.StopProxyHandler).Methods("POST")
+
+	// Batch commands on many hosts
+	jobs := protected.PathPrefix("/jobs").Subrouter()
+	jobs.HandleFunc("", h.JobsHandler).Methods("GET")
+	jobs.HandleFunc("/list", h.ListJobsHandler).Methods("GET")
+	jobs.HandleFunc("/{id:[0-9]+}", h.GetJobHandler).Methods("GET")
+	jobs.HandleFunc("/{id:[0-9]+}/events", h.JobEventsHandler).Methods("GET")
+	jobs.Handle("/run", writers(http.HandlerFunc(h.RunJobHandler))).Methods("POST")
+
+	// Saved command snippets
+	snippets := protected.PathPrefix("/snippets").Subrouter()
+	snippets.HandleFunc("", h.SnippetsHandler).Methods("GET")
+	snippets.HandleFunc("/list", h.ListSnippetsHandler).Methods("GET")
+	snippetsWrite := snippets.NewRoute().Subrouter()
+	snippetsWrite.Use(writers)
+	snippetsWrite.HandleFunc("/add", h.AddSnippetHandler).Methods("POST")
+	snippetsWrite.HandleFunc("/edit/{id:[0-9]+}", h.EditSnippetHandler).Methods("POST")
+	snippetsWrite.HandleFunc("/delete/{id:[0-9]+}", h.DeleteSnippetHandler).Methods("POST")
+	snippetsWrite.HandleFunc("/run/{id:[0-9]+}", h.RunSnippetHandler).Methods("POST")
 
 	// SFTP
 	sfpts := protected.PathPrefix("/sftp").Subrouter()
 	sfpts.HandleFunc("/list", h.GetFilesHandler).Methods("GET")
 	sfpts.HandleFunc("/download", h.DownloadFileHandler).Methods("GET")
 	sfpts.HandleFunc("/download-zip", h.DownloadZipHandler).Methods("GET")
-	sfpts.HandleFunc("/upload", h.UploadHandler).Methods("POST")
+	sfpts.Handle("/upload", writers(http.HandlerFunc(h.UploadHandler))).Methods("POST")
+
+	// User administration
+	admin := protected.PathPrefix("/admin/users").Subrouter()
+	admin.Use(middleware.RequireRole(models.RoleAdmin))
+	admin.HandleFunc("", h.UsersHandler).Methods("GET")
+	admin.HandleFunc("/list", h.ListUsersHandler).Methods("GET")
+	admin.HandleFunc("/add", h.AddUserHandler).Methods("POST")
+	admin.HandleFunc("/edit/{id:[0-9]+}", h.EditUserHandler).Methods("POST")
+	admin.HandleFunc("/reset-password/{id:[0-9]+}", h.ResetUserPasswordHandler).Methods("POST")
+	admin.HandleFunc("/delete/{id:[0-9]+}", h.DeleteUserHandler).Methods("POST")
+	admin.HandleFunc("/reset-2fa/{id:[0-9]+}", h.ResetUserTwoFactorHandler).Methods("POST")
+	admin.HandleFunc("/require-2fa", h.RequireTwoFactorHandler).Methods("POST")
+	admin.HandleFunc("/failed-logins", h.FailedLoginsHandler).Methods("GET")
+	admin.HandleFunc("/unlock", h.UnlockLoginHandler).Methods("POST")
+
+	// Review of the recorded sessions of all users
+	adminRecordings := protected.PathPrefix("/admin/recordings").Subrouter()
+	adminRecordings.Use(middleware.RequireRole(models.RoleAdmin))
+	adminRecordings.HandleFunc("/list", h.AdminListRecordingsHandler).Methods("GET")
+	adminRecordings.HandleFunc("/cast/{id:[0-9]+}", h.AdminGetRecordingCastHandler).Methods("GET")
+
+	// Groups sharing hosts and keys
+	groups := protected.PathPrefix("/admin/groups").Subrouter()
+	groups.Use(middleware.RequireRole(models.RoleAdmin))
+	groups.HandleFunc("", h.GroupsHandler).Methods("GET")
+	groups.HandleFunc("/list", h.ListGroupsHandler).Methods("GET")
+	groups.HandleFunc("/add", h.AddGroupHandler).Methods("POST")
+	groups.HandleFunc("/delete/{id:[0-9]+}", h.DeleteGroupHandler).Methods("POST")
+	groups.HandleFunc("/{id:[0-9]+}/members/add", h.AddGroupMemberHandler).Methods("POST")
+	groups.HandleFunc("/{id:[0-9]+}/members/remove", h.RemoveGroupMemberHandler).Methods("POST")
 
 	// --- Processing 404 ---
 	r.NotFoundHandler = http.HandlerFunc(h.NotFoundHandler)
@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"ssh_manager/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig settings of the LDAP login. Templates and filters use {username}, the group filter also {dn}.
+type LDAPConfig struct {
+	URL       string      // ldap://host:389 or ldaps://host:636
+	StartTLS  bool        // Upgrade an ldap:// connection before the password is sent
+	TLSConfig *tls.Config // nil: system roots
+
+	// Either the DN of the user is built from a template (direct bind) ...
+	UserDN string // e.g. uid={username},ou=people,dc=example,dc=com
+	// ... or the user is searched, with a service account if anonymous searches are not allowed
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	UserFilter   string // e.g. (uid={username}) or (sAMAccountName={username})
+
+	UsernameAttribute string // uid or sAMAccountName
+	GroupAttribute    string // Attribute of the user with the DNs of their groups, e.g. memberOf
+	GroupBaseDN       string // Search for groups when set, for directories without memberOf
+	GroupFilter       string // e.g. (|(member={dn})(memberUid={username}))
+
+	AllowedGroups []string          // Names (CN) of the groups that may log in, empty: everyone
+	RoleMapping   map[string]string // Group name (CN) => role
+	DefaultRole   string            // Role of users without a mapped group, empty: they are refused
+	Provision     bool              // Create unknown users at their first login
+	Timeout       time.Duration
+}
+
+// LDAP binds as the user to check the password and reads their groups.
+type LDAP struct {
+	config LDAPConfig
+}
+
+// NewLDAP checks the configuration. Group names are compared case-insensitively.
+func NewLDAP(config LDAPConfig) (*LDAP, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q, expected ldap:// or ldaps://", config.URL)
+	}
+	if config.UserDN == "" && (config.BaseDN == "" || config.UserFilter == "") {
+		return nil, errors.New("set a user DN template or a base DN and a user filter")
+	}
+	if err := validateRoles(config.RoleMapping, config.DefaultRole); err != nil {
+		return nil, err
+	}
+
+	if config.TLSConfig == nil {
+		config.TLSConfig = &tls.Config{}
+	}
+	if config.TLSConfig.ServerName == "" {
+		config.TLSConfig.ServerName = u.Hostname()
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	mapping := make(map[string]string, len(config.RoleMapping))
+	for group, role := range config.RoleMapping {
+		mapping[strings.ToLower(group)] = role
+	}
+	config.RoleMapping = mapping
+	for i, group := range config.AllowedGroups {
+		config.AllowedGroups[i] = strings.ToLower(group)
+	}
+	return &LDAP{config: config}, nil
+}
+
+// Name the provider of LDAP users.
+func (p *LDAP) Name() string {
+	return models.AuthLDAP
+}
+
+// AutoProvision reports whether users are created at their first login.
+func (p *LDAP) AutoProvision() bool {
+	return p.config.Provision
+}
+
+// Authenticate binds with the password and maps the groups of the user to a role.
+func (p *LDAP) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	// An empty password would be an unauthenticated bind, which succeeds
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := p.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("bind as %s: %w", entry.DN, err)
+	}
+	// With the template the entry can only be read after the bind
+	if p.config.UserDN != "" {
+		if entry, err = p.readEntry(conn, entry.DN); err != nil {
+			return nil, err
+		}
+	}
+
+	identity := &Identity{Username: entry.GetAttributeValue(p.config.UsernameAttribute)}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	// Directories compare names case-insensitively
+	identity.Subject = strings.ToLower(identity.Username)
+
+	groups := entry.GetAttributeValues(p.config.GroupAttribute)
+	if p.config.GroupBaseDN != "" {
+		found, err := p.searchGroups(conn, entry.DN, identity.Username)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, found...)
+	}
+	for _, group := range groups {
+		identity.Groups = append(identity.Groups, groupName(group))
+	}
+
+	if !p.allowed(identity.Groups) {
+		return nil, ErrNotAllowed
+	}
+	var ok bool
+	if identity.Role, ok = RoleForGroups(identity.Groups, p.config.RoleMapping, p.config.DefaultRole); !ok {
+		return nil, ErrNoRole
+	}
+	return identity, nil
+}
+
+// connect opens the connection, upgraded with StartTLS when configured.
+func (p *LDAP) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(p.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.config.Timeout}),
+		ldap.DialWithTLSConfig(p.config.TLSConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", p.config.URL, err)
+	}
+	conn.SetTimeout(p.config.Timeout)
+
+	if p.config.StartTLS {
+		if err := conn.StartTLS(p.config.TLSConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// findUser returns the entry of the user, only with the DN when it comes from the template.
+func (p *LDAP) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	if p.config.UserDN != "" {
+		return &ldap.Entry{DN: strings.ReplaceAll(p.config.UserDN, "{username}", ldap.EscapeDN(username))}, nil
+	}
+
+	if p.config.BindDN != "" {
+		if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("bind as %s: %w", p.config.BindDN, err)
+		}
+	}
+	filter := strings.ReplaceAll(p.config.UserFilter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter, p.attributes(), nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("search %s: %w", filter, err)
+	}
+	// Unknown or ambiguous names are refused like a wrong password
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+// readEntry reads the attributes of the user.
+func (p *LDAP) readEntry(conn *ldap.Conn, dn string) (*ldap.Entry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)", p.attributes(), nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", dn, err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, fmt.Errorf("read %s: no entry", dn)
+	}
+	return result.Entries[0], nil
+}
+
+// searchGroups returns the DNs of the groups with the user as a member.
+func (p *LDAP) searchGroups(conn *ldap.Conn, dn, username string) ([]string, error) {
+	// The user may not be allowed to search the groups
+	if p.config.BindDN != "" {
+		if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("bind as %s: %w", p.config.BindDN, err)
+		}
+	}
+	filter := strings.NewReplacer("{dn}", ldap.EscapeFilter(dn), "{username}", ldap.EscapeFilter(username)).Replace(p.config.GroupFilter)
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter, []string{"cn"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("search %s: %w", filter, err)
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
+
+// attributes of the user entry the provider reads.
+func (p *LDAP) attributes() []string {
+	return []string{p.config.UsernameAttribute, p.config.GroupAttribute}
+}
+
+// allowed reports whether one of the groups may log in.
+func (p *LDAP) allowed(groups []string) bool {
+	if len(p.config.AllowedGroups) == 0 {
+		return true
+	}
+	for _, group := range groups {
+		for _, allowed := range p.config.AllowedGroups {
+			if group == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// groupName returns the lower-case value of the first RDN of the group DN, e.g. "admins" for cn=admins,ou=groups.
+func groupName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return strings.ToLower(dn)
+	}
+	return strings.ToLower(parsed.RDNs[0].Attributes[0].Value)
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"ssh_manager/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserFinder looks users up by name, implemented by the user repository.
+type UserFinder interface {
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+}
+
+// Local checks the passwords the manager stores.
+type Local struct {
+	Users UserFinder
+}
+
+// Name the provider of local users.
+func (p *Local) Name() string {
+	return models.AuthLocal
+}
+
+// AutoProvision local users are created by admins.
+func (p *Local) AutoProvision() bool {
+	return false
+}
+
+// Authenticate compares the password with the stored hash.
+func (p *Local) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	user, err := p.Users.GetByUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Users of an identity provider have no password here
+	if !user.IsLocal() {
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Subject: user.Username, Username: user.Username, Role: user.Role}, nil
+}
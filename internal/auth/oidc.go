@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig settings of the OpenID Connect login.
+type OIDCConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string            // The callback of the manager, e.g. https://ssh.example.com/login/oidc/callback
+	Scopes        []string          // Requested besides "openid"
+	UsernameClaim string            // Claim with the username, the email is taken when it is missing
+	GroupsClaim   string            // Claim with the groups of the user
+	RoleMapping   map[string]string // Group => role
+	DefaultRole   string            // Role of users without a mapped group, empty: they are refused
+	AutoProvision bool              // Create unknown users at their first login
+}
+
+// OIDCProvider runs the authorization code flow with PKCE.
+type OIDCProvider struct {
+	Config OIDCConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider // nil until the discovery succeeded
+}
+
+// NewOIDCProvider checks the configuration. The provider is discovered at the first login,
+// so that local logins keep working while the identity provider is unreachable.
+func NewOIDCProvider(config OIDCConfig) (*OIDCProvider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("the issuer, the client ID and the redirect URL are required")
+	}
+	if err := validateRoles(config.RoleMapping, config.DefaultRole); err != nil {
+		return nil, err
+	}
+	return &OIDCProvider{Config: config}, nil
+}
+
+// discover fetches the endpoints and keys of the identity provider once.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.Config.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("discovery of %s: %w", p.Config.Issuer, err)
+		}
+		p.provider = provider
+	}
+	return p.provider, nil
+}
+
+// oauth2Config the client settings for the discovered endpoints.
+func (p *OIDCProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.Config.ClientID,
+		ClientSecret: p.Config.ClientSecret,
+		RedirectURL:  p.Config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, p.Config.Scopes...),
+	}
+}
+
+// AuthCodeURL returns the login page of the identity provider. The verifier is kept by the caller
+// until the callback, the provider only sees its S256 challenge.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems the code of the callback and returns the verified identity.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("the token response has no ID token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.Config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("ID token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("the nonce of the ID token does not match")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	// Some providers only put the groups into the userinfo
+	if _, ok := claims[p.Config.GroupsClaim]; !ok && p.Config.GroupsClaim != "" {
+		if info, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token)); err == nil {
+			var extra map[string]interface{}
+			if info.Claims(&extra) == nil && extra[p.Config.GroupsClaim] != nil {
+				claims[p.Config.GroupsClaim] = extra[p.Config.GroupsClaim]
+			}
+		}
+	}
+
+	identity := &Identity{
+		Subject:  idToken.Subject,
+		Username: stringClaim(claims, p.Config.UsernameClaim),
+		Groups:   stringsClaim(claims, p.Config.GroupsClaim),
+	}
+	if identity.Username == "" {
+		identity.Username = stringClaim(claims, "email")
+	}
+	if identity.Username == "" {
+		return nil, fmt.Errorf("the ID token has no %q or email claim", p.Config.UsernameClaim)
+	}
+
+	if identity.Role, ok = RoleForGroups(identity.Groups, p.Config.RoleMapping, p.Config.DefaultRole); !ok {
+		return nil, ErrNoRole
+	}
+	return identity, nil
+}
+
+// stringClaim returns a string claim, empty if it is missing.
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// stringsClaim returns a list claim, a single string counts as a list of one.
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package auth logs users in with local passwords and external identity providers.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"ssh_manager/internal/models"
+)
+
+// Login errors of the providers.
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrNotAllowed         = errors.New("the user is in none of the allowed groups")
+	ErrNoRole             = errors.New("no group of the user is mapped to a role")
+)
+
+// Provider checks the username and password of the login form.
+type Provider interface {
+	// Name is stored as the auth provider of the users the provider confirms.
+	Name() string
+	// Authenticate returns the identity of the user. ErrInvalidCredentials means the provider
+	// does not know the user or the password is wrong, the next provider may be asked.
+	Authenticate(ctx context.Context, username, password string) (*Identity, error)
+	// AutoProvision reports whether unknown users are created at their first login.
+	AutoProvision() bool
+}
+
+// Identity the user as the provider confirmed them.
+type Identity struct {
+	Subject  string // Stable ID of the user at the provider
+	Username string
+	Groups   []string
+	Role     string
+}
+
+// RoleForGroups returns the most privileged role mapped to one of the groups, the default role otherwise.
+func RoleForGroups(groups []string, mapping map[string]string, defaultRole string) (string, bool) {
+	mapped := map[string]bool{}
+	for _, group := range groups {
+		if role, ok := mapping[group]; ok {
+			mapped[role] = true
+		}
+	}
+	for _, role := range []string{models.RoleAdmin, models.RoleOperator, models.RoleReadOnly} {
+		if mapped[role] {
+			return role, true
+		}
+	}
+	return defaultRole, defaultRole != ""
+}
+
+// validateRoles checks the roles of a group mapping.
+func validateRoles(mapping map[string]string, defaultRole string) error {
+	for group, role := range mapping {
+		if !models.ValidRole(role) {
+			return fmt.Errorf("invalid role %q for the group %q", role, group)
+		}
+	}
+	if defaultRole != "" && !models.ValidRole(defaultRole) {
+		return fmt.Errorf("invalid default role %q", defaultRole)
+	}
+	return nil
+}
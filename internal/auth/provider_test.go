@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"testing"
+
+	"ssh_manager/internal/models"
+)
+
+func TestRoleForGroups(t *testing.T) {
+	mapping := map[string]string{
+		"ops":     models.RoleOperator,
+		"admins":  models.RoleAdmin,
+		"auditor": models.RoleReadOnly,
+	}
+
+	tests := []struct {
+		name        string
+		groups      []string
+		defaultRole string
+		want        string
+		wantOK      bool
+	}{
+		{"single group", []string{"ops"}, "", models.RoleOperator, true},
+		{"most privileged wins", []string{"auditor", "admins", "ops"}, "", models.RoleAdmin, true},
+		{"unmapped groups are ignored", []string{"staff", "auditor"}, "", models.RoleReadOnly, true},
+		{"default role", []string{"staff"}, models.RoleReadOnly, models.RoleReadOnly, true},
+		{"mapped group beats the default", []string{"ops"}, models.RoleReadOnly, models.RoleOperator, true},
+		{"no group and no default", []string{"staff"}, "", "", false},
+		{"no groups at all", nil, "", "", false},
+		{"case matters", []string{"Admins"}, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := RoleForGroups(tt.groups, mapping, tt.defaultRole)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("RoleForGroups(%q) = %q, %v, want %q, %v", tt.groups, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"ssh_manager/internal/models"
+)
+
+// ThrottleConfig limits of the failed logins.
+type ThrottleConfig struct {
+	MaxFailures   int           // Failures of a username in a row until its lockout
+	MaxIPFailures int           // Failures from an address in a row until its lockout
+	BaseDelay     time.Duration // Wait after half of the limit, doubled with every further failure
+	Lockout       time.Duration // Length of a lockout, also the longest wait before it
+	Window        time.Duration // A failure after a longer pause starts a new count
+	Retention     time.Duration // How long failed logins are kept
+}
+
+// LoginStore keeps the failed logins and the lockouts.
+type LoginStore interface {
+	AddFailure(ctx context.Context, f *models.LoginFailure) error
+	DeleteFailuresBefore(ctx context.Context, before time.Time) error
+	GetLockout(ctx context.Context, kind, subject string) (*models.LoginLockout, error)
+	SaveLockout(ctx context.Context, l *models.LoginLockout) error
+	DeleteLockout(ctx context.Context, kind, subject string) (bool, error)
+	DeleteLockoutsBefore(ctx context.Context, before time.Time) error
+}
+
+// Attempt who tries to log in.
+type Attempt struct {
+	Username  string
+	IP        string
+	UserAgent string
+}
+
+// Throttle slows down password guessing per username and per address, the waits are stored
+// so that a restart does not lift them.
+type Throttle struct {
+	config ThrottleConfig
+	store  LoginStore
+	mu     sync.Mutex // An attempt is checked and counted with reads and writes
+}
+
+// NewThrottle checks the limits.
+func NewThrottle(config ThrottleConfig, store LoginStore) (*Throttle, error) {
+	if config.MaxFailures < 1 || config.MaxIPFailures < 1 {
+		return nil, errors.New("the failure limits must be at least 1")
+	}
+	if config.BaseDelay <= 0 || config.Lockout <= 0 || config.Window <= 0 {
+		return nil, errors.New("the delay, the lockout and the window must be positive")
+	}
+	return &Throttle{config: config, store: store}, nil
+}
+
+// lockoutKey a username or an address with its limit.
+type lockoutKey struct {
+	kind    string
+	subject string
+	limit   int
+}
+
+// keys returns what the attempt is counted for.
+func (t *Throttle) keys(a Attempt) []lockoutKey {
+	var keys []lockoutKey
+	if username := NormalizeUsername(a.Username); username != "" {
+		keys = append(keys, lockoutKey{models.LockoutUser, username, t.config.MaxFailures})
+	}
+	if ip := truncate(a.IP, 64); ip != "" {
+		keys = append(keys, lockoutKey{models.LockoutIP, ip, t.config.MaxIPFailures})
+	}
+	return keys
+}
+
+// Wait returns how long logins of the username or from the address are still refused.
+func (t *Throttle) Wait(ctx context.Context, a Attempt) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range t.keys(a) {
+		l, err := t.store.GetLockout(ctx, key.kind, key.subject)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if d := l.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Reservation an attempt that is counted as failed while its password or code is checked.
+type Reservation struct {
+	Attempt  Attempt
+	throttle *Throttle
+	counted  []lockoutKey // Taken back by Release
+}
+
+// Reserve checks the wait and counts the attempt as failed before the password is checked, so that
+// guesses sent at the same time cannot all pass the same check. While the attempt has to wait the wait
+// is returned and nothing is counted. The reservation is always returned, to record the outcome.
+func (t *Throttle) Reserve(ctx context.Context, a Attempt) (*Reservation, time.Duration, error) {
+	r := &Reservation{Attempt: a, throttle: t}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	wait, err := t.Wait(ctx, a)
+	if err != nil || wait > 0 {
+		return r, wait, err
+	}
+
+	now := time.Now()
+	for _, key := range t.keys(a) {
+		l, err := t.store.GetLockout(ctx, key.kind, key.subject)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && now.Sub(l.LastFailure) > t.config.Window) {
+			l, err = &models.LoginLockout{Kind: key.kind, Subject: key.subject}, nil
+		}
+		if err != nil {
+			return r, 0, err
+		}
+		l.Failures++
+		l.LastFailure = now
+		l.LockedUntil = now.Add(t.delay(l.Failures, key.limit))
+		if err := t.store.SaveLockout(ctx, l); err != nil {
+			return r, 0, err
+		}
+		r.counted = append(r.counted, key)
+	}
+	return r, 0, nil
+}
+
+// Fail records the failed login. Wrong passwords and codes stay counted, the other reasons are only recorded.
+func (r *Reservation) Fail(ctx context.Context, reason string) error {
+	if err := r.throttle.store.AddFailure(ctx, &models.LoginFailure{
+		Username:  NormalizeUsername(r.Attempt.Username),
+		IP:        truncate(r.Attempt.IP, 64),
+		UserAgent: truncate(r.Attempt.UserAgent, 512),
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if reason == models.FailurePassword || reason == models.FailureSecondFactor {
+		r.counted = nil
+		return nil
+	}
+	return r.Release(ctx)
+}
+
+// Release takes the count back when the password was right or could not be checked.
+// Nothing happens after Fail or a first Release.
+func (r *Reservation) Release(ctx context.Context) error {
+	if len(r.counted) == 0 {
+		return nil
+	}
+	t := r.throttle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(r.counted) > 0 {
+		key := r.counted[0]
+		l, err := t.store.GetLockout(ctx, key.kind, key.subject)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// Unlocked by an admin or a login meanwhile
+		case err != nil:
+			return err
+		case l.Failures <= 1:
+			if _, err := t.store.DeleteLockout(ctx, key.kind, key.subject); err != nil {
+				return err
+			}
+		default:
+			l.Failures--
+			l.LockedUntil = l.LastFailure.Add(t.delay(l.Failures, key.limit))
+			if err := t.store.SaveLockout(ctx, l); err != nil {
+				return err
+			}
+		}
+		r.counted = r.counted[1:]
+	}
+	return nil
+}
+
+// Succeed forgets the failures of the username after a complete login. The failures from the address are kept,
+// a valid account of an attacker must not reset them.
+func (t *Throttle) Succeed(ctx context.Context, username string) error {
+	_, err := t.store.DeleteLockout(ctx, models.LockoutUser, NormalizeUsername(username))
+	return err
+}
+
+// Prune deletes the failed logins after their retention and the counts that ended.
+func (t *Throttle) Prune(ctx context.Context) error {
+	now := time.Now()
+	if t.config.Retention > 0 {
+		if err := t.store.DeleteFailuresBefore(ctx, now.Add(-t.config.Retention)); err != nil {
+			return err
+		}
+	}
+	return t.store.DeleteLockoutsBefore(ctx, now.Add(-t.config.Window))
+}
+
+// delay returns the wait after the failures in a row: none up to half of the limit, then doubling
+// from the base delay, the lockout from the limit on.
+func (t *Throttle) delay(failures, limit int) time.Duration {
+	if failures >= limit {
+		return t.config.Lockout
+	}
+	free := limit / 2
+	if failures <= free {
+		return 0
+	}
+	d := t.config.BaseDelay
+	for i := free + 1; i < failures && d < t.config.Lockout; i++ {
+		d *= 2
+	}
+	return min(d, t.config.Lockout)
+}
+
+// NormalizeUsername returns the key of the username lockouts, logins differing only in case count together.
+func NormalizeUsername(username string) string {
+	return truncate(strings.ToLower(strings.TrimSpace(username)), 255)
+}
+
+// truncate cuts the value to at most n bytes without splitting a character.
+func truncate(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n]
+}
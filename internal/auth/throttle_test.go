@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"ssh_manager/internal/models"
+)
+
+func TestThrottleDelay(t *testing.T) {
+	throttle := &Throttle{config: ThrottleConfig{BaseDelay: time.Second, Lockout: 15 * time.Minute}}
+
+	tests := []struct {
+		failures int
+		limit    int
+		want     time.Duration
+	}{
+		{0, 10, 0},
+		{1, 10, 0},
+		{5, 10, 0},
+		{6, 10, time.Second},
+		{7, 10, 2 * time.Second},
+		{9, 10, 8 * time.Second},
+		{10, 10, 15 * time.Minute},
+		{11, 10, 15 * time.Minute},
+		{1, 1, 15 * time.Minute},
+		{1, 2, 0},
+		{2, 3, time.Second},
+		// The doubling stops at the lockout
+		{20, 100, 0},
+		{51, 100, time.Second},
+		{60, 100, 512 * time.Second},
+		{61, 100, 15 * time.Minute},
+		{99, 100, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := throttle.delay(tt.failures, tt.limit); got != tt.want {
+			t.Errorf("delay(%d, %d) = %v, want %v", tt.failures, tt.limit, got, tt.want)
+		}
+	}
+}
+
+// memoryLoginStore keeps the failed logins in memory.
+type memoryLoginStore struct {
+	mu       sync.Mutex
+	failures []models.LoginFailure
+	lockouts map[[2]string]models.LoginLockout
+}
+
+func newMemoryLoginStore() *memoryLoginStore {
+	return &memoryLoginStore{lockouts: make(map[[2]string]models.LoginLockout)}
+}
+
+func (s *memoryLoginStore) AddFailure(ctx context.Context, f *models.LoginFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, *f)
+	return nil
+}
+
+func (s *memoryLoginStore) DeleteFailuresBefore(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+func (s *memoryLoginStore) GetLockout(ctx context.Context, kind, subject string) (*models.LoginLockout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.lockouts[[2]string{kind, subject}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &l, nil
+}
+
+func (s *memoryLoginStore) SaveLockout(ctx context.Context, l *models.LoginLockout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lockouts[[2]string{l.Kind, l.Subject}] = *l
+	return nil
+}
+
+func (s *memoryLoginStore) DeleteLockout(ctx context.Context, kind, subject string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.lockouts[[2]string{kind, subject}]
+	delete(s.lockouts, [2]string{kind, subject})
+	return ok, nil
+}
+
+func (s *memoryLoginStore) DeleteLockoutsBefore(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+// failAttempt reserves the attempt and records it as failed, returns the wait if it was refused.
+func failAttempt(t *testing.T, throttle *Throttle, a Attempt, reason string) time.Duration {
+	t.Helper()
+	ctx := context.Background()
+	reservation, wait, err := throttle.Reserve(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait > 0 {
+		reason = models.FailureLocked
+	}
+	if err := reservation.Fail(ctx, reason); err != nil {
+		t.Fatal(err)
+	}
+	return wait
+}
+
+func TestThrottleFail(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryLoginStore()
+	throttle, err := NewThrottle(ThrottleConfig{MaxFailures: 4, MaxIPFailures: 20, BaseDelay: time.Minute, Lockout: time.Hour, Window: time.Hour}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempt := Attempt{Username: " Alice ", IP: "192.0.2.1"}
+
+	// Only wrong passwords and codes count
+	failAttempt(t, throttle, attempt, models.FailureDisabled)
+	if wait, _ := throttle.Wait(ctx, attempt); wait != 0 {
+		t.Errorf("wait after a disabled account = %v, want none", wait)
+	}
+	if len(store.lockouts) != 0 {
+		t.Errorf("lockouts after a disabled account = %+v, want none", store.lockouts)
+	}
+
+	waits := []time.Duration{0, 0, time.Minute}
+	for i, want := range waits {
+		if wait := failAttempt(t, throttle, attempt, models.FailurePassword); wait != 0 {
+			t.Fatalf("attempt %d refused for %v", i+1, wait)
+		}
+		wait, err := throttle.Wait(ctx, attempt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait > want || wait < want-time.Second {
+			t.Errorf("wait after %d failures = %v, want %v", i+1, wait, want)
+		}
+	}
+	// Refused attempts are recorded but not counted
+	if wait := failAttempt(t, throttle, attempt, models.FailurePassword); wait < 59*time.Second {
+		t.Errorf("attempt during the wait refused for %v, want a minute", wait)
+	}
+	if len(store.failures) != len(waits)+2 || store.failures[len(store.failures)-1].Reason != models.FailureLocked {
+		t.Errorf("failures recorded = %+v, want %d ending with a locked one", store.failures, len(waits)+2)
+	}
+
+	// The username waits from any address, the address is free for other usernames
+	if wait, _ := throttle.Wait(ctx, Attempt{Username: "ALICE", IP: "192.0.2.2"}); wait < 59*time.Second {
+		t.Errorf("wait of the username from another address = %v, want a minute", wait)
+	}
+	if wait, _ := throttle.Wait(ctx, Attempt{Username: "bob", IP: "192.0.2.1"}); wait != 0 {
+		t.Errorf("wait of another user from the address = %v, want none", wait)
+	}
+
+	// A login forgets the username failures but not those of the address
+	if err := throttle.Succeed(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetLockout(ctx, models.LockoutUser, "alice"); err != sql.ErrNoRows {
+		t.Errorf("the username lockout is kept after a login: %v", err)
+	}
+	if l, err := store.GetLockout(ctx, models.LockoutIP, "192.0.2.1"); err != nil || l.Failures != len(waits) {
+		t.Errorf("address lockout = %+v, %v, want %d failures", l, err, len(waits))
+	}
+}
+
+func TestThrottleRelease(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryLoginStore()
+	throttle, err := NewThrottle(ThrottleConfig{MaxFailures: 4, MaxIPFailures: 20, BaseDelay: time.Minute, Lockout: time.Hour, Window: time.Hour}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempt := Attempt{Username: "alice", IP: "192.0.2.1"}
+
+	failAttempt(t, throttle, attempt, models.FailurePassword)
+	failAttempt(t, throttle, attempt, models.FailurePassword)
+
+	// A right password takes its count back, the earlier failures stay
+	reservation, wait, err := throttle.Reserve(ctx, attempt)
+	if err != nil || wait != 0 {
+		t.Fatalf("Reserve = %v, %v", wait, err)
+	}
+	if wait, _ := throttle.Wait(ctx, attempt); wait < 59*time.Second {
+		t.Errorf("wait while the password is checked = %v, want a minute", wait)
+	}
+	if err := reservation.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reservation.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := throttle.Wait(ctx, attempt); wait != 0 {
+		t.Errorf("wait after the release = %v, want none", wait)
+	}
+	for _, kind := range []string{models.LockoutUser, models.LockoutIP} {
+		subject := map[string]string{models.LockoutUser: "alice", models.LockoutIP: "192.0.2.1"}[kind]
+		if l, err := store.GetLockout(ctx, kind, subject); err != nil || l.Failures != 2 {
+			t.Errorf("%s lockout = %+v, %v, want 2 failures", kind, l, err)
+		}
+	}
+
+	// The first attempt of a username leaves nothing behind
+	reservation, _, err = throttle.Reserve(ctx, Attempt{Username: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reservation.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetLockout(ctx, models.LockoutUser, "bob"); err != sql.ErrNoRows {
+		t.Errorf("lockout of bob after a release: %v", err)
+	}
+}
+
+func TestThrottleConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	throttle, err := NewThrottle(ThrottleConfig{MaxFailures: 10, MaxIPFailures: 100, BaseDelay: time.Minute, Lockout: time.Hour, Window: time.Hour}, newMemoryLoginStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// All guesses arrive before any password is checked
+	const guesses = 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var reservations []*Reservation
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reservation, wait, err := throttle.Reserve(ctx, Attempt{Username: "alice", IP: "192.0.2.1"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				reservations = append(reservations, reservation)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Up to half of the limit there is no wait, the next failure already has one
+	if len(reservations) != 10/2+1 {
+		t.Errorf("%d of %d guesses were checked, want %d", len(reservations), guesses, 10/2+1)
+	}
+}
@@ -4,29 +4,112 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 )
 
-var encryptionKey []byte // Global variable for encryption key
+// Ciphertexts look like "v2:<hex>". Values written before key versions existed are bare hex,
+// they belong to version 1, which is also the version of a single ENCRYPTION_KEY.
+const (
+	versionPrefix = "v"
+	legacyVersion = 1
+)
+
+var (
+	keyring        = map[int][]byte{} // Encryption keys by version
+	currentVersion int                // Newest version, used for encrypting
+)
+
+// ErrUnknownKeyVersion is returned when a ciphertext was made with a key that is not in the keyring.
+var ErrUnknownKeyVersion = errors.New("unknown encryption key version")
 
 // SetEncryptionKey sets the encryption key.
 func SetEncryptionKey(key []byte) {
 	if len(key) != 32 {
 		panic("Invalid encryption key size: key must be 32 bytes")
 	}
-	encryptionKey = key
+	keyring = map[int][]byte{legacyVersion: key}
+	currentVersion = legacyVersion
 }
 
-// Encrypt encrypts text using AES.
-func Encrypt(text string) (string, error) {
-	block, err := aes.NewCipher(encryptionKey)
-	if err != nil {
-		return "", err
+// SetKeyring sets all known keys, the one with the highest version encrypts new data.
+func SetKeyring(keys map[int][]byte) error {
+	if len(keys) == 0 {
+		return errors.New("keyring is empty")
 	}
 
-	// GCM — standard for encrypting data in databases
-	aesGCM, err := cipher.NewGCM(block)
+	current := 0
+	for version, key := range keys {
+		if version < 1 {
+			return fmt.Errorf("invalid key version %d: versions start at 1", version)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("invalid size of key version %d: key must be 32 bytes", version)
+		}
+		if version > current {
+			current = version
+		}
+	}
+	keyring = keys
+	currentVersion = current
+	return nil
+}
+
+// ParseKeyring builds the keyring from ENCRYPTION_KEY (version 1) and ENCRYPTION_KEYS,
+// a comma separated list of "version:hexkey" pairs, e.g. "2:ab12...,1:cd34...".
+func ParseKeyring(legacyKey, keys string) (map[int][]byte, error) {
+	result := make(map[int][]byte)
+
+	if legacyKey != "" {
+		key, err := hex.DecodeString(legacyKey)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEY: %w", err)
+		}
+		result[legacyVersion] = key
+	}
+
+	for _, pair := range strings.Split(keys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		v, k, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS: %q must look like version:hexkey", pair)
+		}
+		version, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(v), versionPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS: invalid version %q", v)
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(k))
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS: key version %d: %w", version, err)
+		}
+		if old, ok := result[version]; ok && string(old) != string(key) {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS: version %d is given twice with different keys", version)
+		}
+		result[version] = key
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New("no encryption key is set, use ENCRYPTION_KEY or ENCRYPTION_KEYS")
+	}
+	return result, nil
+}
+
+// CurrentVersion returns the key version new data is encrypted with.
+func CurrentVersion() int {
+	return currentVersion
+}
+
+// Encrypt encrypts text using AES with the newest key.
+func Encrypt(text string) (string, error) {
+	aesGCM, err := newGCM(currentVersion)
 	if err != nil {
 		return "", err
 	}
@@ -39,23 +122,23 @@ func Encrypt(text string) (string, error) {
 	// Encrypt and add nonce to the beginning
 	ciphertext := aesGCM.Seal(nonce, nonce, []byte(text), nil)
 
-	return fmt.Sprintf("%x", ciphertext), nil // We use hex for simplicity in the database
+	return fmt.Sprintf("%s%d:%x", versionPrefix, currentVersion, ciphertext), nil // We use hex for simplicity in the database
 }
 
-// Decrypt decrypts text using AES.
-func Decrypt(encryptedHex string) (string, error) {
-	var ciphertext []byte
-	_, err := fmt.Sscanf(encryptedHex, "%x", &ciphertext)
+// Decrypt decrypts text using AES with the key the text was encrypted with.
+func Decrypt(encrypted string) (string, error) {
+	version, encryptedHex, err := splitVersion(encrypted)
 	if err != nil {
 		return "", err
 	}
 
-	block, err := aes.NewCipher(encryptionKey)
+	var ciphertext []byte
+	_, err = fmt.Sscanf(encryptedHex, "%x", &ciphertext)
 	if err != nil {
 		return "", err
 	}
 
-	aesGCM, err := cipher.NewGCM(block)
+	aesGCM, err := newGCM(version)
 	if err != nil {
 		return "", err
 	}
@@ -73,3 +156,60 @@ func Decrypt(encryptedHex string) (string, error) {
 
 	return string(plaintext), nil
 }
+
+// KeyVersion returns the key version of a ciphertext.
+func KeyVersion(encrypted string) (int, error) {
+	version, _, err := splitVersion(encrypted)
+	return version, err
+}
+
+// Reencrypt encrypts the text again with the newest key. Texts that already use it are returned as is.
+func Reencrypt(encrypted string) (string, bool, error) {
+	version, err := KeyVersion(encrypted)
+	if err != nil {
+		return "", false, err
+	}
+	if version == currentVersion {
+		return encrypted, false, nil
+	}
+
+	plaintext, err := Decrypt(encrypted)
+	if err != nil {
+		return "", false, err
+	}
+	result, err := Encrypt(plaintext)
+	return result, err == nil, err
+}
+
+// splitVersion separates the version prefix from the hex ciphertext.
+func splitVersion(encrypted string) (int, string, error) {
+	if !strings.HasPrefix(encrypted, versionPrefix) {
+		return legacyVersion, encrypted, nil
+	}
+
+	v, rest, ok := strings.Cut(strings.TrimPrefix(encrypted, versionPrefix), ":")
+	if !ok {
+		return 0, "", errors.New("malformed ciphertext")
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, "", errors.New("malformed ciphertext version")
+	}
+	return version, rest, nil
+}
+
+// newGCM creates the AES-GCM cipher for the key version.
+func newGCM(version int) (cipher.AEAD, error) {
+	key, ok := keyring[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownKeyVersion, version)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// GCM — standard for encrypting data in databases
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,126 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Secrets encrypted with a passphrase look like "pp1$<salt hex>$<nonce and ciphertext hex>",
+// so that every value can be decrypted on its own, e.g. on another server.
+const passphrasePrefix = "pp1$"
+
+// Argon2id parameters of the passphrase key.
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	saltSize     = 16
+)
+
+// ErrWrongPassphrase is returned when a secret cannot be decrypted with the given passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase or damaged secret")
+
+// ErrMixedSalts is returned when the secrets were not encrypted by the same export.
+var ErrMixedSalts = errors.New("the secrets were encrypted by different exports")
+
+// PassphraseCipher encrypts secrets with a key derived from a passphrase instead of the server keyring.
+// Deriving a key is slow on purpose, so it is derived once: an export encrypts all its secrets with
+// the same salt, and a secret with another salt is refused.
+type PassphraseCipher struct {
+	passphrase string
+	salt       []byte      // Created on the first Encrypt or taken from the first decrypted secret
+	key        cipher.AEAD // Derived from the passphrase and salt
+}
+
+// NewPassphraseCipher creates a cipher for the passphrase.
+func NewPassphraseCipher(passphrase string) *PassphraseCipher {
+	return &PassphraseCipher{passphrase: passphrase}
+}
+
+// IsPassphraseEncrypted checks whether the value was made by PassphraseCipher.Encrypt.
+func IsPassphraseEncrypted(value string) bool {
+	return strings.HasPrefix(value, passphrasePrefix)
+}
+
+// Encrypt encrypts the text with the passphrase.
+func (c *PassphraseCipher) Encrypt(text string) (string, error) {
+	salt := c.salt
+	if salt == nil {
+		salt = make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return "", err
+		}
+	}
+	aead, err := c.aead(salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	ciphertext := aead.Seal(nonce, nonce, []byte(text), nil)
+	return fmt.Sprintf("%s%x$%x", passphrasePrefix, c.salt, ciphertext), nil
+}
+
+// Decrypt decrypts a value made by Encrypt with the same passphrase.
+func (c *PassphraseCipher) Decrypt(value string) (string, error) {
+	saltHex, ciphertextHex, ok := strings.Cut(strings.TrimPrefix(value, passphrasePrefix), "$")
+	if !IsPassphraseEncrypted(value) || !ok {
+		return "", errors.New("malformed passphrase secret")
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return "", errors.New("malformed passphrase secret")
+	}
+	ciphertext, err := hex.DecodeString(ciphertextHex)
+	if err != nil {
+		return "", errors.New("malformed passphrase secret")
+	}
+
+	aead, err := c.aead(salt)
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return "", ErrWrongPassphrase
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(plaintext), nil
+}
+
+// aead returns the AES-GCM cipher of the passphrase and salt. The first salt is kept, any other one is refused.
+func (c *PassphraseCipher) aead(salt []byte) (cipher.AEAD, error) {
+	if c.key != nil {
+		if !bytes.Equal(salt, c.salt) {
+			return nil, ErrMixedSalts
+		}
+		return c.key, nil
+	}
+
+	key := argon2.IDKey([]byte(c.passphrase), salt, argonTime, argonMemory, argonThreads, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c.salt, c.key = salt, aead
+	return aead, nil
+}
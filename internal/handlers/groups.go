@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/repository"
+	"ssh_manager/internal/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// GroupsHandler displays the group administration page.
+func (h *Handlers) GroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.GroupRepo.GetAll(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] GroupsHandler: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	users, err := h.UserRepo.GetAll(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] GroupsHandler - UserRepo.GetAll: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.RenderTemplate(w, "groups.html", map[string]interface{}{
+		"Title":    "Groups",
+		"Groups":   groups,
+		"Users":    users,
+		"ShowMenu": true,
+	}, r)
+}
+
+// ListGroupsHandler returns all groups with their members.
+func (h *Handlers) ListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.GroupRepo.GetAll(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] ListGroupsHandler: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Groups retrieved successfully", groups)
+}
+
+// AddGroupHandler creates a new group.
+func (h *Handlers) AddGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var group models.Group
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		utils.SendJSONResponse(w, false, "Group name cannot be empty", nil)
+		return
+	}
+
+	if err := h.GroupRepo.Create(r.Context(), &group); err != nil {
+		log.Printf("[ERROR] GroupRepo.Create (%s): %v", group.Name, err)
+		utils.SendJSONResponse(w, false, "Failed to create group, the name may be taken", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Group created successfully", group)
+}
+
+// DeleteGroupHandler deletes a group that no longer owns hosts or keys.
+func (h *Handlers) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid group ID", nil)
+		return
+	}
+
+	if err := h.GroupRepo.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, repository.ErrGroupInUse) {
+			utils.SendJSONResponse(w, false, "The group still owns hosts, keys or snippets, move or delete them first", nil)
+			return
+		}
+		log.Printf("[ERROR] GroupRepo.Delete (ID: %d): %v", id, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Group deleted successfully", map[string]interface{}{
+		"id": id,
+	})
+}
+
+// AddGroupMemberHandler adds a user to the group.
+func (h *Handlers) AddGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, userID, ok := parseMemberRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if member, err := h.GroupRepo.IsMember(r.Context(), groupID, userID); err == nil && member {
+		utils.SendJSONResponse(w, false, "The user is already a member", nil)
+		return
+	}
+
+	if err := h.GroupRepo.AddMember(r.Context(), groupID, userID); err != nil {
+		log.Printf("[ERROR] GroupRepo.AddMember (group: %d, user: %d): %v", groupID, userID, err)
+		utils.SendJSONResponse(w, false, "Failed to add member", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Member added successfully", nil)
+}
+
+// RemoveGroupMemberHandler removes a user from the group and closes their connections to its hosts.
+func (h *Handlers) RemoveGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, userID, ok := parseMemberRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.GroupRepo.RemoveMember(r.Context(), groupID, userID); err != nil {
+		log.Printf("[ERROR] GroupRepo.RemoveMember (group: %d, user: %d): %v", groupID, userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	// The former member must not keep using shared hosts through already opened connections
+	hostIDs, err := h.HostRepo.GetIDsByGroupID(r.Context(), groupID)
+	if err != nil {
+		utils.LogErrorf("Failed to load group hosts", err, "group_id", groupID)
+	}
+	for _, hostID := range hostIDs {
+		if _, err := h.HostRepo.GetByID(r.Context(), hostID, userID); err != nil {
+			h.SSHService.TerminateSession(userID, hostID)
+		}
+	}
+
+	utils.SendJSONResponse(w, true, "Member removed successfully", nil)
+}
+
+// parseMemberRequest reads the group ID from the path and the user ID from the body.
+func parseMemberRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	groupID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid group ID", nil)
+		return 0, 0, false
+	}
+
+	var requestData struct {
+		UserID int `json:"user_id,string"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.UserID == 0 {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return 0, 0, false
+	}
+	return groupID, requestData.UserID, true
+}
+
+// canManage reports whether the current user may change or delete a shared entry of the owner.
+func canManage(r *http.Request, ownerID int) bool {
+	user, _ := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	return user != nil && user.Manages(ownerID)
+}
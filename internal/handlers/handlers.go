@@ -1,17 +1,36 @@
 package handlers
 
 import (
+	"ssh_manager/internal/auth"
 	"ssh_manager/internal/repository"
 	"ssh_manager/internal/services"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gorilla/sessions"
 )
 
 // Handlers contains common dependencies for all handlers.
 type Handlers struct {
-	UserRepo   *repository.UserRepository
-	KeyRepo    *repository.KeyRepository
-	HostRepo   *repository.HostRepository
-	Store      *sessions.CookieStore
-	SSHService *services.SSHService
+	UserRepo      *repository.UserRepository
+	KeyRepo       *repository.KeyRepository
+	HostRepo      *repository.HostRepository
+	HostKeyRepo   *repository.HostKeyRepository
+	RecordingRepo *repository.RecordingRepository
+	GroupRepo     *repository.GroupRepository
+	TunnelRepo    *repository.TunnelRepository
+	JobRepo       *repository.JobRepository
+	SnippetRepo   *repository.SnippetRepository
+	SettingsRepo  *repository.SettingsRepository
+	WebAuthnRepo  *repository.WebAuthnRepository
+	LoginRepo     *repository.LoginRepository
+	Store         *sessions.CookieStore
+	SSHService    *services.SSHService
+	JobService    *services.JobService
+	WebAuthn      *webauthn.WebAuthn // nil: the relying party is taken from the request
+	OIDC          *auth.OIDCProvider // nil: single sign-on is off
+	AuthProviders []auth.Provider    // Check the password of the login form in this order
+	Throttle      *auth.Throttle     // Waits and lockouts after failed logins
+
+	DisableLocalLogin bool // No local passwords and passkeys, the local login is the break-glass way in
+	TrustProxy        bool // Take the client address from X-Forwarded-For
 }
@@ -3,9 +3,20 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"sort"
+	"ssh_manager/internal/models"
 	"ssh_manager/internal/utils"
+	"strings"
 )
 
+// hostFolder a folder of the home page with the hosts directly in it.
+type hostFolder struct {
+	Path  string // Full path, empty for the top level
+	Name  string // Last part of the path
+	Depth int
+	Hosts []models.Host
+}
+
 // HomeHandler displays the main page with hosts.
 func (h *Handlers) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	// Loading hosts from the database
@@ -22,10 +33,77 @@ func (h *Handlers) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	// active connections to SSH
 	activeIDs := h.SSHService.GetActiveHostIDs(userID)
 
+	// Groups the user can share hosts with
+	groups, err := h.GroupRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] HomeHandler - GroupRepo.GetByUserID (userID: %d): %v", userID, err)
+	}
+
+	tags, err := h.HostRepo.GetTags(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] HomeHandler - GetTags (userID: %d): %v", userID, err)
+	}
+
+	folders := groupByFolder(hosts)
+	var folderPaths []string
+	for _, f := range folders {
+		if f.Path != "" {
+			folderPaths = append(folderPaths, f.Path)
+		}
+	}
+
 	utils.RenderTemplate(w, "home.html", map[string]interface{}{
-		"Title":     "Home",
-		"ShowMenu":  true,
-		"Hosts":     hosts,
-		"ActiveIDs": activeIDs,
+		"Title":       "Home",
+		"ShowMenu":    true,
+		"Hosts":       hosts,
+		"Folders":     folders,
+		"FolderPaths": folderPaths,
+		"Tags":        tags,
+		"Groups":      groups,
+		"ActiveIDs":   activeIDs,
 	}, r)
 }
+
+// groupByFolder splits hosts into the folder tree, parents come before their subfolders
+// and also appear when they have no hosts of their own.
+func groupByFolder(hosts []models.Host) []hostFolder {
+	// Comparing the parts of the path, so that "prod/db" stays right after "prod" and before "prod-old"
+	sorted := make([]models.Host, len(hosts))
+	copy(sorted, hosts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := strings.Split(sorted[i].Folder, "/"), strings.Split(sorted[j].Folder, "/")
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	var folders []hostFolder
+	index := make(map[string]int)
+
+	var add func(path string) int
+	add = func(path string) int {
+		if i, ok := index[path]; ok {
+			return i
+		}
+		f := hostFolder{Path: path, Name: path}
+		if path != "" {
+			f.Depth = strings.Count(path, "/") + 1
+			if i := strings.LastIndex(path, "/"); i >= 0 {
+				add(path[:i])
+				f.Name = path[i+1:]
+			}
+		}
+		folders = append(folders, f)
+		index[path] = len(folders) - 1
+		return index[path]
+	}
+
+	for _, host := range sorted {
+		i := add(host.Folder)
+		folders[i].Hosts = append(folders[i].Hosts, host)
+	}
+	return folders
+}
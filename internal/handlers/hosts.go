@@ -1,17 +1,29 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 
 	"ssh_manager/internal/encryption"
 	"ssh_manager/internal/models"
+	"ssh_manager/internal/repository"
+	"ssh_manager/internal/totp"
 	"ssh_manager/internal/utils"
 
 	"github.com/gorilla/mux"
 )
 
+// Host search and labels limits.
+const (
+	defaultHostsPerPage = 50
+	maxHostsPerPage     = 500
+	maxTagLength        = 64
+)
+
 // GetHostDataHandler returns data for a specific host for editing.
 func (h *Handlers) GetHostDataHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -31,10 +43,168 @@ func (h *Handlers) GetHostDataHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	host.Password = ""
+	hideTOTPSecret(host)
+
+	// Pinned server keys so that the user can check or reset them
+	host.HostKeys, err = h.HostKeyRepo.GetByHostID(r.Context(), host.ID)
+	if err != nil {
+		utils.LogErrorf("Failed to load host keys", err, "host_id", host.ID)
+	}
 
 	utils.SendJSONResponse(w, true, "Host data retrieved successfully", host)
 }
 
+// SearchHostsHandler returns a page of the user's hosts filtered by the query parameters
+// q (name or address), name, address, tag, folder and active=true (hosts with an open connection),
+// ordered by sort (name, address, folder, created) and order (asc, desc).
+func (h *Handlers) SearchHostsHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	q := r.URL.Query()
+	filter := repository.HostFilter{
+		Query:   strings.TrimSpace(q.Get("q")),
+		Name:    strings.TrimSpace(q.Get("name")),
+		Address: strings.TrimSpace(q.Get("address")),
+		Tag:     strings.ToLower(strings.TrimSpace(q.Get("tag"))),
+		Folder:  normalizeFolder(q.Get("folder")),
+		Sort:    q.Get("sort"),
+		Desc:    q.Get("order") == "desc",
+	}
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(q.Get("per_page"))
+	if perPage < 1 {
+		perPage = defaultHostsPerPage
+	}
+	if perPage > maxHostsPerPage {
+		perPage = maxHostsPerPage
+	}
+	filter.Limit = perPage
+	filter.Offset = (page - 1) * perPage
+
+	activeIDs := []int{}
+	for id := range h.SSHService.GetActiveHostIDs(userID) {
+		activeIDs = append(activeIDs, id)
+	}
+	sort.Ints(activeIDs)
+	if q.Get("active") == "true" {
+		filter.IDs = activeIDs
+	}
+
+	hosts, total, err := h.HostRepo.Search(r.Context(), userID, filter)
+	if err != nil {
+		utils.LogErrorf("Failed to search hosts", err, "user_id", userID)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	for i := range hosts {
+		hosts[i].Password = ""
+		hideTOTPSecret(&hosts[i])
+	}
+	if hosts == nil {
+		hosts = []models.Host{}
+	}
+
+	utils.SendJSONResponse(w, true, "Hosts retrieved successfully", map[string]interface{}{
+		"hosts":      hosts,
+		"total":      total,
+		"page":       page,
+		"per_page":   perPage,
+		"active_ids": activeIDs,
+	})
+}
+
+// ResetHostKeysHandler forgets the pinned server keys, the next connection will ask to confirm a new one.
+func (h *Handlers) ResetHostKeysHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid host ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	host, err := h.HostRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Host not found", nil)
+		return
+	}
+	// Trusting a new key of a shared host is up to its owner
+	if !canManage(r, host.UserID) {
+		utils.SendJSONResponse(w, false, "Only the owner can reset the keys of a shared host", nil)
+		return
+	}
+
+	if err := h.HostKeyRepo.DeleteByHostID(r.Context(), id); err != nil {
+		utils.LogErrorf("Failed to reset host keys", err, "host_id", id)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Host keys reset successfully", map[string]interface{}{
+		"id": id,
+	})
+}
+
+// InstallKeyHandler installs the public key of a stored key on the host like ssh-copy-id and, once a login
+// with the key works, switches the host to key authentication.
+func (h *Handlers) InstallKeyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid host ID", nil)
+		return
+	}
+
+	var req struct {
+		KeyID int `json:"key_id,string"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.KeyID == 0 {
+		utils.SendJSONResponse(w, false, "Select a key", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	host, err := h.HostRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Host not found", nil)
+		return
+	}
+	if !canManage(r, host.UserID) {
+		utils.SendJSONResponse(w, false, "Only the owner can change a shared host", nil)
+		return
+	}
+
+	// The host has to be allowed to use the key before anything is changed on it
+	host.AuthType = "key"
+	host.KeyID = &req.KeyID
+	if msg := h.validateHostGroup(r.Context(), userID, host); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
+	result, err := h.SSHService.InstallKey(r.Context(), userID, id, req.KeyID)
+	if err != nil {
+		utils.LogErrorf("Failed to install key", err, "host_id", id, "key_id", req.KeyID)
+		utils.SendJSONResponse(w, false, err.Error(), result)
+		return
+	}
+
+	message := "Key installed, the host now uses it"
+	if result.AlreadyPresent {
+		message = "The key was already installed, the host now uses it"
+	}
+	utils.SendJSONResponse(w, true, message, result)
+}
+
 // AddHostHandler adds a new host.
 func (h *Handlers) AddHostHandler(w http.ResponseWriter, r *http.Request) {
 	var host models.Host
@@ -52,6 +222,30 @@ func (h *Handlers) AddHostHandler(w http.ResponseWriter, r *http.Request) {
 		host.Settings.DefaultPath = "/"
 	}
 
+	if host.JumpHostID != nil && *host.JumpHostID == 0 {
+		host.JumpHostID = nil
+	}
+	if err := h.SSHService.ValidateJumpHost(r.Context(), host.UserID, 0, host.JumpHostID); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid jump host: "+err.Error(), nil)
+		return
+	}
+	if msg := normalizeHostLabels(&host); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+	if msg := h.validateHostGroup(r.Context(), host.UserID, &host); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+	if msg := h.validateAgentKeys(r.Context(), host.UserID, &host); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
+	if host.AuthType == "interactive" {
+		host.Password = ""
+		host.KeyID = nil
+	}
 	if host.AuthType == "password" && host.Password != "" {
 		encrypted, err := encryption.Encrypt(host.Password)
 		if err != nil {
@@ -60,6 +254,10 @@ func (h *Handlers) AddHostHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		host.Password = encrypted
 	}
+	if msg := prepareTOTPSecret(&host, "", false); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
 
 	if err := h.HostRepo.Create(r.Context(), &host); err != nil {
 		utils.LogErrorf("Failed to create host", err)
@@ -67,6 +265,7 @@ func (h *Handlers) AddHostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	hideTOTPSecret(&host)
 	utils.SendJSONResponse(w, true, "Host added successfully", host)
 }
 
@@ -79,12 +278,16 @@ func (h *Handlers) EditHostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var updatedHost models.Host
-	err = json.NewDecoder(r.Body).Decode(&updatedHost)
+	var req struct {
+		models.Host
+		ClearTOTP bool `json:"clear_totp"` // Removes the stored TOTP secret
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		utils.SendJSONResponse(w, false, "Invalid request data", nil)
 		return
 	}
+	updatedHost := req.Host
 
 	session, _ := h.Store.Get(r, utils.SessionName)
 	userID := session.Values[utils.UserIDKey].(int)
@@ -95,10 +298,38 @@ func (h *Handlers) EditHostHandler(w http.ResponseWriter, r *http.Request) {
 		utils.SendJSONResponse(w, false, "Host not found", nil)
 		return
 	}
+	if !canManage(r, oldHost.UserID) {
+		utils.SendJSONResponse(w, false, "Only the owner can change a shared host", nil)
+		return
+	}
 
 	updatedHost.ID = id
-	updatedHost.UserID = userID
+	updatedHost.UserID = oldHost.UserID
 
+	if updatedHost.JumpHostID != nil && *updatedHost.JumpHostID == 0 {
+		updatedHost.JumpHostID = nil
+	}
+	if err := h.SSHService.ValidateJumpHost(r.Context(), userID, id, updatedHost.JumpHostID); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid jump host: "+err.Error(), nil)
+		return
+	}
+	if msg := normalizeHostLabels(&updatedHost); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+	if msg := h.validateHostGroup(r.Context(), userID, &updatedHost); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+	if msg := h.validateAgentKeys(r.Context(), userID, &updatedHost); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
+	if updatedHost.AuthType == "interactive" {
+		updatedHost.Password = ""
+		updatedHost.KeyID = nil
+	}
 	if updatedHost.AuthType == "password" {
 		if updatedHost.Password == "" {
 			// If you receive an empty password, leave the one that was in the database.
@@ -112,8 +343,12 @@ func (h *Handlers) EditHostHandler(w http.ResponseWriter, r *http.Request) {
 			updatedHost.Password = encrypted
 		}
 	}
+	if msg := prepareTOTPSecret(&updatedHost, oldHost.TOTPSecret, req.ClearTOTP); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
 
-	if err := h.HostRepo.Update(r.Context(), &updatedHost); err != nil {
+	if err := h.HostRepo.Update(r.Context(), &updatedHost, oldHost.UserID); err != nil {
 		utils.LogErrorf("Failed to update host", err)
 		utils.SendJSONResponse(w, false, "Failed to update host", nil)
 		return
@@ -134,7 +369,17 @@ func (h *Handlers) DeleteHostHandler(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.Store.Get(r, utils.SessionName)
 	userID := session.Values[utils.UserIDKey].(int)
 
-	err = h.HostRepo.Delete(r.Context(), id, userID)
+	host, err := h.HostRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Host not found", nil)
+		return
+	}
+	if !canManage(r, host.UserID) {
+		utils.SendJSONResponse(w, false, "Only the owner can delete a shared host", nil)
+		return
+	}
+
+	err = h.HostRepo.Delete(r.Context(), id, host.UserID)
 	if err != nil {
 		utils.SendJSONResponse(w, false, "Failed to delete host", nil)
 		return
@@ -144,3 +389,133 @@ func (h *Handlers) DeleteHostHandler(w http.ResponseWriter, r *http.Request) {
 		"id": id,
 	})
 }
+
+// validateHostGroup checks the group of the host. Everything a shared host is reached with has to be
+// shared with the same group, otherwise the other members could not connect. A personal host only uses
+// the keys of its owner, a key shared with the owner's group is not theirs to hand out. Returns the error message.
+func (h *Handlers) validateHostGroup(ctx context.Context, userID int, host *models.Host) string {
+	if host.GroupID != nil && *host.GroupID == 0 {
+		host.GroupID = nil
+	}
+	if host.GroupID == nil {
+		if host.AuthType != "password" && host.KeyID != nil && *host.KeyID != 0 {
+			key, err := h.KeyRepo.GetByID(ctx, *host.KeyID, userID)
+			if err != nil {
+				return "Key not found"
+			}
+			if key.UserID != host.UserID {
+				return "A personal host can only use your own keys"
+			}
+		}
+		return ""
+	}
+
+	member, err := h.GroupRepo.IsMember(ctx, *host.GroupID, userID)
+	if err != nil || !member {
+		return "You are not a member of the selected group"
+	}
+
+	if host.AuthType != "password" && host.KeyID != nil && *host.KeyID != 0 {
+		key, err := h.KeyRepo.GetByID(ctx, *host.KeyID, userID)
+		if err != nil {
+			return "Key not found"
+		}
+		if key.GroupID == nil || *key.GroupID != *host.GroupID {
+			return "A shared host must use a key shared with the same group"
+		}
+	}
+
+	if host.JumpHostID != nil {
+		jump, err := h.HostRepo.GetByID(ctx, *host.JumpHostID, userID)
+		if err != nil {
+			return "Jump host not found"
+		}
+		if jump.GroupID == nil || *jump.GroupID != *host.GroupID {
+			return "A shared host must use a jump host shared with the same group"
+		}
+	}
+	return ""
+}
+
+// validateAgentKeys checks the additional keys of the forwarded agent. Returns the error message.
+func (h *Handlers) validateAgentKeys(ctx context.Context, userID int, host *models.Host) string {
+	if !host.Settings.AgentForwarding {
+		host.Settings.AgentKeyIDs = nil
+		return ""
+	}
+
+	for _, keyID := range host.Settings.AgentKeyIDs {
+		key, err := h.KeyRepo.GetByID(ctx, keyID, userID)
+		if err != nil {
+			return "Agent key not found"
+		}
+		if host.GroupID == nil && key.UserID != host.UserID {
+			return "A personal host can only forward your own keys"
+		}
+		if host.GroupID != nil && (key.GroupID == nil || *key.GroupID != *host.GroupID) {
+			return "A shared host can only forward keys shared with the same group"
+		}
+	}
+	return ""
+}
+
+// prepareTOTPSecret checks and encrypts a new TOTP secret of the host. Without one the old secret is kept,
+// unless clear is set. Returns the error message.
+func prepareTOTPSecret(host *models.Host, old string, clear bool) string {
+	if host.TOTPSecret == "" {
+		if !clear {
+			host.TOTPSecret = old
+		}
+		return ""
+	}
+
+	secret, err := totp.NormalizeSecret(host.TOTPSecret)
+	if err != nil {
+		return err.Error()
+	}
+	encrypted, err := encryption.Encrypt(secret)
+	if err != nil {
+		return "Encryption failed"
+	}
+	host.TOTPSecret = encrypted
+	return ""
+}
+
+// hideTOTPSecret replaces the TOTP secret with a flag before the host is sent to the browser.
+func hideTOTPSecret(host *models.Host) {
+	host.HasTOTP = host.TOTPSecret != ""
+	host.TOTPSecret = ""
+}
+
+// normalizeHostLabels cleans up the folder and the tags of the host. Returns the error message.
+func normalizeHostLabels(host *models.Host) string {
+	host.Folder = normalizeFolder(host.Folder)
+
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, tag := range host.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength || strings.ContainsAny(tag, " ,/") {
+			return "Tags must be single words of at most 64 characters"
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	host.Tags = tags
+	return ""
+}
+
+// normalizeFolder trims the parts of a folder path and drops the empty ones, " /prod//db/" becomes "prod/db".
+func normalizeFolder(folder string) string {
+	var parts []string
+	for _, part := range strings.Split(folder, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
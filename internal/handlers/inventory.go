@@ -0,0 +1,760 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssh_manager/internal/encryption"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/repository"
+	"ssh_manager/internal/services"
+	"ssh_manager/internal/utils"
+)
+
+// maxInventorySize the largest inventory accepted for import.
+const maxInventorySize = 10 << 20
+
+// Columns of the CSV exports, the import finds the columns by these names.
+var (
+	hostCSVColumns = []string{"name", "address", "port", "username", "auth_type", "password", "key", "jump_host", "group", "folder", "tags", "default_path", "record_sessions", "agent_forwarding", "agent_keys", "totp_secret"}
+	keyCSVColumns  = []string{"name", "group", "private_key", "passphrase_mode", "passphrase"}
+)
+
+// csvListSeparator separates the tags and the agent keys in a CSV cell.
+const csvListSeparator = ";"
+
+// Results of an inventory item import.
+const (
+	inventoryOK       = "ok"
+	inventoryConflict = "conflict"
+	inventoryError    = "error"
+)
+
+// inventoryItem the result of importing one key or host.
+type inventoryItem struct {
+	Kind      string   `json:"kind"` // "key" or "host"
+	Name      string   `json:"name"`
+	Status    string   `json:"status"`
+	Conflicts []string `json:"conflicts,omitempty"` // "name" and/or "address"
+	Messages  []string `json:"messages,omitempty"`
+}
+
+// ExportInventoryHandler downloads the user's keys and hosts as JSON, or one of them as CSV.
+// Secrets are encrypted with the passphrase from the request or left out without one.
+// Only the owner of a shared key or host gets its secret.
+func (h *Handlers) ExportInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Format     string `json:"format"` // "json" or "csv"
+		Type       string `json:"type"`   // "hosts" or "keys", for CSV
+		Passphrase string `json:"passphrase"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+	if req.Format == "csv" && req.Type != "hosts" && req.Type != "keys" {
+		utils.SendJSONResponse(w, false, "Choose hosts or keys for a CSV export", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	var pc *encryption.PassphraseCipher
+	if req.Passphrase != "" {
+		if len(req.Passphrase) < 8 {
+			utils.SendJSONResponse(w, false, "The passphrase must be at least 8 characters long", nil)
+			return
+		}
+		pc = encryption.NewPassphraseCipher(req.Passphrase)
+	}
+
+	inv, err := h.buildInventory(r.Context(), userID, pc)
+	if err != nil {
+		utils.LogErrorf("Failed to export inventory", err, "user_id", userID)
+		utils.SendJSONResponse(w, false, "Failed to export", nil)
+		return
+	}
+
+	var buf bytes.Buffer
+	filename := "inventory.json"
+	contentType := "application/json"
+	switch {
+	case req.Format == "csv" && req.Type == "hosts":
+		err = writeHostsCSV(&buf, inv.Hosts)
+		filename, contentType = "hosts.csv", "text/csv"
+	case req.Format == "csv":
+		err = writeKeysCSV(&buf, inv.Keys)
+		filename, contentType = "keys.csv", "text/csv"
+	default:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(inv)
+	}
+	if err != nil {
+		utils.LogErrorf("Failed to write inventory", err, "user_id", userID)
+		utils.SendJSONResponse(w, false, "Failed to export", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Write(buf.Bytes())
+}
+
+// ImportInventoryHandler imports keys and hosts from a JSON inventory or a CSV of hosts or keys.
+// Items whose name or address is already taken are reported as conflicts and skipped.
+// With dry_run nothing is saved, the report shows what would happen.
+func (h *Handlers) ImportInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Data       string `json:"data"`
+		Passphrase string `json:"passphrase"`
+		DryRun     bool   `json:"dry_run"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInventorySize)).Decode(&req); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	inv, err := parseInventory(req.Data)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid inventory: "+err.Error(), nil)
+		return
+	}
+
+	plan, err := h.planInventory(r.Context(), userID, inv, req.Passphrase)
+	if err != nil {
+		if importRefused(err) {
+			utils.SendJSONResponse(w, false, err.Error(), nil)
+			return
+		}
+		utils.LogErrorf("Failed to plan inventory import", err, "user_id", userID)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	if !req.DryRun {
+		if err := h.applyInventory(r.Context(), userID, plan); err != nil {
+			utils.LogErrorf("Failed to import inventory", err, "user_id", userID)
+			utils.SendJSONResponse(w, false, "Failed to save the import, nothing was imported", nil)
+			return
+		}
+	}
+
+	counts := map[string]int{}
+	for _, item := range plan.items {
+		counts[item.Status]++
+	}
+	message := fmt.Sprintf("%d to import, %d conflicts, %d errors", counts[inventoryOK], counts[inventoryConflict], counts[inventoryError])
+	if !req.DryRun {
+		message = fmt.Sprintf("%d imported, %d conflicts skipped, %d errors", counts[inventoryOK], counts[inventoryConflict], counts[inventoryError])
+	}
+
+	utils.SendJSONResponse(w, true, message, map[string]interface{}{
+		"dry_run": req.DryRun,
+		"items":   plan.items,
+	})
+}
+
+// buildInventory collects the user's keys and hosts, secrets are encrypted with pc or left out if it is nil.
+func (h *Handlers) buildInventory(ctx context.Context, userID int, pc *encryption.PassphraseCipher) (*models.Inventory, error) {
+	inv := &models.Inventory{Version: 1, ExportedAt: time.Now().UTC(), Secrets: models.SecretsOmitted, Keys: []models.InventoryKey{}, Hosts: []models.InventoryHost{}}
+	if pc != nil {
+		inv.Secrets = models.SecretsPassphrase
+	}
+
+	// secret decrypts a stored value and encrypts it with the passphrase
+	secret := func(stored string) (string, error) {
+		if pc == nil || stored == "" {
+			return "", nil
+		}
+		plain, err := encryption.Decrypt(stored)
+		if err != nil {
+			return "", err
+		}
+		return pc.Encrypt(plain)
+	}
+
+	keys, err := h.KeyRepo.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keyNames := make(map[int]string)
+	for _, k := range keys {
+		keyNames[k.ID] = k.Name
+		ik := models.InventoryKey{Name: k.Name, Group: k.GroupName, PassphraseMode: k.PassphraseMode}
+		if k.UserID == userID {
+			full, err := h.KeyRepo.GetByID(ctx, k.ID, userID)
+			if err != nil {
+				return nil, err
+			}
+			if ik.PrivateKey, err = secret(full.KeyData); err != nil {
+				return nil, fmt.Errorf("key %d: %w", k.ID, err)
+			}
+			if ik.Passphrase, err = secret(full.Passphrase); err != nil {
+				return nil, fmt.Errorf("key %d: %w", k.ID, err)
+			}
+		}
+		inv.Keys = append(inv.Keys, ik)
+	}
+
+	hosts, err := h.HostRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	hostNames := make(map[int]string)
+	for _, host := range hosts {
+		hostNames[host.ID] = host.Name
+	}
+	for _, host := range hosts {
+		ih := models.InventoryHost{
+			Name:            host.Name,
+			Address:         host.Address,
+			Port:            host.Port,
+			Username:        host.Username,
+			AuthType:        host.AuthType,
+			Group:           host.GroupName,
+			Folder:          host.Folder,
+			Tags:            host.Tags,
+			DefaultPath:     host.Settings.DefaultPath,
+			RecordSessions:  host.Settings.RecordSessions,
+			AgentForwarding: host.Settings.AgentForwarding,
+		}
+		if host.KeyID != nil {
+			ih.Key = keyNames[*host.KeyID]
+		}
+		if host.JumpHostID != nil {
+			ih.JumpHost = hostNames[*host.JumpHostID]
+		}
+		for _, id := range host.Settings.AgentKeyIDs {
+			if name, ok := keyNames[id]; ok {
+				ih.AgentKeys = append(ih.AgentKeys, name)
+			}
+		}
+		if host.AuthType == "password" && host.UserID == userID {
+			if ih.Password, err = secret(host.Password); err != nil {
+				return nil, fmt.Errorf("host %d: %w", host.ID, err)
+			}
+		}
+		if host.TOTPSecret != "" && host.UserID == userID {
+			if ih.TOTPSecret, err = secret(host.TOTPSecret); err != nil {
+				return nil, fmt.Errorf("host %d: %w", host.ID, err)
+			}
+		}
+		inv.Hosts = append(inv.Hosts, ih)
+	}
+	return inv, nil
+}
+
+// writeHostsCSV writes the hosts with hostCSVColumns.
+func writeHostsCSV(w io.Writer, hosts []models.InventoryHost) error {
+	cw := csv.NewWriter(w)
+	cw.Write(hostCSVColumns)
+	for _, host := range hosts {
+		cw.Write([]string{
+			host.Name, host.Address, strconv.Itoa(host.Port), host.Username, host.AuthType, host.Password,
+			host.Key, host.JumpHost, host.Group, host.Folder, strings.Join(host.Tags, csvListSeparator), host.DefaultPath,
+			strconv.FormatBool(host.RecordSessions), strconv.FormatBool(host.AgentForwarding), strings.Join(host.AgentKeys, csvListSeparator),
+			host.TOTPSecret,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeKeysCSV writes the keys with keyCSVColumns.
+func writeKeysCSV(w io.Writer, keys []models.InventoryKey) error {
+	cw := csv.NewWriter(w)
+	cw.Write(keyCSVColumns)
+	for _, key := range keys {
+		cw.Write([]string{key.Name, key.Group, key.PrivateKey, key.PassphraseMode, key.Passphrase})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseInventory reads a JSON inventory or a CSV of hosts or keys, told apart by the header.
+func parseInventory(data string) (*models.Inventory, error) {
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "{") {
+		var inv models.Inventory
+		if err := json.Unmarshal([]byte(data), &inv); err != nil {
+			return nil, err
+		}
+		return &inv, nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	get := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	list := func(value string) []string {
+		var items []string
+		for _, item := range strings.Split(value, csvListSeparator) {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+
+	inv := &models.Inventory{}
+	_, hasAddress := columns["address"]
+	_, hasPrivateKey := columns["private_key"]
+	switch {
+	case hasAddress:
+		for _, record := range records[1:] {
+			port, _ := strconv.Atoi(get(record, "port"))
+			recordSessions, _ := strconv.ParseBool(get(record, "record_sessions"))
+			agentForwarding, _ := strconv.ParseBool(get(record, "agent_forwarding"))
+			inv.Hosts = append(inv.Hosts, models.InventoryHost{
+				Name: get(record, "name"), Address: get(record, "address"), Port: port, Username: get(record, "username"),
+				AuthType: get(record, "auth_type"), Password: get(record, "password"), Key: get(record, "key"),
+				JumpHost: get(record, "jump_host"), Group: get(record, "group"), Folder: get(record, "folder"),
+				Tags: list(get(record, "tags")), DefaultPath: get(record, "default_path"),
+				RecordSessions: recordSessions, AgentForwarding: agentForwarding, AgentKeys: list(get(record, "agent_keys")),
+				TOTPSecret: get(record, "totp_secret"),
+			})
+		}
+	case hasPrivateKey:
+		for _, record := range records[1:] {
+			inv.Keys = append(inv.Keys, models.InventoryKey{
+				Name: get(record, "name"), Group: get(record, "group"), PrivateKey: get(record, "private_key"),
+				PassphraseMode: get(record, "passphrase_mode"), Passphrase: get(record, "passphrase"),
+			})
+		}
+	default:
+		return nil, errors.New("the CSV header has neither an address nor a private_key column")
+	}
+
+	// A CSV says nothing about its secrets, they tell themselves
+	inv.Secrets = models.SecretsOmitted
+	if inventorySecret(inv) != "" {
+		inv.Secrets = models.SecretsPassphrase
+	}
+	return inv, nil
+}
+
+// errPassphraseRequired is returned when the secrets of an import are encrypted but no passphrase was given.
+var errPassphraseRequired = errors.New("the secrets are encrypted, enter the passphrase of the export")
+
+// importRefused reports whether the secrets cannot be decrypted at all, which fails the whole import.
+func importRefused(err error) bool {
+	return errors.Is(err, encryption.ErrWrongPassphrase) || errors.Is(err, encryption.ErrMixedSalts) || errors.Is(err, errPassphraseRequired)
+}
+
+// plannedKey a key that is going to be created.
+type plannedKey struct {
+	item *inventoryItem
+	key  models.Key
+}
+
+// plannedHost a host that is going to be created, the jump host and agent keys are set once everything exists.
+type plannedHost struct {
+	item      *inventoryItem
+	host      models.Host
+	keyName   string // Key created by the same import
+	jumpHost  string
+	agentKeys []string
+}
+
+// inventoryPlan what an import is going to create.
+type inventoryPlan struct {
+	items []*inventoryItem
+	keys  []*plannedKey
+	hosts []*plannedHost
+}
+
+// inventoryRef an existing or planned key or host an imported host can refer to.
+type inventoryRef struct {
+	id      int  // 0 while it is only planned
+	groupID *int // Group it is shared with
+	ownerID int  // 0 for a shared key whose owner was deleted
+}
+
+// planInventory checks the inventory against the user's keys and hosts. Secrets are decrypted with the
+// passphrase and encrypted with the server key.
+func (h *Handlers) planInventory(ctx context.Context, userID int, inv *models.Inventory, passphrase string) (*inventoryPlan, error) {
+	plan := &inventoryPlan{}
+	pc := encryption.NewPassphraseCipher(passphrase)
+
+	// The passphrase is checked up front, items that conflict would not reveal a wrong one
+	if sample := inventorySecret(inv); sample != "" {
+		if passphrase == "" {
+			return nil, errPassphraseRequired
+		}
+		if _, err := pc.Decrypt(sample); err != nil {
+			return nil, err
+		}
+	}
+
+	// decrypt returns the plain text of a secret of the inventory
+	decrypt := func(value string) (string, error) {
+		if value == "" {
+			return "", nil
+		}
+		if !encryption.IsPassphraseEncrypted(value) {
+			return "", errors.New("the secret is not encrypted with a passphrase, plain secrets are not imported")
+		}
+		if passphrase == "" {
+			return "", errPassphraseRequired
+		}
+		return pc.Decrypt(value)
+	}
+	// reencrypt turns a secret of the inventory into a stored one
+	reencrypt := func(value string) (string, error) {
+		plain, err := decrypt(value)
+		if err != nil || plain == "" {
+			return "", err
+		}
+		return encryption.Encrypt(plain)
+	}
+
+	groups, err := h.GroupRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	groupIDs := make(map[string]int)
+	for _, g := range groups {
+		groupIDs[strings.ToLower(g.Name)] = g.ID
+	}
+	// group resolves a group name, the item stays personal if the user is not a member of such a group
+	group := func(item *inventoryItem, name string) *int {
+		if name == "" {
+			return nil
+		}
+		id, ok := groupIDs[strings.ToLower(name)]
+		if !ok {
+			item.Messages = append(item.Messages, fmt.Sprintf("you are not a member of a group %s, it is imported as personal", name))
+			return nil
+		}
+		return &id
+	}
+
+	existingKeys, err := h.KeyRepo.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*inventoryRef)
+	for _, k := range existingKeys {
+		keys[strings.ToLower(k.Name)] = &inventoryRef{id: k.ID, groupID: k.GroupID, ownerID: k.UserID}
+	}
+
+	for _, ik := range inv.Keys {
+		item := &inventoryItem{Kind: "key", Name: ik.Name, Status: inventoryOK}
+		plan.items = append(plan.items, item)
+
+		switch {
+		case strings.TrimSpace(ik.Name) == "":
+			item.Status = inventoryError
+			item.Messages = append(item.Messages, "the name is empty")
+			continue
+		case keys[strings.ToLower(ik.Name)] != nil:
+			item.Status = inventoryConflict
+			item.Conflicts = append(item.Conflicts, "name")
+			continue
+		case ik.PrivateKey == "":
+			item.Status = inventoryError
+			item.Messages = append(item.Messages, "the private key was left out of the export")
+			continue
+		}
+
+		privateKey, err := decrypt(ik.PrivateKey)
+		if importRefused(err) {
+			return nil, err
+		}
+		if err != nil {
+			item.Status = inventoryError
+			item.Messages = append(item.Messages, err.Error())
+			continue
+		}
+
+		// The key is parsed like a new one, so a broken key or a wrong passphrase is reported before anything is saved
+		keyPassphrase, mode := "", models.PassphrasePrompt
+		if ik.PassphraseMode == models.PassphraseStored && ik.Passphrase == "" {
+			item.Messages = append(item.Messages, "the key passphrase was left out of the export, it is asked for when connecting")
+		} else if ik.PassphraseMode == models.PassphraseStored {
+			keyPassphrase, err = decrypt(ik.Passphrase)
+			if err != nil {
+				item.Status = inventoryError
+				item.Messages = append(item.Messages, err.Error())
+				continue
+			}
+			mode = models.PassphraseStored
+		}
+
+		pk := &plannedKey{item: item, key: models.Key{UserID: userID, Name: ik.Name}}
+		if msg := preparePrivateKey(&pk.key, privateKey, keyPassphrase, mode); msg != "" {
+			item.Status = inventoryError
+			item.Messages = append(item.Messages, msg)
+			continue
+		}
+		pk.key.KeyData, err = encryption.Encrypt(privateKey)
+		if err != nil {
+			item.Status = inventoryError
+			item.Messages = append(item.Messages, "Encryption error")
+			continue
+		}
+		pk.key.GroupID = group(item, ik.Group)
+		plan.keys = append(plan.keys, pk)
+		keys[strings.ToLower(ik.Name)] = &inventoryRef{groupID: pk.key.GroupID, ownerID: userID}
+	}
+
+	existingHosts, err := h.HostRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]*inventoryRef)
+	addresses := make(map[string]string) // "address:port" to the host name
+	for _, host := range existingHosts {
+		hosts[strings.ToLower(host.Name)] = &inventoryRef{id: host.ID, groupID: host.GroupID}
+		addresses[hostAddress(host.Address, host.Port)] = host.Name
+	}
+
+	// Jump hosts may come later in the file, so every name is known before they are checked
+	for _, ih := range inv.Hosts {
+		item := &inventoryItem{Kind: "host", Name: ih.Name, Status: inventoryOK}
+		plan.items = append(plan.items, item)
+
+		if ih.Port == 0 {
+			ih.Port = 22
+		}
+		if strings.TrimSpace(ih.Name) == "" || strings.TrimSpace(ih.Address) == "" || strings.TrimSpace(ih.Username) == "" {
+			item.Status = inventoryError
+			item.Messages = append(item.Messages, "name, address and username are required")
+			continue
+		}
+		if hosts[strings.ToLower(ih.Name)] != nil {
+			item.Status = inventoryConflict
+			item.Conflicts = append(item.Conflicts, "name")
+		}
+		if other, ok := addresses[hostAddress(ih.Address, ih.Port)]; ok {
+			item.Status = inventoryConflict
+			item.Conflicts = append(item.Conflicts, "address")
+			item.Messages = append(item.Messages, fmt.Sprintf("%s:%d is already used by %s", ih.Address, ih.Port, other))
+		}
+		if item.Status == inventoryConflict {
+			continue
+		}
+
+		ph := &plannedHost{item: item, jumpHost: ih.JumpHost, agentKeys: ih.AgentKeys}
+		ph.host = models.Host{
+			UserID:   userID,
+			Name:     ih.Name,
+			Address:  ih.Address,
+			Port:     ih.Port,
+			Username: ih.Username,
+			AuthType: ih.AuthType,
+			Folder:   ih.Folder,
+			Tags:     ih.Tags,
+			Settings: models.HostSettings{
+				DefaultPath:     ih.DefaultPath,
+				RecordSessions:  ih.RecordSessions,
+				AgentForwarding: ih.AgentForwarding,
+			},
+		}
+		if ph.host.Settings.DefaultPath == "" {
+			ph.host.Settings.DefaultPath = "/"
+		}
+		if msg := normalizeHostLabels(&ph.host); msg != "" {
+			item.Status = inventoryError
+			item.Messages = append(item.Messages, msg)
+			continue
+		}
+
+		if ph.host.AuthType == "password" {
+			password, err := reencrypt(ih.Password)
+			if importRefused(err) {
+				return nil, err
+			}
+			if err != nil {
+				item.Status = inventoryError
+				item.Messages = append(item.Messages, err.Error())
+				continue
+			}
+			if password == "" {
+				item.Messages = append(item.Messages, "the password was left out of the export, set it before connecting")
+			}
+			ph.host.Password = password
+		} else if ph.host.AuthType != "interactive" {
+			ph.host.AuthType = "key"
+			ref := keys[strings.ToLower(ih.Key)]
+			if ref == nil {
+				item.Status = inventoryError
+				item.Messages = append(item.Messages, fmt.Sprintf("key %q is neither stored nor in the import", ih.Key))
+				continue
+			}
+			// The imported hosts are personal, they cannot use what other members shared with the group
+			if ref.ownerID != userID {
+				item.Status = inventoryError
+				item.Messages = append(item.Messages, fmt.Sprintf("key %q belongs to another user", ih.Key))
+				continue
+			}
+			ph.keyName = ih.Key
+		}
+
+		totpSecret, err := reencrypt(ih.TOTPSecret)
+		if importRefused(err) {
+			return nil, err
+		}
+		if err != nil {
+			item.Status = inventoryError
+			item.Messages = append(item.Messages, "TOTP secret: "+err.Error())
+			continue
+		}
+		ph.host.TOTPSecret = totpSecret
+
+		ph.host.GroupID = group(item, ih.Group)
+		plan.hosts = append(plan.hosts, ph)
+		hosts[strings.ToLower(ih.Name)] = &inventoryRef{groupID: ph.host.GroupID}
+		addresses[hostAddress(ih.Address, ih.Port)] = ih.Name
+	}
+
+	// A shared host can only use what is shared with the same group, otherwise it stays personal
+	sameGroup := func(a, b *int) bool { return a != nil && b != nil && *a == *b }
+	for _, ph := range plan.hosts {
+		if ph.jumpHost != "" && hosts[strings.ToLower(ph.jumpHost)] == nil {
+			ph.item.Messages = append(ph.item.Messages, fmt.Sprintf("jump host %s is neither stored nor in the import and is left out", ph.jumpHost))
+			ph.jumpHost = ""
+		}
+		if ph.host.GroupID == nil {
+			continue
+		}
+		if (ph.keyName != "" && !sameGroup(keys[strings.ToLower(ph.keyName)].groupID, ph.host.GroupID)) ||
+			(ph.jumpHost != "" && !sameGroup(hosts[strings.ToLower(ph.jumpHost)].groupID, ph.host.GroupID)) {
+			ph.item.Messages = append(ph.item.Messages, "its key or jump host is not shared with the same group, it is imported as personal")
+			ph.host.GroupID = nil
+			hosts[strings.ToLower(ph.host.Name)].groupID = nil
+		}
+	}
+	return plan, nil
+}
+
+// applyInventory creates the planned keys and hosts in one transaction, nothing is saved if the database fails.
+// Items whose references cannot be resolved get a message.
+func (h *Handlers) applyInventory(ctx context.Context, userID int, plan *inventoryPlan) error {
+	return repository.WithTx(ctx, h.KeyRepo.DB, func(db repository.DBTX) error {
+		// The handlers of the transaction, the jump hosts are checked against the hosts created in it
+		hostRepo := &repository.HostRepository{DB: db}
+		tx := &Handlers{KeyRepo: &repository.KeyRepository{DB: db}, HostRepo: hostRepo, SSHService: &services.SSHService{HostRepo: hostRepo}}
+
+		for _, pk := range plan.keys {
+			if err := tx.KeyRepo.Create(ctx, &pk.key); err != nil {
+				return fmt.Errorf("key %s: %w", pk.key.Name, err)
+			}
+		}
+
+		// IDs of everything the hosts can refer to, including what was just created
+		keys, err := tx.KeyRepo.GetAllByUserID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		keyIDs := make(map[string]int)
+		for _, k := range keys {
+			keyIDs[strings.ToLower(k.Name)] = k.ID
+		}
+
+		for _, ph := range plan.hosts {
+			if ph.keyName != "" {
+				keyID, ok := keyIDs[strings.ToLower(ph.keyName)]
+				if !ok {
+					ph.item.Status = inventoryError
+					ph.item.Messages = append(ph.item.Messages, fmt.Sprintf("key %q was not imported", ph.keyName))
+					continue
+				}
+				ph.host.KeyID = &keyID
+			}
+			if ph.host.Settings.AgentForwarding {
+				for _, name := range ph.agentKeys {
+					if keyID, ok := keyIDs[strings.ToLower(name)]; ok {
+						ph.host.Settings.AgentKeyIDs = append(ph.host.Settings.AgentKeyIDs, keyID)
+					}
+				}
+				if msg := tx.validateAgentKeys(ctx, userID, &ph.host); msg != "" {
+					ph.item.Messages = append(ph.item.Messages, msg+", agent keys are left out")
+					ph.host.Settings.AgentKeyIDs = nil
+				}
+			}
+			if err := tx.HostRepo.Create(ctx, &ph.host); err != nil {
+				return fmt.Errorf("host %s: %w", ph.host.Name, err)
+			}
+		}
+
+		hosts, err := tx.HostRepo.GetByUserID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		hostIDs := make(map[string]int)
+		for _, host := range hosts {
+			hostIDs[strings.ToLower(host.Name)] = host.ID
+		}
+		for _, ph := range plan.hosts {
+			if ph.host.ID == 0 || ph.jumpHost == "" {
+				continue
+			}
+			jumpID, ok := hostIDs[strings.ToLower(ph.jumpHost)]
+			if !ok {
+				ph.item.Messages = append(ph.item.Messages, fmt.Sprintf("jump host %s was not imported", ph.jumpHost))
+				continue
+			}
+			if err := tx.SSHService.ValidateJumpHost(ctx, userID, ph.host.ID, &jumpID); err != nil {
+				ph.item.Messages = append(ph.item.Messages, fmt.Sprintf("jump host %s: %v", ph.jumpHost, err))
+				continue
+			}
+			ph.host.JumpHostID = &jumpID
+			if err := tx.HostRepo.Update(ctx, &ph.host, userID); err != nil {
+				return fmt.Errorf("host %s: %w", ph.host.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// inventorySecret returns the first passphrase encrypted secret of the inventory.
+func inventorySecret(inv *models.Inventory) string {
+	for _, key := range inv.Keys {
+		if encryption.IsPassphraseEncrypted(key.PrivateKey) {
+			return key.PrivateKey
+		}
+	}
+	for _, host := range inv.Hosts {
+		if encryption.IsPassphraseEncrypted(host.Password) {
+			return host.Password
+		}
+		if encryption.IsPassphraseEncrypted(host.TOTPSecret) {
+			return host.TOTPSecret
+		}
+	}
+	return ""
+}
+
+// hostAddress the key hosts are compared by when looking for address conflicts.
+func hostAddress(address string, port int) string {
+	return fmt.Sprintf("%s:%d", strings.ToLower(strings.TrimSpace(address)), port)
+}
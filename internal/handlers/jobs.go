@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/repository"
+	"ssh_manager/internal/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Limits of a batch run.
+const (
+	defaultJobParallelism = 5
+	maxJobParallelism     = 50
+	defaultJobTimeout     = 60   // seconds
+	maxJobTimeout         = 3600 // seconds
+)
+
+// JobsHandler displays the page for running commands on many hosts with the job history.
+func (h *Handlers) JobsHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	hosts, err := h.HostRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] JobsHandler - GetByUserID (userID: %d): %v", userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	jobs, err := h.JobRepo.List(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] JobsHandler - List (userID: %d): %v", userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	tags, err := h.HostRepo.GetTags(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] JobsHandler - GetTags (userID: %d): %v", userID, err)
+	}
+
+	utils.RenderTemplate(w, "jobs.html", map[string]interface{}{
+		"Title":    "Batch Commands",
+		"ShowMenu": true,
+		"Hosts":    hosts,
+		"Tags":     tags,
+		"Jobs":     jobs,
+	}, r)
+}
+
+// ListJobsHandler returns the user's job history.
+func (h *Handlers) ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	jobs, err := h.JobRepo.List(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] ListJobsHandler (userID: %d): %v", userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Jobs retrieved successfully", jobs)
+}
+
+// GetJobHandler returns a job with the output of every host.
+func (h *Handlers) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid job ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	job, err := h.JobRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Job not found", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Job retrieved successfully", job)
+}
+
+// RunJobHandler starts a command on the selected hosts. The results are followed with JobEventsHandler.
+func (h *Handlers) RunJobHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		HostIDs        []int  `json:"host_ids"`
+		Tag            string `json:"tag"` // Adds all hosts with the tag
+		Command        string `json:"command"`
+		Parallelism    int    `json:"parallelism"`
+		TimeoutSeconds int    `json:"timeout_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	if strings.TrimSpace(requestData.Command) == "" {
+		utils.SendJSONResponse(w, false, "Command is required", nil)
+		return
+	}
+	if requestData.Parallelism <= 0 {
+		requestData.Parallelism = defaultJobParallelism
+	}
+	if requestData.TimeoutSeconds <= 0 {
+		requestData.TimeoutSeconds = defaultJobTimeout
+	}
+	if requestData.Parallelism > maxJobParallelism || requestData.TimeoutSeconds > maxJobTimeout {
+		utils.SendJSONResponse(w, false, fmt.Sprintf("Parallelism is limited to %d and the timeout to %d seconds", maxJobParallelism, maxJobTimeout), nil)
+		return
+	}
+
+	job := &models.Job{
+		UserID:         userID,
+		Command:        requestData.Command,
+		Parallelism:    requestData.Parallelism,
+		TimeoutSeconds: requestData.TimeoutSeconds,
+	}
+	if tag := strings.ToLower(strings.TrimSpace(requestData.Tag)); tag != "" {
+		tagged, _, err := h.HostRepo.Search(r.Context(), userID, repository.HostFilter{Tag: tag})
+		if err != nil {
+			log.Printf("[ERROR] RunJobHandler - Search (userID: %d, tag: %s): %v", userID, tag, err)
+			utils.SendJSONResponse(w, false, "Database error", nil)
+			return
+		}
+		for _, host := range tagged {
+			requestData.HostIDs = append(requestData.HostIDs, host.ID)
+		}
+	}
+
+	seen := make(map[int]bool)
+	for _, hostID := range requestData.HostIDs {
+		if seen[hostID] {
+			continue
+		}
+		seen[hostID] = true
+
+		host, err := h.HostRepo.GetByID(r.Context(), hostID, userID)
+		if err != nil {
+			utils.SendJSONResponse(w, false, fmt.Sprintf("Host %d not found", hostID), nil)
+			return
+		}
+		job.Results = append(job.Results, models.JobResult{HostID: host.ID, HostName: host.Name})
+	}
+	if len(job.Results) == 0 {
+		utils.SendJSONResponse(w, false, "Select at least one host or a tag with hosts", nil)
+		return
+	}
+
+	if err := h.JobService.Start(r.Context(), job); err != nil {
+		log.Printf("[ERROR] JobService.Start (userID: %d): %v", userID, err)
+		utils.SendJSONResponse(w, false, "Failed to start job", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Job started successfully", job)
+}
+
+// JobEventsHandler streams the progress of a job as server-sent events: "job" with the current state first,
+// then "result" whenever a host changes, and "done" with the final state.
+func (h *Handlers) JobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Watching first and reading the state afterwards, so that no update falls in between
+	updates, unwatch, running := h.JobService.Watch(id)
+	if running {
+		defer unwatch()
+	}
+
+	job, err := h.JobRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	if !running {
+		writeEvent(w, "done", job)
+		flusher.Flush()
+		return
+	}
+	writeEvent(w, "job", job)
+	flusher.Flush()
+
+	for {
+		select {
+		case res, ok := <-updates:
+			if !ok {
+				// Finished, the final state also covers the updates a slow client may have missed
+				job, err := h.JobRepo.GetByID(r.Context(), id, userID)
+				if err != nil {
+					return
+				}
+				writeEvent(w, "done", job)
+				flusher.Flush()
+				return
+			}
+			writeEvent(w, "result", res)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes a server-sent event with a JSON payload.
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("[ERROR] writeEvent (%s): %v", event, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
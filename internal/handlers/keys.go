@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"ssh_manager/internal/encryption"
 	"ssh_manager/internal/models"
+	"ssh_manager/internal/sshkeys"
 	"ssh_manager/internal/utils"
 	"strconv"
 	"strings"
@@ -13,6 +16,10 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// sharedKeyMask is shown instead of a shared key to the members who do not own it.
+// It contains "..." so that saving the form keeps the stored key.
+const sharedKeyMask = "...... (shared key, private key is visible to its owner only) ......"
+
 // KeysHandler displaying a page with keys.
 func (h *Handlers) KeysHandler(w http.ResponseWriter, r *http.Request) {
 	sesion, _ := h.Store.Get(r, utils.SessionName)
@@ -25,9 +32,16 @@ func (h *Handlers) KeysHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	groups, err := h.GroupRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] KeysHandler - GroupRepo.GetByUserID: %v", err)
+	}
+
 	utils.RenderTemplate(w, "keys.html", map[string]interface{}{
 		"Title":    "Keys",
 		"Keys":     keys,
+		"Groups":   groups,
+		"UserID":   userID,
 		"ShowMenu": true,
 	}, r)
 }
@@ -65,6 +79,15 @@ func (h *Handlers) GetKeyDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Members of the group can use a shared key, but only its owner sees it
+	if key.UserID != userID {
+		key.KeyData = sharedKeyMask
+		key.Passphrase = ""
+		utils.SendJSONResponse(w, true, "", key)
+		return
+	}
+
+	key.Passphrase = ""
 	decrypted, _ := encryption.Decrypt(key.KeyData)
 	key.KeyData = utils.FormatPartialKey(decrypted)
 
@@ -95,6 +118,16 @@ func (h *Handlers) AddKeyHandler(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.Store.Get(r, utils.SessionName)
 	key.UserID = session.Values[utils.UserIDKey].(int)
 
+	if msg := h.validateKeyGroup(r.Context(), key.UserID, &key); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
+	if msg := preparePrivateKey(&key, trimmedKeyData, key.Passphrase, key.PassphraseMode); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
 	// Encrypting a private key
 	encrypted, _ := encryption.Encrypt(trimmedKeyData)
 	key.KeyData = encrypted
@@ -104,6 +137,7 @@ func (h *Handlers) AddKeyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	key.Passphrase = ""
 	utils.SendJSONResponse(w, true, "Key added successfully", key)
 }
 
@@ -131,30 +165,64 @@ func (h *Handlers) EditKeyHandler(w http.ResponseWriter, r *http.Request) {
 		utils.SendJSONResponse(w, false, "Key not found", nil)
 		return
 	}
+	if !canManage(r, oldKey.UserID) {
+		utils.SendJSONResponse(w, false, "Only the owner can change a shared key", nil)
+		return
+	}
+
+	if msg := h.validateKeyGroup(r.Context(), userID, &key); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
 
-	updatedKeyData := oldKey.KeyData
+	keyToUpdate := &models.Key{
+		ID:             id,
+		UserID:         oldKey.UserID,
+		Name:           key.Name,
+		KeyData:        oldKey.KeyData,
+		PublicKey:      oldKey.PublicKey,
+		Fingerprint:    oldKey.Fingerprint,
+		KeyType:        oldKey.KeyType,
+		Passphrase:     oldKey.Passphrase,
+		PassphraseMode: oldKey.PassphraseMode,
+		GroupID:        key.GroupID,
+	}
 	trimmedKeyData := strings.TrimSpace(key.KeyData)
+	if trimmedKeyData == "" {
+		utils.SendJSONResponse(w, false, "Private key cannot be empty", nil)
+		return
+	}
+
+	// The key is checked again when it, its passphrase or the way the passphrase is kept changes
+	keyChanged := !strings.Contains(trimmedKeyData, "...")
+	if keyChanged || key.Passphrase != "" || (key.PassphraseMode != "" && key.PassphraseMode != oldKey.PassphraseMode) {
+		privateKey := trimmedKeyData
+		if !keyChanged {
+			if privateKey, err = encryption.Decrypt(oldKey.KeyData); err != nil {
+				utils.SendJSONResponse(w, false, "Encryption error", nil)
+				return
+			}
+		}
+
+		passphrase := key.Passphrase
+		if passphrase == "" && !keyChanged && oldKey.PassphraseMode == models.PassphraseStored {
+			passphrase, _ = encryption.Decrypt(oldKey.Passphrase)
+		}
+
+		if msg := preparePrivateKey(keyToUpdate, privateKey, passphrase, key.PassphraseMode); msg != "" {
+			utils.SendJSONResponse(w, false, msg, nil)
+			return
+		}
 
-	if !strings.Contains(trimmedKeyData, "...") && trimmedKeyData != "" {
-		encrypted, err := encryption.Encrypt(trimmedKeyData)
+		encrypted, err := encryption.Encrypt(privateKey)
 		if err != nil {
 			utils.SendJSONResponse(w, false, "Encryption error", nil)
 			return
 		}
-		updatedKeyData = encrypted
-	} else if trimmedKeyData == "" {
-		utils.SendJSONResponse(w, false, "Private key cannot be empty", nil)
-		return
+		keyToUpdate.KeyData = encrypted
 	}
 
-	keyToUpdate := &models.Key{
-		ID:      id,
-		UserID:  userID,
-		Name:    key.Name,
-		KeyData: updatedKeyData,
-	}
-
-	if err := h.KeyRepo.Update(r.Context(), keyToUpdate); err != nil {
+	if err := h.KeyRepo.Update(r.Context(), keyToUpdate, oldKey.UserID); err != nil {
 		log.Printf("[ERROR] KeyRepo.Update: %v", err)
 		utils.SendJSONResponse(w, false, "Database error", nil)
 		return
@@ -166,6 +234,59 @@ func (h *Handlers) EditKeyHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GenerateKeyHandler creates a new key pair on the server and returns its authorized_keys line.
+// The private key is only stored, it never leaves the server.
+func (h *Handlers) GenerateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name    string `json:"name"`
+		Type    string `json:"type"` // ed25519, ecdsa or rsa
+		Bits    int    `json:"bits,string"`
+		Comment string `json:"comment"`
+		GroupID *int   `json:"group_id,string"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		utils.SendJSONResponse(w, false, "Name cannot be empty", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	key := models.Key{UserID: session.Values[utils.UserIDKey].(int), Name: req.Name, GroupID: req.GroupID}
+
+	if msg := h.validateKeyGroup(r.Context(), key.UserID, &key); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
+	privateKey, info, err := sshkeys.Generate(req.Type, req.Bits, strings.TrimSpace(req.Comment))
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Cannot generate the key: "+err.Error(), nil)
+		return
+	}
+	key.PublicKey, key.Fingerprint, key.KeyType = info.PublicKey, info.Fingerprint, info.Type
+
+	encrypted, err := encryption.Encrypt(privateKey)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Encryption error", nil)
+		return
+	}
+	key.KeyData = encrypted
+
+	if err := h.KeyRepo.Create(r.Context(), &key); err != nil {
+		log.Printf("[ERROR] KeyRepo.Create: %v", err)
+		utils.SendJSONResponse(w, false, "DB Error", nil)
+		return
+	}
+
+	key.KeyData = ""
+	utils.SendJSONResponse(w, true, "Key generated successfully", key)
+}
+
 // DeleteKeyHandler deletes the key.
 func (h *Handlers) DeleteKeyHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -178,7 +299,17 @@ func (h *Handlers) DeleteKeyHandler(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.Store.Get(r, utils.SessionName)
 	userID := session.Values[utils.UserIDKey].(int)
 
-	if err := h.KeyRepo.Delete(r.Context(), id, userID); err != nil {
+	key, err := h.KeyRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Key not found", nil)
+		return
+	}
+	if !canManage(r, key.UserID) {
+		utils.SendJSONResponse(w, false, "Only the owner can delete a shared key", nil)
+		return
+	}
+
+	if err := h.KeyRepo.Delete(r.Context(), id, key.UserID); err != nil {
 		log.Printf("[ERROR] KeyRepo.Delete (ID: %d, User: %d): %v", id, userID, err)
 		utils.SendJSONResponse(w, false, "Database error", nil)
 		return
@@ -188,3 +319,58 @@ func (h *Handlers) DeleteKeyHandler(w http.ResponseWriter, r *http.Request) {
 		"id": id,
 	})
 }
+
+// validateKeyGroup checks that the user is a member of the group the key is shared with. Returns the error message.
+func (h *Handlers) validateKeyGroup(ctx context.Context, userID int, key *models.Key) string {
+	if key.GroupID != nil && *key.GroupID == 0 {
+		key.GroupID = nil
+	}
+	if key.GroupID == nil {
+		return ""
+	}
+
+	member, err := h.GroupRepo.IsMember(ctx, *key.GroupID, userID)
+	if err != nil || !member {
+		return "You are not a member of the selected group"
+	}
+	return ""
+}
+
+// setPublicKey fills in the public half of the private key, it stays empty if the key cannot be parsed.
+func setPublicKey(key *models.Key, privateKey, passphrase string) {
+	info, err := sshkeys.Inspect(privateKey, passphrase)
+	if err != nil {
+		key.PublicKey, key.Fingerprint, key.KeyType = "", "", ""
+		return
+	}
+	key.PublicKey, key.Fingerprint, key.KeyType = info.PublicKey, info.Fingerprint, info.Type
+}
+
+// preparePrivateKey checks that the private key can be used and sets its public half and how its passphrase
+// is kept. With PassphrasePrompt the passphrase is checked if given but never stored. Returns the error message.
+func preparePrivateKey(key *models.Key, privateKey, passphrase, mode string) string {
+	_, err := sshkeys.Parse(privateKey, passphrase)
+	switch {
+	case errors.Is(err, sshkeys.ErrPassphraseRequired) && mode != models.PassphrasePrompt:
+		return "The private key is protected, enter its passphrase or choose to be asked for it when connecting"
+	case errors.Is(err, sshkeys.ErrWrongPassphrase):
+		return "Wrong passphrase for the private key"
+	case err != nil && !errors.Is(err, sshkeys.ErrPassphraseRequired):
+		return "Invalid private key: " + err.Error()
+	}
+
+	key.Passphrase, key.PassphraseMode = "", ""
+	if sshkeys.IsProtected(privateKey) {
+		key.PassphraseMode = models.PassphrasePrompt
+		if mode != models.PassphrasePrompt {
+			encrypted, err := encryption.Encrypt(passphrase)
+			if err != nil {
+				return "Encryption error"
+			}
+			key.Passphrase, key.PassphraseMode = encrypted, models.PassphraseStored
+		}
+	}
+
+	setPublicKey(key, privateKey, passphrase)
+	return ""
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"ssh_manager/internal/auth"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/utils"
+)
+
+// recentFailureCount failed logins shown to the admins.
+const recentFailureCount = 50
+
+// activeLockouts returns the usernames and addresses that cannot log in now.
+func (h *Handlers) activeLockouts(ctx context.Context) ([]models.LoginLockout, error) {
+	lockouts, err := h.LoginRepo.GetLockouts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	active := make([]models.LoginLockout, 0, len(lockouts))
+	for _, l := range lockouts {
+		if l.Locked(now) {
+			active = append(active, l)
+		}
+	}
+	return active, nil
+}
+
+// FailedLoginsHandler returns the active lockouts and the latest failed logins.
+func (h *Handlers) FailedLoginsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := h.activeLockouts(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] FailedLoginsHandler - activeLockouts: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	failures, err := h.LoginRepo.GetRecentFailures(r.Context(), recentFailureCount)
+	if err != nil {
+		log.Printf("[ERROR] FailedLoginsHandler - GetRecentFailures: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Failed logins retrieved successfully", map[string]interface{}{
+		"lockouts": lockouts,
+		"failures": failures,
+	})
+}
+
+// UnlockLoginHandler lifts the wait or lockout of a username or an address and forgets its failures.
+func (h *Handlers) UnlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Kind    string `json:"kind"`
+		Subject string `json:"subject"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+	switch requestData.Kind {
+	case models.LockoutUser:
+		requestData.Subject = auth.NormalizeUsername(requestData.Subject)
+	case models.LockoutIP:
+	default:
+		utils.SendJSONResponse(w, false, "Invalid lockout kind", nil)
+		return
+	}
+
+	found, err := h.LoginRepo.DeleteLockout(r.Context(), requestData.Kind, requestData.Subject)
+	if err != nil {
+		log.Printf("[ERROR] LoginRepo.DeleteLockout (%s %s): %v", requestData.Kind, requestData.Subject, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	if !found {
+		utils.SendJSONResponse(w, false, "No failed logins to forget", nil)
+		return
+	}
+
+	admin := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	log.Printf("%s unlocked the login of the %s %s", admin.Username, requestData.Kind, requestData.Subject)
+	utils.SendJSONResponse(w, true, "Unlocked", nil)
+}
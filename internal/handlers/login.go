@@ -3,11 +3,15 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"ssh_manager/internal/auth"
+	"ssh_manager/internal/models"
 	"ssh_manager/internal/utils"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/gorilla/sessions"
 )
 
 // LoginHandler displays the login page.
@@ -19,9 +23,20 @@ func (h *Handlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A failed single sign-on comes back with its message
+	var loginError string
+	if flashes := session.Flashes(utils.LoginErrorKey); len(flashes) > 0 {
+		loginError, _ = flashes[0].(string)
+		_ = session.Save(r, w)
+	}
+
 	// Displaying the login page
 	utils.RenderTemplate(w, "login.html", map[string]interface{}{
-		"Title": "Login",
+		"Title":         "Login",
+		"Error":         loginError,
+		"SSO":           h.OIDC != nil,
+		"PasswordLogin": len(h.AuthProviders) > 0,
+		"LocalLogin":    !h.DisableLocalLogin,
 	}, r)
 }
 
@@ -37,34 +52,169 @@ func (h *Handlers) LoginPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.UserRepo.GetByUsername(context.Background(), loginData.Username)
-	if err != nil {
-		log.Printf("[ERROR] LoginPostHandler - GetByUsername (%s): %v", loginData.Username, err)
-		utils.SendJSONResponse(w, false, "Invalid username or password", nil)
+	reservation, ok := h.reserveLogin(w, r, h.loginAttempt(r, loginData.Username))
+	if !ok {
 		return
 	}
 
-	// Password comparison
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginData.Password))
-	if err != nil {
-		utils.SendJSONResponse(w, false, "Invalid username or password", nil)
+	user, message, reason := h.passwordLogin(r.Context(), loginData.Username, loginData.Password)
+	if user == nil {
+		if reason != "" {
+			h.loginFailed(r.Context(), reservation, reason)
+		} else {
+			h.releaseLogin(r.Context(), reservation)
+		}
+		utils.SendJSONResponse(w, false, message, nil)
 		return
 	}
 
+	if user.Disabled {
+		h.loginFailed(r.Context(), reservation, models.FailureDisabled)
+		utils.SendJSONResponse(w, false, "Account is disabled", nil)
+		return
+	}
+	// The password was right, the second factor counts on its own
+	h.releaseLogin(r.Context(), reservation)
+
 	// Creating a session
 	session, err := h.Store.Get(r, utils.SessionName)
 	if err != nil {
 		utils.SendJSONResponse(w, false, "Session error. Please try again later.", nil)
 		return
 	}
-	session.Values[utils.IsAuthenticated] = true
-	session.Values[utils.UsernameKey] = user.Username
-	session.Values[utils.UserIDKey] = user.ID
-	err = session.Save(r, w)
+
+	// With 2FA the session is only authenticated after the second step
+	if user.HasSecondFactor() {
+		session.Values[utils.PendingUserIDKey] = user.ID
+		session.Values[utils.PendingSinceKey] = time.Now().Unix()
+		session.Values[utils.PendingAttemptsKey] = 0
+		if err := session.Save(r, w); err != nil {
+			utils.SendJSONResponse(w, false, "Session save error. Please try again later.", nil)
+			return
+		}
+		var methods []string
+		if user.TOTPEnabled {
+			methods = append(methods, "totp")
+		}
+		if user.Passkeys > 0 {
+			methods = append(methods, "passkey")
+		}
+		utils.SendJSONResponse(w, true, "Confirm the login with your second factor", map[string]interface{}{
+			"two_factor": true,
+			"methods":    methods,
+		})
+		return
+	}
+
+	h.completeLogin(w, r, session, user, "Login succesful")
+}
+
+// passwordLogin asks the providers in turn to check the password and returns the user. Without a user
+// the message tells why and the reason is the failure to record, empty if the password was not checked.
+func (h *Handlers) passwordLogin(ctx context.Context, username, password string) (*models.User, string, string) {
+	if len(h.AuthProviders) == 0 {
+		return nil, "Password login is disabled, sign in with single sign-on", ""
+	}
+
+	unavailable := false
+	for _, provider := range h.AuthProviders {
+		identity, err := provider.Authenticate(ctx, username, password)
+		if errors.Is(err, auth.ErrNotAllowed) || errors.Is(err, auth.ErrNoRole) {
+			return nil, "Your account has no access to SSH Manager", models.FailureNoAccess
+		}
+		if err != nil {
+			// An unreachable directory must not keep the other providers from answering
+			if !errors.Is(err, auth.ErrInvalidCredentials) {
+				utils.LogErrorf("Authentication failed", err, "provider", provider.Name(), "username", username)
+				unavailable = true
+			}
+			continue
+		}
+
+		if provider.Name() == models.AuthLocal {
+			user, err := h.UserRepo.GetByUsername(ctx, identity.Username)
+			if err != nil {
+				log.Printf("[ERROR] passwordLogin - GetByUsername (%s): %v", identity.Username, err)
+				return nil, "Invalid username or password", ""
+			}
+			return user, "", ""
+		}
+		user, message := h.externalUser(ctx, provider.Name(), identity, provider.AutoProvision())
+		if user == nil {
+			return nil, message, models.FailureNoAccess
+		}
+		return user, "", ""
+	}
+	if unavailable {
+		return nil, "The login service is not reachable, try again later", ""
+	}
+	return nil, "Invalid username or password", models.FailurePassword
+}
+
+// loginAttempt who logs in with the request.
+func (h *Handlers) loginAttempt(r *http.Request, username string) auth.Attempt {
+	return auth.Attempt{Username: username, IP: utils.ClientIP(r, h.TrustProxy), UserAgent: r.UserAgent()}
+}
+
+// reserveLogin counts the attempt as failed until the password or code turns out right. The attempt is
+// answered while the username or the address has to wait, the password is not checked then.
+func (h *Handlers) reserveLogin(w http.ResponseWriter, r *http.Request, attempt auth.Attempt) (*auth.Reservation, bool) {
+	reservation, wait, err := h.Throttle.Reserve(r.Context(), attempt)
+	if err != nil {
+		utils.LogErrorf("Failed to count the login attempt", err)
+		h.releaseLogin(r.Context(), reservation)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return nil, false
+	}
+	if wait <= 0 {
+		return reservation, true
+	}
+
+	h.loginFailed(r.Context(), reservation, models.FailureLocked)
+	wait = wait.Truncate(time.Second) + time.Second
+	utils.SendJSONResponse(w, false, "Too many failed logins, try again in "+wait.String(), map[string]interface{}{
+		"retry_after": int(wait.Seconds()),
+	})
+	return nil, false
+}
+
+// loginFailed logs and records the failed login.
+func (h *Handlers) loginFailed(ctx context.Context, reservation *auth.Reservation, reason string) {
+	attempt := reservation.Attempt
+	utils.LogInfo("Login failed", "username", attempt.Username, "ip", attempt.IP, "user_agent", attempt.UserAgent, "reason", reason)
+	if err := reservation.Fail(ctx, reason); err != nil {
+		utils.LogErrorf("Failed to record the failed login", err, "username", attempt.Username)
+	}
+}
+
+// releaseLogin takes back the count of an attempt whose password or code was right or not checked.
+func (h *Handlers) releaseLogin(ctx context.Context, reservation *auth.Reservation) {
+	if err := reservation.Release(ctx); err != nil {
+		utils.LogErrorf("Failed to take back the login attempt", err, "username", reservation.Attempt.Username)
+	}
+}
+
+// completeLogin marks the session as authenticated for the user.
+func (h *Handlers) completeLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, user *models.User, message string) {
+	if err := h.Throttle.Succeed(r.Context(), user.Username); err != nil {
+		utils.LogErrorf("Failed to reset the login failures", err, "username", user.Username)
+	}
+
+	err := startSession(w, r, session, user)
 	if err != nil {
 		utils.SendJSONResponse(w, false, "Session save error. Please try again later.", nil)
 		return
 	}
 
-	utils.SendJSONResponse(w, true, "Login succesful", session.Values["authenticated"])
+	utils.SendJSONResponse(w, true, message, session.Values["authenticated"])
+}
+
+// startSession saves the session as authenticated for the user.
+func startSession(w http.ResponseWriter, r *http.Request, session *sessions.Session, user *models.User) error {
+	clearPendingLogin(session)
+	session.Values[utils.IsAuthenticated] = true
+	session.Values[utils.UsernameKey] = user.Username
+	session.Values[utils.UserIDKey] = user.ID
+	session.Values[utils.SessionVersionKey] = user.SessionVersion
+	return session.Save(r, w)
 }
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"ssh_manager/internal/auth"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/utils"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+)
+
+// ssoTimeout time to log in at the identity provider.
+const ssoTimeout = 10 * time.Minute
+
+// pendingSSO what the callback needs to check the answer of the identity provider.
+type pendingSSO struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+	Since    int64  `json:"since"`
+}
+
+// OIDCLoginHandler redirects to the login page of the identity provider.
+func (h *Handlers) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if h.OIDC == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	if authenticated, ok := session.Values[utils.IsAuthenticated].(bool); ok && authenticated {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	pending := pendingSSO{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: oauth2.GenerateVerifier(),
+		Since:    time.Now().Unix(),
+	}
+	url, err := h.OIDC.AuthCodeURL(r.Context(), pending.State, pending.Nonce, pending.Verifier)
+	if err != nil {
+		utils.LogErrorf("Single sign-on is not available", err)
+		h.failSSO(w, r, session, "The identity provider is not reachable, try again later")
+		return
+	}
+
+	b, _ := json.Marshal(pending)
+	session.Values[utils.OIDCStateKey] = string(b)
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, "Session error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// OIDCCallbackHandler logs the user in with the code the identity provider sent back.
+func (h *Handlers) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if h.OIDC == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	value, _ := session.Values[utils.OIDCStateKey].(string)
+	delete(session.Values, utils.OIDCStateKey)
+
+	var pending pendingSSO
+	query := r.URL.Query()
+	if json.Unmarshal([]byte(value), &pending) != nil || time.Since(time.Unix(pending.Since, 0)) > ssoTimeout ||
+		subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(pending.State)) != 1 {
+		h.failSSO(w, r, session, "The login has expired, try again")
+		return
+	}
+	if query.Get("error") != "" {
+		log.Printf("[ERROR] OIDCCallbackHandler: the identity provider answered %s: %s", query.Get("error"), query.Get("error_description"))
+		h.failSSO(w, r, session, "The identity provider refused the login")
+		return
+	}
+
+	identity, err := h.OIDC.Exchange(r.Context(), query.Get("code"), pending.Verifier, pending.Nonce)
+	if errors.Is(err, auth.ErrNoRole) {
+		h.failSSO(w, r, session, "Your account has no access to SSH Manager")
+		return
+	}
+	if err != nil {
+		utils.LogErrorf("Single sign-on failed", err)
+		h.failSSO(w, r, session, "Single sign-on failed")
+		return
+	}
+
+	user, message := h.externalUser(r.Context(), models.AuthOIDC, identity, h.OIDC.Config.AutoProvision)
+	if user == nil {
+		h.failSSO(w, r, session, message)
+		return
+	}
+	if user.Disabled {
+		h.failSSO(w, r, session, "Account is disabled")
+		return
+	}
+
+	if err := startSession(w, r, session, user); err != nil {
+		http.Error(w, "Session error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// externalUser returns the user of an identity confirmed by the provider, creating them at their first login.
+// The role follows the groups at every login. Without a user the message tells why.
+func (h *Handlers) externalUser(ctx context.Context, provider string, identity *auth.Identity, autoProvision bool) (*models.User, string) {
+	user, err := h.UserRepo.GetByExternalID(ctx, provider, identity.Subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !autoProvision {
+			return nil, "Your account has no access to SSH Manager, ask an administrator"
+		}
+		// A local account is never taken over by a user of the identity provider with the same name
+		if _, err := h.UserRepo.GetByUsername(ctx, identity.Username); err == nil {
+			log.Printf("[ERROR] externalUser: the username %s of the %s subject %s is taken", identity.Username, provider, identity.Subject)
+			return nil, "An account with your username already exists, ask an administrator"
+		}
+
+		user = &models.User{
+			Username:     identity.Username,
+			Role:         identity.Role,
+			AuthProvider: provider,
+			ExternalID:   identity.Subject,
+		}
+		if err := h.UserRepo.Create(ctx, user); err != nil {
+			log.Printf("[ERROR] externalUser - UserRepo.Create (%s): %v", identity.Username, err)
+			return nil, "Failed to create your account"
+		}
+		log.Printf("Provisioned the user %s (%s) from %s", user.Username, user.Role, provider)
+		return user, ""
+	}
+	if err != nil {
+		log.Printf("[ERROR] externalUser - GetByExternalID (%s): %v", identity.Subject, err)
+		return nil, "Database error"
+	}
+
+	if user.Role != identity.Role {
+		if err := h.UserRepo.UpdateAccess(ctx, user.ID, identity.Role, user.Disabled); err != nil {
+			log.Printf("[ERROR] externalUser - UpdateAccess (ID: %d): %v", user.ID, err)
+			return nil, "Database error"
+		}
+		// A demoted user must not keep the terminals, tunnels and proxies opened with the old role
+		if user.CanWrite() && !(&models.User{Role: identity.Role}).CanWrite() {
+			h.SSHService.TerminateUserSessions(user.ID)
+		}
+		user.Role = identity.Role
+	}
+	// A renamed user keeps their old name while the new one is taken
+	if user.Username != identity.Username {
+		if err := h.UserRepo.UpdateUSername(ctx, user.ID, identity.Username); err != nil {
+			log.Printf("[ERROR] externalUser - UpdateUSername (ID: %d): %v", user.ID, err)
+		} else {
+			user.Username = identity.Username
+		}
+	}
+	return user, ""
+}
+
+// failSSO shows the message on the login page.
+func (h *Handlers) failSSO(w http.ResponseWriter, r *http.Request, session *sessions.Session, message string) {
+	session.AddFlash(message, utils.LoginErrorKey)
+	_ = session.Save(r, w)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// randomToken returns a random URL-safe value for the state and the nonce.
+func randomToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ssh_manager/internal/auth"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/repository"
+	"ssh_manager/internal/services"
+	"ssh_manager/internal/utils"
+
+	"github.com/gorilla/sessions"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	testClientID     = "ssh-manager"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://ssh.example.com/login/oidc/callback"
+)
+
+// mockIdP an identity provider with the discovery, authorization, token and JWKS endpoints.
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]authRequest // Issued codes, each can be redeemed once
+	groups []string               // Groups put into the next ID tokens
+	nonce  string                 // Nonce put into the next ID tokens instead of the requested one
+}
+
+// authRequest what the IdP remembers of an authorization request until the code is redeemed.
+type authRequest struct {
+	nonce     string
+	challenge string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, codes: make(map[string]authRequest)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                idp.URL,
+		"authorization_endpoint":                idp.URL + "/authorize",
+		"token_endpoint":                        idp.URL + "/token",
+		"jwks_uri":                              idp.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize logs the user in at once and sends the code back to the manager.
+func (idp *mockIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != testClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomToken()
+	idp.mu.Lock()
+	idp.codes[code] = authRequest{nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	idp.mu.Unlock()
+
+	back, _ := url.Parse(q.Get("redirect_uri"))
+	back.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+// token redeems a code if the client proves it holds the PKCE verifier.
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != testClientID || secret != testClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	idp.mu.Lock()
+	req, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	groups, nonce := idp.groups, idp.nonce
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	if nonce == "" {
+		nonce = req.nonce
+	}
+
+	now := time.Now()
+	idToken := idp.sign(map[string]interface{}{
+		"iss":                idp.URL,
+		"aud":                testClientID,
+		"sub":                "subject-1",
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              nonce,
+		"preferred_username": "alice",
+		"groups":             groups,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (idp *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := idp.key.PublicKey
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// sign returns the claims as a JWT signed with RS256.
+func (idp *mockIdP) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// newSSOHandlers returns handlers with single sign-on at the IdP and an empty database.
+func newSSOHandlers(t *testing.T, idp *mockIdP) *Handlers {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := repository.Migrate(context.Background(), db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:        idp.URL,
+		ClientID:      testClientID,
+		ClientSecret:  testClientSecret,
+		RedirectURL:   testRedirectURL,
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		RoleMapping: map[string]string{
+			"admins":   models.RoleAdmin,
+			"ops":      models.RoleOperator,
+			"auditors": models.RoleReadOnly,
+		},
+		AutoProvision: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Handlers{
+		UserRepo:   &repository.UserRepository{DB: db},
+		Store:      sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef")),
+		OIDC:       provider,
+		SSHService: &services.SSHService{Sessions: make(map[int]map[int]*models.ActiveSession)},
+	}
+}
+
+// ssoLogin runs the login through the IdP. The tamper functions change the authorization request
+// and the callback on the way. Returns where the callback redirects to and the login error shown there.
+func ssoLogin(t *testing.T, h *Handlers, tamperAuthorize, tamperCallback func(url.Values)) (string, string) {
+	rec := httptest.NewRecorder()
+	h.OIDCLoginHandler(rec, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+	authorizeURL, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || rec.Code != http.StatusFound {
+		t.Fatalf("login redirect = %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+
+	q := authorizeURL.Query()
+	if tamperAuthorize != nil {
+		tamperAuthorize(q)
+	}
+	authorizeURL.RawQuery = q.Encode()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authorizeURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callbackURL, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize redirect = %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	q = callbackURL.Query()
+	if tamperCallback != nil {
+		tamperCallback(q)
+	}
+	callbackURL.RawQuery = q.Encode()
+	req := httptest.NewRequest(http.MethodGet, callbackURL.String(), nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	h.OIDCCallbackHandler(rec, req)
+
+	// The login error is a flash in the session cookie
+	req = httptest.NewRequest(http.MethodGet, "/login", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	session, _ := h.Store.Get(req, utils.SessionName)
+	var message string
+	if flashes := session.Flashes(utils.LoginErrorKey); len(flashes) > 0 {
+		message, _ = flashes[0].(string)
+	}
+	return rec.Header().Get("Location"), message
+}
+
+func TestOIDCLogin(t *testing.T) {
+	tests := []struct {
+		name            string
+		groups          []string
+		idTokenNonce    string
+		tamperAuthorize func(url.Values)
+		tamperCallback  func(url.Values)
+		wantLocation    string
+		wantMessage     string
+		wantRole        string
+	}{
+		{
+			name:         "admin group",
+			groups:       []string{"staff", "admins"},
+			wantLocation: "/",
+			wantRole:     models.RoleAdmin,
+		},
+		{
+			name:         "most privileged group",
+			groups:       []string{"auditors", "ops"},
+			wantLocation: "/",
+			wantRole:     models.RoleOperator,
+		},
+		{
+			name:         "no mapped group",
+			groups:       []string{"staff"},
+			wantLocation: "/login",
+			wantMessage:  "Your account has no access to SSH Manager",
+		},
+		{
+			name:           "state mismatch",
+			groups:         []string{"admins"},
+			tamperCallback: func(q url.Values) { q.Set("state", randomToken()) },
+			wantLocation:   "/login",
+			wantMessage:    "The login has expired, try again",
+		},
+		{
+			name:           "state missing",
+			groups:         []string{"admins"},
+			tamperCallback: func(q url.Values) { q.Del("state") },
+			wantLocation:   "/login",
+			wantMessage:    "The login has expired, try again",
+		},
+		{
+			name:         "nonce mismatch",
+			groups:       []string{"admins"},
+			idTokenNonce: "replayed-nonce",
+			wantLocation: "/login",
+			wantMessage:  "Single sign-on failed",
+		},
+		{
+			name:   "PKCE verifier mismatch",
+			groups: []string{"admins"},
+			tamperAuthorize: func(q url.Values) {
+				sum := sha256.Sum256([]byte("verifier of an attacker"))
+				q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+			},
+			wantLocation: "/login",
+			wantMessage:  "Single sign-on failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.groups, idp.nonce = tt.groups, tt.idTokenNonce
+			h := newSSOHandlers(t, idp)
+
+			location, message := ssoLogin(t, h, tt.tamperAuthorize, tt.tamperCallback)
+			if location != tt.wantLocation || message != tt.wantMessage {
+				t.Errorf("callback = %q %q, want %q %q", location, message, tt.wantLocation, tt.wantMessage)
+			}
+
+			user, err := h.UserRepo.GetByExternalID(context.Background(), models.AuthOIDC, "subject-1")
+			if tt.wantRole == "" {
+				if err == nil {
+					t.Errorf("user %s was created by a failed login", user.Username)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("the user was not provisioned: %v", err)
+			}
+			if user.Username != "alice" || user.Role != tt.wantRole {
+				t.Errorf("user = %s %s, want alice %s", user.Username, user.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginFollowsGroups(t *testing.T) {
+	idp := newMockIdP(t)
+	h := newSSOHandlers(t, idp)
+
+	for _, step := range []struct {
+		groups []string
+		role   string
+	}{
+		{[]string{"admins"}, models.RoleAdmin},
+		{[]string{"auditors"}, models.RoleReadOnly},
+		{[]string{"ops", "auditors"}, models.RoleOperator},
+	} {
+		idp.groups = step.groups
+		if location, message := ssoLogin(t, h, nil, nil); location != "/" {
+			t.Fatalf("login with %q = %q %q", step.groups, location, message)
+		}
+		user, err := h.UserRepo.GetByExternalID(context.Background(), models.AuthOIDC, "subject-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != step.role {
+			t.Errorf("role with %q = %s, want %s", step.groups, user.Role, step.role)
+		}
+	}
+
+	users, err := h.UserRepo.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || !strings.EqualFold(users[0].Username, "alice") {
+		t.Errorf("users = %+v, want only alice", users)
+	}
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"ssh_manager/internal/models"
 	"ssh_manager/internal/utils"
 
 	"golang.org/x/crypto/bcrypt"
@@ -17,10 +19,31 @@ func (h *Handlers) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	username, _ := session.Values[utils.UsernameKey].(string)
+	user := r.Context().Value(utils.CurrentUserKey).(*models.User)
+
+	recoveryCodes, err := h.UserRepo.CountRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] ProfileHandler - CountRecoveryCodes (userID: %d): %v", user.ID, err)
+	}
+	passkeys, err := h.WebAuthnRepo.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] ProfileHandler - WebAuthnRepo.GetByUserID (userID: %d): %v", user.ID, err)
+	}
+	require2FA, err := h.SettingsRepo.GetBool(r.Context(), models.SettingRequire2FA)
+	if err != nil {
+		log.Printf("[ERROR] ProfileHandler - SettingsRepo.GetBool: %v", err)
+	}
+
 	utils.RenderTemplate(w, "profile.html", map[string]interface{}{
-		"Title":    "Profile",
-		"Username": username,
-		"ShowMenu": true,
+		"Title":         "Profile",
+		"Username":      username,
+		"TOTPEnabled":   user.TOTPEnabled,
+		"RecoveryCodes": recoveryCodes,
+		"Passkeys":      passkeys,
+		"Local":         user.IsLocal(),
+		"TwoFactor":     !user.TwoFactorAtProvider(),
+		"Require2FA":    require2FA,
+		"ShowMenu":      true,
 	}, r)
 }
 
@@ -36,6 +59,13 @@ func (h *Handlers) UpdateUsernameHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The identity provider owns the name of its users
+	user := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	if !user.IsLocal() {
+		utils.SendJSONResponse(w, false, "Your account is managed by the identity provider", nil)
+		return
+	}
+
 	session, _ := h.Store.Get(r, utils.SessionName)
 	userID := session.Values[utils.UserIDKey].(int)
 
@@ -66,6 +96,12 @@ func (h *Handlers) UpdatePasswordHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	user := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	if !user.IsLocal() {
+		utils.SendJSONResponse(w, false, "Your account is managed by the identity provider", nil)
+		return
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(requestData.NewPassword), bcrypt.DefaultCost)
 
 	session, _ := h.Store.Get(r, utils.SessionName)
@@ -81,5 +117,12 @@ func (h *Handlers) UpdatePasswordHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The other sessions are logged out, this one stays
+	session.Values[utils.SessionVersionKey] = user.SessionVersion + 1
+	if err := session.Save(r, w); err != nil {
+		utils.SendJSONResponse(w, false, "Session save error", nil)
+		return
+	}
+
 	utils.SendJSONResponse(w, true, "Password updated successfully", nil)
 }
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// promptPrefix marks a control message that asks the browser for an answer.
+const promptPrefix = "[PROMPT]"
+
+// promptTimeout how long we wait for the user to answer a prompt.
+const promptTimeout = 60 * time.Second
+
+// PromptMessage Describes a question sent to the frontend while connecting.
+type PromptMessage struct {
+	Kind        string `json:"kind"`
+	Title       string `json:"title"`
+	Message     string `json:"message"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Echo        bool   `json:"echo,omitempty"` // The answer may be shown while it is typed
+}
+
+// PromptReply Describes the answer of the frontend to a PromptMessage.
+type PromptReply struct {
+	Type   string `json:"type"`
+	Accept bool   `json:"accept"`
+	Value  string `json:"value,omitempty"` // Text the user entered, e.g. a passphrase
+}
+
+// wsPrompter relays connection questions to the browser terminal over the websocket.
+// It must only be used before the main reading loop of the socket is started.
+type wsPrompter struct {
+	conn *websocket.Conn
+}
+
+// ConfirmHostKey asks the user to trust a host key seen for the first time.
+func (p *wsPrompter) ConfirmHostKey(host, keyType, fingerprint string) (bool, error) {
+	reply, err := p.ask(PromptMessage{
+		Kind:        "hostkey",
+		Title:       "Unknown host key",
+		Message:     fmt.Sprintf("The authenticity of host '%s' can't be established.\n%s key fingerprint is %s.\nDo you want to trust this key?", host, keyType, fingerprint),
+		Fingerprint: fingerprint,
+	})
+	if err != nil {
+		return false, err
+	}
+	return reply.Accept, nil
+}
+
+// AskPassphrase asks the user for the passphrase of a key that is not stored.
+func (p *wsPrompter) AskPassphrase(keyID int, keyName string) (string, error) {
+	reply, err := p.ask(PromptMessage{
+		Kind:    "passphrase",
+		Title:   "Key passphrase",
+		Message: fmt.Sprintf("Enter the passphrase for key '%s':", keyName),
+	})
+	if err != nil {
+		return "", err
+	}
+	if !reply.Accept {
+		return "", errors.New("the passphrase was not entered")
+	}
+	return reply.Value, nil
+}
+
+// AnswerChallenge asks the user a question of a keyboard-interactive login, e.g. for a one-time code.
+func (p *wsPrompter) AnswerChallenge(host, instruction, question string, echo bool) (string, error) {
+	message := strings.TrimSpace(question)
+	if instruction != "" {
+		message = instruction + "\n" + message
+	}
+	reply, err := p.ask(PromptMessage{
+		Kind:    "challenge",
+		Title:   fmt.Sprintf("Login to %s", host),
+		Message: message,
+		Echo:    echo,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !reply.Accept {
+		return "", errors.New("the login question was not answered")
+	}
+	return reply.Value, nil
+}
+
+// ask sends the prompt and waits for the reply, skipping any other messages (keystrokes, resizes).
+func (p *wsPrompter) ask(prompt PromptMessage) (*PromptReply, error) {
+	payload, err := json.Marshal(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.conn.WriteMessage(websocket.TextMessage, append([]byte(promptPrefix), payload...)); err != nil {
+		return nil, err
+	}
+
+	_ = p.conn.SetReadDeadline(time.Now().Add(promptTimeout))
+	defer p.conn.SetReadDeadline(time.Time{})
+
+	for {
+		_, msg, err := p.conn.ReadMessage()
+		if err != nil {
+			return nil, fmt.Errorf("no answer to the prompt: %w", err)
+		}
+
+		var reply PromptReply
+		if err := json.Unmarshal(msg, &reply); err == nil && reply.Type == "prompt_reply" {
+			return &reply, nil
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/services"
+	"ssh_manager/internal/utils"
+	"strings"
+)
+
+// proxyRequest identifies a proxy by the host and the port it listens on.
+type proxyRequest struct {
+	HostID      int    `json:"host_id"`
+	BindAddress string `json:"bind_address"`
+	BindPort    int    `json:"bind_port"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+}
+
+// ListProxiesHandler returns the user's running SOCKS5 proxies.
+func (h *Handlers) ListProxiesHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	utils.SendJSONResponse(w, true, "Proxies retrieved successfully", h.SSHService.ListProxies(userID))
+}
+
+// StartProxyHandler starts a SOCKS5 proxy through the host (connecting to the host if needed).
+func (h *Handlers) StartProxyHandler(w http.ResponseWriter, r *http.Request) {
+	var req proxyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+	user, _ := r.Context().Value(utils.CurrentUserKey).(*models.User)
+
+	req.BindAddress = strings.TrimSpace(req.BindAddress)
+	req.Username = strings.TrimSpace(req.Username)
+	if req.BindAddress == "" {
+		req.BindAddress = "127.0.0.1"
+	}
+	if req.BindPort < 1 || req.BindPort > 65535 {
+		utils.SendJSONResponse(w, false, "Port must be between 1 and 65535", nil)
+		return
+	}
+	if req.Username != "" && req.Password == "" {
+		utils.SendJSONResponse(w, false, "Password is required when a username is set", nil)
+		return
+	}
+	if len(req.Username) > 255 || len(req.Password) > 255 {
+		utils.SendJSONResponse(w, false, "Username and password may be at most 255 bytes long", nil)
+		return
+	}
+	// The proxy listens on the manager itself, like the local tunnels
+	if !isLoopback(req.BindAddress) && (user == nil || !user.IsAdmin()) {
+		utils.SendJSONResponse(w, false, "Only admins can listen on addresses other than localhost", nil)
+		return
+	}
+
+	as, err := h.SSHService.GetSession(userID, req.HostID, r.Context(), nil)
+	if err != nil {
+		utils.LogErrorf("Failed to get SSH session for proxy", err, "host_id", req.HostID)
+		utils.SendJSONResponse(w, false, "SSH connection failed: "+err.Error(), nil)
+		return
+	}
+
+	proxy, err := h.SSHService.StartProxy(as, req.BindAddress, req.BindPort, req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrProxyRunning) {
+			utils.SendJSONResponse(w, false, "Proxy is already running on this port", nil)
+		} else {
+			utils.LogErrorf("Failed to start proxy", err, "host_id", req.HostID, "port", req.BindPort)
+			utils.SendJSONResponse(w, false, "Failed to start proxy: "+err.Error(), nil)
+		}
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Proxy started successfully", map[string]interface{}{
+		"host_id":      req.HostID,
+		"bind_address": proxy.BindAddress,
+		"bind_port":    proxy.BindPort,
+	})
+}
+
+// StopProxyHandler stops a running proxy, the host connection stays alive.
+func (h *Handlers) StopProxyHandler(w http.ResponseWriter, r *http.Request) {
+	var req proxyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	if err := h.SSHService.StopProxy(userID, req.HostID, req.BindPort); err != nil {
+		utils.SendJSONResponse(w, false, "Proxy is not running", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Proxy stopped successfully", map[string]interface{}{
+		"host_id":   req.HostID,
+		"bind_port": req.BindPort,
+	})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/utils"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RecordingsHandler displays the page with recorded terminal sessions.
+// Admins can also pick other users, including deleted ones, to review their sessions.
+func (h *Handlers) RecordingsHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	recordings, err := h.RecordingRepo.List(r.Context(), models.RecordingFilter{UserID: userID})
+	if err != nil {
+		log.Printf("[ERROR] RecordingsHandler: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	hosts, err := h.HostRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] RecordingsHandler - GetByUserID (userID: %d): %v", userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	var users []models.User
+	if user, _ := r.Context().Value(utils.CurrentUserKey).(*models.User); user != nil && user.IsAdmin() {
+		if users, err = h.UserRepo.GetAll(r.Context()); err != nil {
+			log.Printf("[ERROR] RecordingsHandler - GetAll: %v", err)
+			utils.SendJSONResponse(w, false, "Database error", nil)
+			return
+		}
+	}
+
+	utils.RenderTemplate(w, "recordings.html", map[string]interface{}{
+		"Title":      "Recordings",
+		"ShowMenu":   true,
+		"Recordings": recordings,
+		"Hosts":      hosts,
+		"Users":      users,
+	}, r)
+}
+
+// ListRecordingsHandler returns the user's recordings filtered by host and time range.
+// "from" and "to" accept RFC 3339 timestamps or plain dates (2006-01-02).
+func (h *Handlers) ListRecordingsHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	filter, message := recordingFilter(r)
+	if message != "" {
+		utils.SendJSONResponse(w, false, message, nil)
+		return
+	}
+	filter.UserID = userID
+	h.listRecordings(w, r, filter)
+}
+
+// AdminListRecordingsHandler returns the recordings of all users, or of the one in "user_id",
+// with the same filters as ListRecordingsHandler.
+func (h *Handlers) AdminListRecordingsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, message := recordingFilter(r)
+	if message != "" {
+		utils.SendJSONResponse(w, false, message, nil)
+		return
+	}
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil || userID < 1 {
+			utils.SendJSONResponse(w, false, "Invalid user ID", nil)
+			return
+		}
+		filter.UserID = userID
+	}
+	h.listRecordings(w, r, filter)
+}
+
+// listRecordings sends the recordings matching the filter.
+func (h *Handlers) listRecordings(w http.ResponseWriter, r *http.Request, filter models.RecordingFilter) {
+	recordings, err := h.RecordingRepo.List(r.Context(), filter)
+	if err != nil {
+		log.Printf("[ERROR] ListRecordingsHandler: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Recordings retrieved successfully", recordings)
+}
+
+// recordingFilter reads the host and time range of the query, the message is not empty when they are invalid.
+func recordingFilter(r *http.Request) (models.RecordingFilter, string) {
+	query := r.URL.Query()
+	var filter models.RecordingFilter
+
+	if v := query.Get("host_id"); v != "" {
+		hostID, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, "Invalid host ID"
+		}
+		filter.HostID = hostID
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query.Get("from"), false); err != nil {
+		return filter, "Invalid 'from' time"
+	}
+	if filter.To, err = parseTimeParam(query.Get("to"), true); err != nil {
+		return filter, "Invalid 'to' time"
+	}
+	return filter, ""
+}
+
+// GetRecordingCastHandler streams the asciicast file of a recording for replay.
+func (h *Handlers) GetRecordingCastHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	rec, err := h.RecordingRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	streamRecording(w, rec)
+}
+
+// AdminGetRecordingCastHandler streams the recording of any user, the replay is logged for the audit.
+func (h *Handlers) AdminGetRecordingCastHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := h.RecordingRepo.GetAnyByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+
+	admin := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	if rec.UserID != admin.ID {
+		log.Printf("%s replayed the recording %d of the user %d", admin.Username, rec.ID, rec.UserID)
+	}
+	streamRecording(w, rec)
+}
+
+// streamRecording sends the asciicast file of the recording.
+func streamRecording(w http.ResponseWriter, rec *models.Recording) {
+	file, err := os.Open(rec.FilePath)
+	if err != nil {
+		utils.LogErrorf("Failed to open recording", err, "recording_id", rec.ID)
+		http.Error(w, "Recording file not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"recording_%d.cast\"", rec.ID))
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	if _, err := io.Copy(w, file); err != nil {
+		utils.LogErrorf("Error streaming recording", err)
+	}
+}
+
+// parseTimeParam parses an optional time parameter, a plain date as the upper bound includes the whole day.
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t.UTC(), nil
+}
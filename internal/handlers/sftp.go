@@ -28,7 +28,7 @@ func (h *Handlers) GetFilesHandler(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.Store.Get(r, utils.SessionName)
 	userID, _ := session.Values[utils.UserIDKey].(int)
 
-	as, err := h.SSHService.GetSession(userID, hostID, r.Context())
+	as, err := h.SSHService.GetSession(userID, hostID, r.Context(), nil)
 	if err != nil {
 		utils.LogErrorf("Failed to get SSH session for SFTP", err, "host_id", hostID)
 		utils.SendJSONResponse(w, false, "SSH connection failed: "+err.Error(), nil)
@@ -69,7 +69,7 @@ func (h *Handlers) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	session, _ := h.Store.Get(r, utils.SessionName)
 	userID, _ := session.Values[utils.UserIDKey].(int)
-	as, err := h.SSHService.GetSession(userID, hostID, r.Context())
+	as, err := h.SSHService.GetSession(userID, hostID, r.Context(), nil)
 	if err != nil {
 		http.Error(w, "SSH session failed", http.StatusInternalServerError)
 		return
@@ -142,7 +142,7 @@ func (h *Handlers) DownloadZipHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userID, _ := session.Values[utils.UserIDKey].(int)
-	as, err := h.SSHService.GetSession(userID, hostID, r.Context())
+	as, err := h.SSHService.GetSession(userID, hostID, r.Context(), nil)
 	if err != nil {
 		utils.LogErrorf("Failed to get SSH session for ZIP", err, "host_id", hostID)
 		http.Error(w, "SSH connection failed", http.StatusInternalServerError)
@@ -204,7 +204,7 @@ func (h *Handlers) UploadHandler(w http.ResponseWriter, r *http.Request) {
 	remotePath := r.FormValue("remote_path")
 
 	userID, _ := session.Values[utils.UserIDKey].(int)
-	as, err := h.SSHService.GetSession(userID, hostID, r.Context())
+	as, err := h.SSHService.GetSession(userID, hostID, r.Context(), nil)
 	if err != nil {
 		utils.SendJSONResponse(w, false, "SSH session failed", nil)
 		return
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SnippetsHandler displays the page with the snippets library.
+func (h *Handlers) SnippetsHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	snippets, err := h.SnippetRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] SnippetsHandler - GetByUserID (userID: %d): %v", userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	hosts, err := h.HostRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] SnippetsHandler - HostRepo.GetByUserID (userID: %d): %v", userID, err)
+	}
+
+	groups, err := h.GroupRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] SnippetsHandler - GroupRepo.GetByUserID: %v", err)
+	}
+
+	utils.RenderTemplate(w, "snippets.html", map[string]interface{}{
+		"Title":    "Snippets",
+		"ShowMenu": true,
+		"Snippets": snippets,
+		"Hosts":    hosts,
+		"Groups":   groups,
+	}, r)
+}
+
+// ListSnippetsHandler returns the user's snippets.
+func (h *Handlers) ListSnippetsHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	snippets, err := h.SnippetRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] ListSnippetsHandler (userID: %d): %v", userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Snippets retrieved successfully", snippets)
+}
+
+// AddSnippetHandler saves a new snippet.
+func (h *Handlers) AddSnippetHandler(w http.ResponseWriter, r *http.Request) {
+	var snippet models.Snippet
+	if err := json.NewDecoder(r.Body).Decode(&snippet); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	snippet.UserID = session.Values[utils.UserIDKey].(int)
+
+	if msg := h.validateSnippet(r.Context(), snippet.UserID, &snippet); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
+	if err := h.SnippetRepo.Create(r.Context(), &snippet); err != nil {
+		log.Printf("[ERROR] SnippetRepo.Create (userID: %d): %v", snippet.UserID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	snippet.ParseVariables()
+
+	utils.SendJSONResponse(w, true, "Snippet added successfully", snippet)
+}
+
+// EditSnippetHandler edits an existing snippet.
+func (h *Handlers) EditSnippetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid snippet ID", nil)
+		return
+	}
+
+	var snippet models.Snippet
+	if err := json.NewDecoder(r.Body).Decode(&snippet); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	oldSnippet, err := h.SnippetRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Snippet not found", nil)
+		return
+	}
+	// Other members run the command, so only the owner may change it
+	if !canManage(r, oldSnippet.UserID) {
+		utils.SendJSONResponse(w, false, "Only the owner can change a shared snippet", nil)
+		return
+	}
+
+	if msg := h.validateSnippet(r.Context(), userID, &snippet); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
+	snippet.ID = id
+	snippet.UserID = oldSnippet.UserID
+	if err := h.SnippetRepo.Update(r.Context(), &snippet, oldSnippet.UserID); err != nil {
+		log.Printf("[ERROR] SnippetRepo.Update (ID: %d, User: %d): %v", id, userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	snippet.ParseVariables()
+
+	utils.SendJSONResponse(w, true, "Snippet updated successfully", snippet)
+}
+
+// DeleteSnippetHandler deletes the snippet.
+func (h *Handlers) DeleteSnippetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid snippet ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	snippet, err := h.SnippetRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Snippet not found", nil)
+		return
+	}
+	if !canManage(r, snippet.UserID) {
+		utils.SendJSONResponse(w, false, "Only the owner can delete a shared snippet", nil)
+		return
+	}
+
+	if err := h.SnippetRepo.Delete(r.Context(), id, snippet.UserID); err != nil {
+		log.Printf("[ERROR] SnippetRepo.Delete (ID: %d, User: %d): %v", id, userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Snippet deleted successfully", map[string]interface{}{
+		"id": id,
+	})
+}
+
+// RunSnippetHandler runs a snippet on a host without a terminal and returns its output.
+func (h *Handlers) RunSnippetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid snippet ID", nil)
+		return
+	}
+
+	var requestData struct {
+		HostID         int               `json:"host_id"`
+		Variables      map[string]string `json:"variables"`
+		TimeoutSeconds int               `json:"timeout_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	if requestData.TimeoutSeconds <= 0 {
+		requestData.TimeoutSeconds = defaultJobTimeout
+	}
+	if requestData.TimeoutSeconds > maxJobTimeout {
+		utils.SendJSONResponse(w, false, fmt.Sprintf("The timeout is limited to %d seconds", maxJobTimeout), nil)
+		return
+	}
+
+	snippet, err := h.SnippetRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Snippet not found", nil)
+		return
+	}
+	if _, err := h.HostRepo.GetByID(r.Context(), requestData.HostID, userID); err != nil {
+		utils.SendJSONResponse(w, false, "Host not found", nil)
+		return
+	}
+
+	command, err := snippet.Render(requestData.Variables)
+	if err != nil {
+		utils.SendJSONResponse(w, false, err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(requestData.TimeoutSeconds)*time.Second)
+	defer cancel()
+	result, err := h.SSHService.RunCommand(ctx, userID, requestData.HostID, command)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		utils.SendJSONResponse(w, false, "Command timed out", result)
+	case err != nil:
+		utils.LogErrorf("Snippet run failed", err, "snippet_id", id, "host_id", requestData.HostID)
+		utils.SendJSONResponse(w, false, err.Error(), result)
+	default:
+		utils.SendJSONResponse(w, true, "Snippet finished", result)
+	}
+}
+
+// validateSnippet checks the snippet fields and that the user is a member of the group it is shared with.
+// Returns the error message.
+func (h *Handlers) validateSnippet(ctx context.Context, userID int, snippet *models.Snippet) string {
+	snippet.Name = strings.TrimSpace(snippet.Name)
+	if snippet.Name == "" || strings.TrimSpace(snippet.Command) == "" {
+		return "Name and command are required"
+	}
+
+	if snippet.GroupID != nil && *snippet.GroupID == 0 {
+		snippet.GroupID = nil
+	}
+	if snippet.GroupID == nil {
+		return ""
+	}
+
+	member, err := h.GroupRepo.IsMember(ctx, *snippet.GroupID, userID)
+	if err != nil || !member {
+		return "You are not a member of the selected group"
+	}
+	return ""
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/services"
 	"ssh_manager/internal/utils"
 	"strconv"
 	"strings"
@@ -12,6 +16,9 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// sessionPrefix marks a control message with the ID of the attached shell.
+const sessionPrefix = "[SESSION]"
+
 // upgrader socket connection parameters
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:   1024,
@@ -28,12 +35,25 @@ type ResizeMessage struct {
 	Rows int    `json:"rows"`
 }
 
+// SnippetMessage asks to type a saved snippet into the terminal, pressing Enter after it if Execute is set.
+type SnippetMessage struct {
+	Type      string            `json:"type"`
+	SnippetID int               `json:"snippet_id"`
+	Variables map[string]string `json:"variables"`
+	Execute   bool              `json:"execute"`
+}
+
 // SSHWebsocketHandler Handles the upgrade of an HTTP connection to a WebSocket.
 // It connects the browser terminal's I/O stream (xterm.js) to the SSH session.
+// The optional "session" parameter selects the shell to attach to, "new" opens another one.
+// Read-only users have to name a shell that is open already.
 func (h *Handlers) SSHWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 	hostID, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	shellID := r.URL.Query().Get("session")
 	session, _ := h.Store.Get(r, utils.SessionName)
 	userID, _ := session.Values[utils.UserIDKey].(int)
+	user, _ := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	canWrite := user != nil && user.CanWrite()
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -41,36 +61,87 @@ func (h *Handlers) SSHWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
+	// Read-only users only watch open shells, they neither connect, open shells nor trust host keys
+	if !canWrite && (shellID == "" || shellID == "new") {
+		writeTerminalError(conn, "Read-only users cannot open new shells")
+		return
+	}
+	var prompter services.Prompter
+	if canWrite {
+		prompter = &wsPrompter{conn: conn}
+	}
+
 	// We request a session from the service
-	as, err := h.SSHService.GetSession(userID, hostID, r.Context())
+	var as *models.ActiveSession
+	if canWrite {
+		as, err = h.SSHService.GetSession(userID, hostID, r.Context(), prompter)
+	} else if found, ok := h.SSHService.FindSession(userID, hostID); ok {
+		as = found
+	} else {
+		writeTerminalError(conn, "Shell session not found")
+		return
+	}
 	if err != nil {
 		utils.LogErrorf("SSH Connection failed", err, "host_id", hostID)
 
 		displayErr := "SSH Connection Error"
-		if strings.Contains(err.Error(), "unable to authenticate") {
+		var mismatch *services.HostKeyMismatchError
+		if errors.As(err, &mismatch) {
+			displayErr = fmt.Sprintf("WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!\r\n"+
+				"The %s key offered by the server has fingerprint %s,\r\n"+
+				"but the pinned key is %s.\r\n"+
+				"Someone could be eavesdropping on you right now. Connection refused.\r\n"+
+				"If the key was changed on purpose, reset the pinned keys in the host settings.",
+				mismatch.KeyType, mismatch.Fingerprint, strings.Join(mismatch.Expected, ", "))
+		} else if errors.Is(err, services.ErrHostKeyRejected) {
+			displayErr = "Host key was not accepted, connection closed"
+		} else if errors.Is(err, services.ErrHostKeyUnverified) && !canWrite {
+			displayErr = "The host key is not confirmed yet, a user who can write has to connect first"
+		} else if errors.Is(err, services.ErrJumpHostCycle) {
+			displayErr = err.Error()
+		} else if strings.Contains(err.Error(), "unable to authenticate") {
 			displayErr = "Authentication failed: Please check your username and key/password"
 		} else if strings.Contains(err.Error(), "i/o timeout") {
 			displayErr = "Connection timeout: Server is unreachable"
 		}
 
-		errMsg := fmt.Sprintf("\r\n\x1b[31m[SSH Error] %v\x1b[0m\r\n", displayErr)
-		_ = conn.WriteMessage(websocket.TextMessage, []byte(errMsg))
-		// We give a short pause so that the frontend has time to read the message before closing the socket.
-		time.Sleep(100 * time.Millisecond)
+		writeTerminalError(conn, displayErr)
+		return
+	}
 
+	// Attaching to the requested shell of the connection
+	var shell *models.ShellSession
+	if shellID == "new" {
+		shell, err = h.SSHService.OpenShell(userID, hostID, as)
+	} else {
+		shell, err = h.SSHService.GetShell(userID, hostID, as, shellID)
+	}
+	if err != nil {
+		utils.LogErrorf("Failed to open shell", err, "host_id", hostID, "session", shellID)
+		if errors.Is(err, services.ErrShellNotFound) {
+			writeTerminalError(conn, "Shell session not found")
+		} else {
+			writeTerminalError(conn, "Failed to open shell")
+		}
 		return
 	}
 
 	messageChan := make(chan []byte, 256)
 
 	as.Mu.Lock()
-	as.Clients[messageChan] = true
 	as.RefCount++
-	if len(as.OutputBuffer) > 0 {
-		_ = conn.WriteMessage(websocket.TextMessage, as.OutputBuffer)
-	}
 	as.Mu.Unlock()
 
+	// Telling the frontend which shell it is attached to, so that it can reconnect to the same one.
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(sessionPrefix+shell.ID))
+
+	shell.Mu.Lock()
+	shell.Clients[messageChan] = true
+	if len(shell.OutputBuffer) > 0 {
+		_ = conn.WriteMessage(websocket.TextMessage, shell.OutputBuffer)
+	}
+	shell.Mu.Unlock()
+
 	// WebSocket Send Goroutine
 	go func() {
 		for msg := range messageChan {
@@ -87,31 +158,155 @@ func (h *Handlers) SSHWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
+		// Read-only users watch the terminal, neither their input nor their size reaches the PTY
+		if !canWrite {
+			continue
+		}
+
 		var rm ResizeMessage
 		if err := json.Unmarshal(msg, &rm); err == nil && rm.Type == "resize" {
-			as.Mu.Lock()
-			if as.SSHSession != nil {
-				as.SSHSession.WindowChange(rm.Rows, rm.Cols)
+			shell.Mu.Lock()
+			if shell.SSHSession != nil {
+				shell.SSHSession.WindowChange(rm.Rows, rm.Cols)
+			}
+			shell.Mu.Unlock()
+			if shell.Recorder != nil {
+				shell.Recorder.Resize(rm.Cols, rm.Rows)
 			}
-			as.Mu.Unlock()
 			continue
 		}
 
-		as.Mu.Lock()
-		if as.Stdin != nil {
-			as.Stdin.Write(msg)
+		var sm SnippetMessage
+		if err := json.Unmarshal(msg, &sm); err == nil && sm.Type == "snippet" {
+			input, err := h.renderSnippet(r.Context(), userID, sm)
+			if err != nil {
+				// Only the send goroutine writes to the socket, the error is queued like the shell output
+				shell.Mu.Lock()
+				select {
+				case messageChan <- []byte(fmt.Sprintf("\r\n\x1b[31m[Snippet] %v\x1b[0m\r\n", err)):
+				default:
+				}
+				shell.Mu.Unlock()
+				continue
+			}
+			msg = input
+		}
+
+		shell.Mu.Lock()
+		if shell.Stdin != nil {
+			shell.Stdin.Write(msg)
+		}
+		shell.Mu.Unlock()
+		if shell.Recorder != nil {
+			shell.Recorder.Input(msg)
 		}
+
+		as.Mu.Lock()
 		as.LastActivity = time.Now()
 		as.Mu.Unlock()
 	}
 
+	shell.Mu.Lock()
+	delete(shell.Clients, messageChan)
+	shell.Mu.Unlock()
+
 	as.Mu.Lock()
-	delete(as.Clients, messageChan)
 	as.RefCount--
 	as.Mu.Unlock()
 	close(messageChan)
 }
 
+// renderSnippet returns the terminal input of a snippet message.
+func (h *Handlers) renderSnippet(ctx context.Context, userID int, sm SnippetMessage) ([]byte, error) {
+	snippet, err := h.SnippetRepo.GetByID(ctx, sm.SnippetID, userID)
+	if err != nil {
+		return nil, errors.New("snippet not found")
+	}
+	command, err := snippet.Render(sm.Variables)
+	if err != nil {
+		return nil, err
+	}
+	if sm.Execute {
+		command += "\r" // What the Enter key sends
+	}
+	return []byte(command), nil
+}
+
+// writeTerminalError prints an error in the browser terminal before the socket is closed.
+func writeTerminalError(conn *websocket.Conn, message string) {
+	errMsg := fmt.Sprintf("\r\n\x1b[31m[SSH Error] %v\x1b[0m\r\n", message)
+	_ = conn.WriteMessage(websocket.TextMessage, []byte(errMsg))
+	// We give a short pause so that the frontend has time to read the message before closing the socket.
+	time.Sleep(100 * time.Millisecond)
+}
+
+// ListShellsHandler returns the shells opened on the host connection.
+func (h *Handlers) ListShellsHandler(w http.ResponseWriter, r *http.Request) {
+	hostID, err := strconv.Atoi(r.URL.Query().Get("host_id"))
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid host ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID, _ := session.Values[utils.UserIDKey].(int)
+
+	utils.SendJSONResponse(w, true, "Shells retrieved successfully", h.SSHService.ListShells(userID, hostID))
+}
+
+// OpenShellHandler opens one more shell on the host connection (connecting to the host if needed).
+func (h *Handlers) OpenShellHandler(w http.ResponseWriter, r *http.Request) {
+	hostID, err := strconv.Atoi(r.URL.Query().Get("host_id"))
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid host ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID, _ := session.Values[utils.UserIDKey].(int)
+
+	as, err := h.SSHService.GetSession(userID, hostID, r.Context(), nil)
+	if err != nil {
+		utils.LogErrorf("Failed to get SSH session for shell", err, "host_id", hostID)
+		utils.SendJSONResponse(w, false, "SSH connection failed: "+err.Error(), nil)
+		return
+	}
+
+	shell, err := h.SSHService.OpenShell(userID, hostID, as)
+	if err != nil {
+		utils.LogErrorf("Failed to open shell", err, "host_id", hostID)
+		utils.SendJSONResponse(w, false, "Failed to open shell", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Shell opened successfully", services.ShellInfo{
+		ID:        shell.ID,
+		CreatedAt: shell.CreatedAt,
+	})
+}
+
+// CloseShellHandler closes a single shell, the host connection stays alive.
+func (h *Handlers) CloseShellHandler(w http.ResponseWriter, r *http.Request) {
+	hostID, err := strconv.Atoi(r.URL.Query().Get("host_id"))
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid host ID", nil)
+		return
+	}
+	shellID := r.URL.Query().Get("session")
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID, _ := session.Values[utils.UserIDKey].(int)
+
+	if err := h.SSHService.CloseShell(userID, hostID, shellID); err != nil {
+		utils.SendJSONResponse(w, false, err.Error(), nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Shell closed successfully", map[string]interface{}{
+		"id": shellID,
+	})
+}
+
 // TerminateSessionHandler Handles a request to immediately close an SSH connection.
 func (h *Handlers) TerminateSessionHandler(w http.ResponseWriter, r *http.Request) {
 	idParam := r.URL.Query().Get("id")
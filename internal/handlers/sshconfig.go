@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/sshconfig"
+	"ssh_manager/internal/utils"
+)
+
+// Import states of an ssh_config host.
+const (
+	importNew     = "new"
+	importExists  = "exists"
+	importInvalid = "invalid"
+)
+
+// maxSSHConfigSize the largest ssh_config accepted for import.
+const maxSSHConfigSize = 1 << 20
+
+// importCandidate a host of an uploaded ssh_config and how it is going to be imported.
+type importCandidate struct {
+	Alias    string   `json:"alias"`
+	Address  string   `json:"address"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	KeyID    int      `json:"key_id"`
+	KeyName  string   `json:"key_name"`
+	JumpHost string   `json:"jump_host"` // Alias from the same config or the name of an existing host
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings"`
+}
+
+// importRequest body of the import endpoints, Aliases selects the hosts to import (all new ones if empty).
+type importRequest struct {
+	Config  string   `json:"config"`
+	Aliases []string `json:"aliases"`
+	Folder  string   `json:"folder"`
+}
+
+// PreviewSSHConfigHandler shows which hosts of an uploaded ssh_config would be imported and how.
+func (h *Handlers) PreviewSSHConfigHandler(w http.ResponseWriter, r *http.Request) {
+	var req importRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSSHConfigSize)).Decode(&req); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	candidates, warnings, err := h.planImport(r.Context(), userID, req.Config)
+	if err != nil {
+		utils.LogErrorf("Failed to plan ssh_config import", err, "user_id", userID)
+		utils.SendJSONResponse(w, false, "Failed to read the config", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Preview ready", map[string]interface{}{
+		"hosts":    candidates,
+		"warnings": warnings,
+	})
+}
+
+// ImportSSHConfigHandler creates the selected new hosts of an uploaded ssh_config.
+func (h *Handlers) ImportSSHConfigHandler(w http.ResponseWriter, r *http.Request) {
+	var req importRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSSHConfigSize)).Decode(&req); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	candidates, warnings, err := h.planImport(r.Context(), userID, req.Config)
+	if err != nil {
+		utils.LogErrorf("Failed to plan ssh_config import", err, "user_id", userID)
+		utils.SendJSONResponse(w, false, "Failed to read the config", nil)
+		return
+	}
+
+	selected := make(map[string]bool)
+	for _, alias := range req.Aliases {
+		selected[alias] = true
+	}
+
+	// Hosts first, jump hosts afterwards, as they may point to hosts created by this import
+	created := make(map[string]*models.Host)
+	var names []string
+	for _, c := range candidates {
+		if c.Status != importNew || (len(selected) > 0 && !selected[c.Alias]) {
+			continue
+		}
+
+		host := &models.Host{
+			UserID:   userID,
+			Name:     c.Alias,
+			Address:  c.Address,
+			Port:     c.Port,
+			Username: c.Username,
+			AuthType: "password",
+			Folder:   normalizeFolder(req.Folder),
+			Tags:     []string{},
+			Settings: models.HostSettings{DefaultPath: "/"},
+		}
+		if c.KeyID != 0 {
+			keyID := c.KeyID
+			host.AuthType = "key"
+			host.KeyID = &keyID
+		}
+
+		if err := h.HostRepo.Create(r.Context(), host); err != nil {
+			utils.LogErrorf("Failed to import host", err, "user_id", userID, "alias", c.Alias)
+			warnings = append(warnings, fmt.Sprintf("host %s: failed to save", c.Alias))
+			continue
+		}
+		created[c.Alias] = host
+		names = append(names, c.Alias)
+	}
+
+	existing, err := h.hostsByName(r.Context(), userID)
+	if err != nil {
+		utils.LogErrorf("Failed to load hosts", err, "user_id", userID)
+	}
+	for _, c := range candidates {
+		host, ok := created[c.Alias]
+		if !ok || c.JumpHost == "" {
+			continue
+		}
+		jump, ok := created[c.JumpHost]
+		if !ok {
+			jump = existing[strings.ToLower(c.JumpHost)]
+		}
+		if jump == nil {
+			warnings = append(warnings, fmt.Sprintf("host %s: jump host %s was not imported", c.Alias, c.JumpHost))
+			continue
+		}
+
+		jumpID := jump.ID
+		if err := h.SSHService.ValidateJumpHost(r.Context(), userID, host.ID, &jumpID); err != nil {
+			warnings = append(warnings, fmt.Sprintf("host %s: jump host %s: %v", c.Alias, c.JumpHost, err))
+			continue
+		}
+		host.JumpHostID = &jumpID
+		if err := h.HostRepo.Update(r.Context(), host, userID); err != nil {
+			utils.LogErrorf("Failed to set imported jump host", err, "host_id", host.ID)
+			warnings = append(warnings, fmt.Sprintf("host %s: failed to set the jump host", c.Alias))
+		}
+	}
+
+	utils.SendJSONResponse(w, true, fmt.Sprintf("%d hosts imported", len(names)), map[string]interface{}{
+		"imported": names,
+		"warnings": warnings,
+	})
+}
+
+// ExportSSHConfigHandler downloads the user's hosts as an ssh_config. Keys are referenced
+// as ~/.ssh/<key name>, the private keys themselves are not included.
+func (h *Handlers) ExportSSHConfigHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	hosts, err := h.HostRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		utils.LogErrorf("Failed to load hosts for export", err, "user_id", userID)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	keys, err := h.KeyRepo.GetAllByUserID(r.Context(), userID)
+	if err != nil {
+		utils.LogErrorf("Failed to load keys for export", err, "user_id", userID)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	keyNames := make(map[int]string)
+	for _, k := range keys {
+		keyNames[k.ID] = k.Name
+	}
+
+	// Host names become aliases, which can neither contain whitespace nor repeat
+	aliases := make(map[int]string)
+	used := make(map[string]bool)
+	for _, host := range hosts {
+		alias := strings.Join(strings.Fields(host.Name), "-")
+		if alias == "" || used[alias] {
+			alias = fmt.Sprintf("%s-%d", alias, host.ID)
+		}
+		used[alias] = true
+		aliases[host.ID] = alias
+	}
+
+	entries := make([]sshconfig.Entry, 0, len(hosts))
+	for _, host := range hosts {
+		e := sshconfig.Entry{
+			Alias:    aliases[host.ID],
+			HostName: host.Address,
+			User:     host.Username,
+			Port:     host.Port,
+		}
+		if host.AuthType != "password" && host.KeyID != nil {
+			if name, ok := keyNames[*host.KeyID]; ok {
+				e.IdentityFiles = []string{"~/.ssh/" + strings.Join(strings.Fields(name), "_")}
+			}
+		}
+		if host.JumpHostID != nil {
+			e.ProxyJump = aliases[*host.JumpHostID]
+		}
+		entries = append(entries, e)
+	}
+
+	var buf bytes.Buffer
+	if err := sshconfig.Write(&buf, entries); err != nil {
+		http.Error(w, "Failed to write the config", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="ssh_config"`)
+	w.Write(buf.Bytes())
+}
+
+// planImport parses the config and matches its hosts with the user's hosts and keys.
+func (h *Handlers) planImport(ctx context.Context, userID int, config string) ([]importCandidate, []string, error) {
+	entries, warnings, err := sshconfig.Parse(strings.NewReader(config))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existing, err := h.hostsByName(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := h.KeyRepo.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	keysByName := make(map[string]models.Key)
+	for _, k := range keys {
+		keysByName[strings.ToLower(k.Name)] = k
+	}
+
+	aliases := make(map[string]bool)
+	for _, e := range entries {
+		aliases[e.Alias] = true
+	}
+
+	candidates := make([]importCandidate, 0, len(entries))
+	for _, e := range entries {
+		c := importCandidate{
+			Alias:    e.Alias,
+			Address:  e.HostName,
+			Port:     e.Port,
+			Username: e.User,
+			Status:   importNew,
+			Warnings: []string{},
+		}
+
+		switch {
+		case existing[strings.ToLower(e.Alias)] != nil:
+			c.Status = importExists
+			c.Error = "a host with this name already exists"
+		case e.User == "":
+			c.Status = importInvalid
+			c.Error = "User is not set"
+		}
+
+		if key, ok := matchIdentityFile(e.IdentityFiles, keysByName); ok {
+			c.KeyID = key.ID
+			c.KeyName = key.Name
+		} else if len(e.IdentityFiles) > 0 {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("no key named like %s, add the key and set it on the host", path.Base(e.IdentityFiles[0])))
+		} else {
+			c.Warnings = append(c.Warnings, "no IdentityFile, the host is imported with password authentication")
+		}
+
+		if e.ProxyJump != "" {
+			hops := strings.Split(e.ProxyJump, ",")
+			jump := jumpAlias(hops[len(hops)-1])
+			if len(hops) > 1 {
+				c.Warnings = append(c.Warnings, fmt.Sprintf("only the last hop %s of ProxyJump is used, set its own jump host to keep the chain", jump))
+			}
+			if aliases[jump] || existing[strings.ToLower(jump)] != nil {
+				c.JumpHost = jump
+			} else {
+				c.Warnings = append(c.Warnings, fmt.Sprintf("jump host %s is neither in the config nor an existing host and is ignored", jump))
+			}
+		}
+
+		candidates = append(candidates, c)
+	}
+	return candidates, warnings, nil
+}
+
+// hostsByName maps the lower case names of the user's hosts to the hosts.
+func (h *Handlers) hostsByName(ctx context.Context, userID int) (map[string]*models.Host, error) {
+	hosts, err := h.HostRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*models.Host, len(hosts))
+	for i := range hosts {
+		byName[strings.ToLower(hosts[i].Name)] = &hosts[i]
+	}
+	return byName, nil
+}
+
+// matchIdentityFile finds the key named like one of the identity files, "~/.ssh/id_ed25519" matches
+// a key named "id_ed25519" and "deploy.pem" a key named "deploy".
+func matchIdentityFile(files []string, keysByName map[string]models.Key) (models.Key, bool) {
+	for _, file := range files {
+		base := strings.ToLower(path.Base(file))
+		for _, name := range []string{base, strings.TrimSuffix(base, path.Ext(base))} {
+			if key, ok := keysByName[name]; ok {
+				return key, true
+			}
+		}
+	}
+	return models.Key{}, false
+}
+
+// jumpAlias returns the host of a ProxyJump hop, "user@bastion:2222" becomes "bastion".
+func jumpAlias(hop string) string {
+	hop = strings.TrimSpace(hop)
+	if i := strings.LastIndex(hop, "@"); i >= 0 {
+		hop = hop[i+1:]
+	}
+	if strings.HasPrefix(hop, "[") {
+		if i := strings.Index(hop, "]"); i > 0 {
+			return hop[1:i]
+		}
+	}
+	if i := strings.LastIndex(hop, ":"); i >= 0 && strings.Count(hop, ":") == 1 {
+		hop = hop[:i]
+	}
+	return hop
+}
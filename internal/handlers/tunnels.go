@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/services"
+	"ssh_manager/internal/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ListTunnelsHandler returns the user's tunnels of the host with their live state.
+func (h *Handlers) ListTunnelsHandler(w http.ResponseWriter, r *http.Request) {
+	hostID, err := strconv.Atoi(r.URL.Query().Get("host_id"))
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid host ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	tunnels, err := h.TunnelRepo.GetByHostID(r.Context(), hostID, userID)
+	if err != nil {
+		log.Printf("[ERROR] ListTunnelsHandler (hostID: %d): %v", hostID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Tunnels retrieved successfully", h.SSHService.ListTunnels(userID, hostID, tunnels))
+}
+
+// AddTunnelHandler defines a new tunnel for the host.
+func (h *Handlers) AddTunnelHandler(w http.ResponseWriter, r *http.Request) {
+	var tunnel models.Tunnel
+	if err := json.NewDecoder(r.Body).Decode(&tunnel); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+	user, _ := r.Context().Value(utils.CurrentUserKey).(*models.User)
+
+	if _, err := h.HostRepo.GetByID(r.Context(), tunnel.HostID, userID); err != nil {
+		utils.SendJSONResponse(w, false, "Host not found", nil)
+		return
+	}
+	if msg := validateTunnel(&tunnel, user); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
+	tunnel.UserID = userID
+	if err := h.TunnelRepo.Create(r.Context(), &tunnel); err != nil {
+		log.Printf("[ERROR] TunnelRepo.Create (hostID: %d): %v", tunnel.HostID, err)
+		utils.SendJSONResponse(w, false, "Failed to add tunnel", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Tunnel added successfully", tunnel)
+}
+
+// DeleteTunnelHandler deletes a tunnel, it is stopped first if it is running.
+func (h *Handlers) DeleteTunnelHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid tunnel ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	tunnel, err := h.TunnelRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Tunnel not found", nil)
+		return
+	}
+
+	_ = h.SSHService.StopTunnel(userID, tunnel.HostID, tunnel.ID)
+
+	if err := h.TunnelRepo.Delete(r.Context(), id, userID); err != nil {
+		log.Printf("[ERROR] TunnelRepo.Delete (ID: %d): %v", id, err)
+		utils.SendJSONResponse(w, false, "Failed to delete tunnel", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Tunnel deleted successfully", map[string]interface{}{
+		"id": id,
+	})
+}
+
+// StartTunnelHandler starts a tunnel on the host connection (connecting to the host if needed).
+func (h *Handlers) StartTunnelHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid tunnel ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	tunnel, err := h.TunnelRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Tunnel not found", nil)
+		return
+	}
+	user, _ := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	if msg := tunnelPermission(tunnel, user); msg != "" {
+		utils.SendJSONResponse(w, false, msg, nil)
+		return
+	}
+
+	as, err := h.SSHService.GetSession(userID, tunnel.HostID, r.Context(), nil)
+	if err != nil {
+		utils.LogErrorf("Failed to get SSH session for tunnel", err, "host_id", tunnel.HostID, "tunnel_id", id)
+		utils.SendJSONResponse(w, false, "SSH connection failed: "+err.Error(), nil)
+		return
+	}
+
+	if _, err := h.SSHService.StartTunnel(as, *tunnel); err != nil {
+		utils.LogErrorf("Failed to start tunnel", err, "host_id", tunnel.HostID, "tunnel_id", id)
+		if errors.Is(err, services.ErrTunnelRunning) {
+			utils.SendJSONResponse(w, false, "Tunnel is already running", nil)
+		} else {
+			utils.SendJSONResponse(w, false, "Failed to start tunnel: "+err.Error(), nil)
+		}
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Tunnel started successfully", map[string]interface{}{
+		"id": id,
+	})
+}
+
+// StopTunnelHandler stops a running tunnel, the host connection stays alive.
+func (h *Handlers) StopTunnelHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid tunnel ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	tunnel, err := h.TunnelRepo.GetByID(r.Context(), id, userID)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Tunnel not found", nil)
+		return
+	}
+
+	if err := h.SSHService.StopTunnel(userID, tunnel.HostID, tunnel.ID); err != nil {
+		utils.SendJSONResponse(w, false, "Tunnel is not running", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Tunnel stopped successfully", map[string]interface{}{
+		"id": id,
+	})
+}
+
+// validateTunnel checks the tunnel and fills in the defaults. Returns the error message.
+func validateTunnel(t *models.Tunnel, user *models.User) string {
+	t.Name = strings.TrimSpace(t.Name)
+	t.BindAddress = strings.TrimSpace(t.BindAddress)
+	t.TargetHost = strings.TrimSpace(t.TargetHost)
+
+	if t.Direction == "" {
+		t.Direction = models.TunnelLocal
+	}
+	if t.Direction != models.TunnelLocal && t.Direction != models.TunnelRemote {
+		return "Unknown tunnel direction"
+	}
+	if t.BindAddress == "" {
+		t.BindAddress = "127.0.0.1"
+	}
+	if t.TargetHost == "" {
+		return "Target host is required"
+	}
+	if t.BindPort < 1 || t.BindPort > 65535 || t.TargetPort < 1 || t.TargetPort > 65535 {
+		return "Ports must be between 1 and 65535"
+	}
+	if t.Name == "" {
+		t.Name = net.JoinHostPort(t.TargetHost, strconv.Itoa(t.TargetPort))
+	}
+
+	return tunnelPermission(t, user)
+}
+
+// tunnelPermission checks what only admins may do, also when a tunnel is started, the user may have lost
+// the role since. Local tunnels listen on the manager itself, only admins may expose them beyond the
+// loopback interface. Remote tunnels connect from the manager, so they reach into its own network.
+func tunnelPermission(t *models.Tunnel, user *models.User) string {
+	if user != nil && user.IsAdmin() {
+		return ""
+	}
+	if t.Direction == models.TunnelRemote {
+		return "Only admins can use remote tunnels, they connect from the manager's network"
+	}
+	if !isLoopback(t.BindAddress) {
+		return "Only admins can listen on addresses other than localhost"
+	}
+	return ""
+}
+
+// isLoopback reports whether the address is only reachable from the machine itself.
+func isLoopback(address string) bool {
+	if address == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
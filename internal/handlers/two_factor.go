@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssh_manager/internal/auth"
+	"ssh_manager/internal/encryption"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/totp"
+	"ssh_manager/internal/utils"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Two-factor authentication limits.
+const (
+	totpIssuer              = "SSH Manager"
+	pendingLoginTimeout     = 5 * time.Minute // Time to enter the code after the password
+	maxSecondFactorAttempts = 5               // Wrong codes before the password has to be entered again
+	recoveryCodeCount       = 10
+)
+
+// LoginTwoFactorHandler completes a login with a code of the authenticator app or a recovery code.
+func (h *Handlers) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	session, user, attempts, ok := h.pendingLogin(w, r)
+	if !ok {
+		return
+	}
+	// The attempts in the session start again with every password login, the lockout of the username does not
+	reservation, ok := h.reserveLogin(w, r, h.loginAttempt(r, user.Username))
+	if !ok {
+		return
+	}
+
+	message := "Login succesful"
+	var valid bool
+	var err error
+	if user.TOTPEnabled {
+		valid, err = h.checkTOTP(r.Context(), user, requestData.Code)
+	}
+	if err == nil && !valid {
+		valid, err = h.UserRepo.UseRecoveryCode(r.Context(), user.ID, hashRecoveryCode(requestData.Code))
+		if valid {
+			left, _ := h.UserRepo.CountRecoveryCodes(r.Context(), user.ID)
+			message = "Login succesful, " + strconv.Itoa(left) + " recovery codes left"
+		}
+	}
+	if err != nil {
+		log.Printf("[ERROR] LoginTwoFactorHandler (userID: %d): %v", user.ID, err)
+		h.releaseLogin(r.Context(), reservation)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	if !valid {
+		h.loginFailed(r.Context(), reservation, models.FailureSecondFactor)
+		session.Values[utils.PendingAttemptsKey] = attempts + 1
+		_ = session.Save(r, w)
+		utils.SendJSONResponse(w, false, "Invalid code", nil)
+		return
+	}
+
+	h.releaseLogin(r.Context(), reservation)
+	h.completeLogin(w, r, session, user, message)
+}
+
+// pendingLogin returns the user waiting for their second factor, the session and the failed attempts.
+// An expired login is forgotten and answered.
+func (h *Handlers) pendingLogin(w http.ResponseWriter, r *http.Request) (*sessions.Session, *models.User, int, bool) {
+	session, err := h.Store.Get(r, utils.SessionName)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Session error. Please try again later.", nil)
+		return nil, nil, 0, false
+	}
+
+	userID, ok := session.Values[utils.PendingUserIDKey].(int)
+	since, _ := session.Values[utils.PendingSinceKey].(int64)
+	attempts, _ := session.Values[utils.PendingAttemptsKey].(int)
+	var user *models.User
+	if ok && time.Since(time.Unix(since, 0)) <= pendingLoginTimeout && attempts < maxSecondFactorAttempts {
+		user, err = h.UserRepo.GetByID(r.Context(), userID)
+	}
+	if user == nil || err != nil || user.Disabled || !user.HasSecondFactor() {
+		clearPendingLogin(session)
+		_ = session.Save(r, w)
+		utils.SendJSONResponse(w, false, "The login has expired, enter your password again", nil)
+		return nil, nil, 0, false
+	}
+	return session, user, attempts, true
+}
+
+// clearPendingLogin forgets a login waiting for its second factor.
+func clearPendingLogin(session *sessions.Session) {
+	delete(session.Values, utils.PendingUserIDKey)
+	delete(session.Values, utils.PendingSinceKey)
+	delete(session.Values, utils.PendingAttemptsKey)
+	delete(session.Values, utils.WebAuthnSessionKey)
+}
+
+// checkTOTP validates a code of the user's authenticator app, every code is accepted only once.
+func (h *Handlers) checkTOTP(ctx context.Context, user *models.User, code string) (bool, error) {
+	secret, err := encryption.Decrypt(user.TOTPSecret)
+	if err != nil {
+		return false, err
+	}
+	counter, ok := totp.Validate(secret, code, time.Now(), user.TOTPCounter)
+	if !ok {
+		return false, nil
+	}
+	return h.UserRepo.UpdateTOTPCounter(ctx, user.ID, counter)
+}
+
+// SetupTwoFactorHandler starts the enrollment: a new seed is kept in the session until a code confirms it.
+func (h *Handlers) SetupTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	if user.TwoFactorAtProvider() {
+		utils.SendJSONResponse(w, false, "Two-factor authentication is done by your identity provider", nil)
+		return
+	}
+	if user.TOTPEnabled {
+		utils.SendJSONResponse(w, false, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Failed to generate a secret", nil)
+		return
+	}
+	// The session cookie is only signed, the seed must not be readable in it
+	encrypted, err := encryption.Encrypt(secret)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Encryption failed", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	session.Values[utils.TOTPEnrollKey] = encrypted
+	if err := session.Save(r, w); err != nil {
+		utils.SendJSONResponse(w, false, "Session save error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Add the secret to your authenticator app and enter a code", map[string]interface{}{
+		"secret": secret,
+		"uri":    totp.URI(totpIssuer, user.Username, secret),
+	})
+}
+
+// EnableTwoFactorHandler finishes the enrollment with a code of the new seed and returns the recovery codes.
+func (h *Handlers) EnableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	user := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	session, _ := h.Store.Get(r, utils.SessionName)
+	encrypted, ok := session.Values[utils.TOTPEnrollKey].(string)
+	if !ok || user.TOTPEnabled {
+		utils.SendJSONResponse(w, false, "Start the setup first", nil)
+		return
+	}
+	secret, err := encryption.Decrypt(encrypted)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Start the setup again", nil)
+		return
+	}
+
+	counter, valid := totp.Validate(secret, requestData.Code, time.Now(), 0)
+	if !valid {
+		utils.SendJSONResponse(w, false, "Invalid code, check the time of your device", nil)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Failed to generate recovery codes", nil)
+		return
+	}
+	if err := h.UserRepo.SetTOTP(r.Context(), user.ID, encrypted, hashes); err != nil {
+		log.Printf("[ERROR] UserRepo.SetTOTP (ID: %d): %v", user.ID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	// The code used for the setup does not work for a login
+	if _, err := h.UserRepo.UpdateTOTPCounter(r.Context(), user.ID, counter); err != nil {
+		log.Printf("[ERROR] UserRepo.UpdateTOTPCounter (ID: %d): %v", user.ID, err)
+	}
+
+	delete(session.Values, utils.TOTPEnrollKey)
+	_ = session.Save(r, w)
+
+	utils.SendJSONResponse(w, true, "Two-factor authentication is enabled", map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off after checking the password.
+func (h *Handlers) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.checkCurrentPassword(w, r)
+	if !ok {
+		return
+	}
+
+	required, err := h.SettingsRepo.GetBool(r.Context(), models.SettingRequire2FA)
+	if err != nil {
+		log.Printf("[ERROR] SettingsRepo.GetBool (%s): %v", models.SettingRequire2FA, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	// Registered passkeys remain as the second factor
+	if required && user.Passkeys == 0 {
+		utils.SendJSONResponse(w, false, "Two-factor authentication is required by the administrator", nil)
+		return
+	}
+
+	if err := h.UserRepo.SetTOTP(r.Context(), user.ID, "", nil); err != nil {
+		log.Printf("[ERROR] UserRepo.SetTOTP (ID: %d): %v", user.ID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	utils.SendJSONResponse(w, true, "Two-factor authentication is disabled", nil)
+}
+
+// RegenerateRecoveryCodesHandler replaces the recovery codes after checking the password.
+func (h *Handlers) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.checkCurrentPassword(w, r)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		utils.SendJSONResponse(w, false, "Two-factor authentication is not enabled", nil)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Failed to generate recovery codes", nil)
+		return
+	}
+	if err := h.UserRepo.ReplaceRecoveryCodes(r.Context(), user.ID, hashes); err != nil {
+		log.Printf("[ERROR] UserRepo.ReplaceRecoveryCodes (ID: %d): %v", user.ID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	utils.SendJSONResponse(w, true, "New recovery codes were generated, the old ones no longer work", map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// checkCurrentPassword reads the password from the request and compares it with the one of the current
+// user, the response is sent if it does not match.
+func (h *Handlers) checkCurrentPassword(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	var requestData struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return nil, false
+	}
+
+	user := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	if !h.passwordMatches(r.Context(), user, requestData.Password) {
+		utils.SendJSONResponse(w, false, "Wrong password", nil)
+		return nil, false
+	}
+	return user, true
+}
+
+// passwordMatches checks the password with the provider of the user, a directory must confirm the same account.
+func (h *Handlers) passwordMatches(ctx context.Context, user *models.User, password string) bool {
+	if user.IsLocal() {
+		return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+	}
+	for _, provider := range h.AuthProviders {
+		if provider.Name() != user.AuthProvider {
+			continue
+		}
+		identity, err := provider.Authenticate(ctx, user.Username, password)
+		if err != nil {
+			if !errors.Is(err, auth.ErrInvalidCredentials) {
+				utils.LogErrorf("Authentication failed", err, "provider", provider.Name(), "username", user.Username)
+			}
+			return false
+		}
+		return identity.Subject == user.ExternalID
+	}
+	return false
+}
+
+// RequireTwoFactorHandler makes two-factor authentication mandatory for all users or optional again.
+func (h *Handlers) RequireTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Required bool `json:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	if err := h.SettingsRepo.Set(r.Context(), models.SettingRequire2FA, strconv.FormatBool(requestData.Required)); err != nil {
+		log.Printf("[ERROR] SettingsRepo.Set (%s): %v", models.SettingRequire2FA, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	message := "Two-factor authentication is optional"
+	if requestData.Required {
+		message = "Two-factor authentication is required, users without it have to set it up first"
+	}
+	utils.SendJSONResponse(w, true, message, nil)
+}
+
+// ResetUserTwoFactorHandler turns two-factor authentication off and revokes the passkeys of a user who lost their device.
+func (h *Handlers) ResetUserTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid user ID", nil)
+		return
+	}
+	if _, err := h.UserRepo.GetByID(r.Context(), id); err != nil {
+		utils.SendJSONResponse(w, false, "User not found", nil)
+		return
+	}
+
+	if err := h.UserRepo.SetTOTP(r.Context(), id, "", nil); err != nil {
+		log.Printf("[ERROR] UserRepo.SetTOTP (ID: %d): %v", id, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	if err := h.WebAuthnRepo.DeleteByUserID(r.Context(), id); err != nil {
+		log.Printf("[ERROR] WebAuthnRepo.DeleteByUserID (ID: %d): %v", id, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	utils.SendJSONResponse(w, true, "Two-factor authentication was reset", nil)
+}
+
+// newRecoveryCodes generates the recovery codes shown to the user and the hashes that are stored.
+func newRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code, dashes, spaces and case are ignored.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"ssh_manager/internal/auth"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UsersHandler displays the user administration page.
+func (h *Handlers) UsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := h.UserRepo.GetAll(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] UsersHandler: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	require2FA, err := h.SettingsRepo.GetBool(r.Context(), models.SettingRequire2FA)
+	if err != nil {
+		log.Printf("[ERROR] UsersHandler - SettingsRepo.GetBool: %v", err)
+	}
+
+	lockouts, err := h.activeLockouts(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] UsersHandler - activeLockouts: %v", err)
+	}
+	failures, err := h.LoginRepo.GetRecentFailures(r.Context(), recentFailureCount)
+	if err != nil {
+		log.Printf("[ERROR] UsersHandler - GetRecentFailures: %v", err)
+	}
+	// The lockout of each user by ID, for the status column
+	lockedUsers := map[int]*models.LoginLockout{}
+	for i, l := range lockouts {
+		if l.Kind != models.LockoutUser {
+			continue
+		}
+		for _, u := range users {
+			if auth.NormalizeUsername(u.Username) == l.Subject {
+				lockedUsers[u.ID] = &lockouts[i]
+			}
+		}
+	}
+
+	utils.RenderTemplate(w, "users.html", map[string]interface{}{
+		"Title":        "Users",
+		"Users":        users,
+		"Roles":        []string{models.RoleAdmin, models.RoleOperator, models.RoleReadOnly},
+		"Require2FA":   require2FA,
+		"LockedUsers":  lockedUsers,
+		"Lockouts":     lockouts,
+		"FailedLogins": failures,
+		"ShowMenu":     true,
+	}, r)
+}
+
+// ListUsersHandler returns all users.
+func (h *Handlers) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := h.UserRepo.GetAll(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] ListUsersHandler: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "Users retrieved successfully", users)
+}
+
+// AddUserHandler creates a new user.
+func (h *Handlers) AddUserHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	username := strings.TrimSpace(requestData.Username)
+	if username == "" || requestData.Password == "" {
+		utils.SendJSONResponse(w, false, "Username and password are required", nil)
+		return
+	}
+	if !models.ValidRole(requestData.Role) {
+		utils.SendJSONResponse(w, false, "Unknown role", nil)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(requestData.Password), bcrypt.DefaultCost)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Password hashing error", nil)
+		return
+	}
+
+	user := &models.User{
+		Username:     username,
+		PasswordHash: string(hash),
+		Role:         requestData.Role,
+	}
+	if err := h.UserRepo.Create(r.Context(), user); err != nil {
+		log.Printf("[ERROR] UserRepo.Create (%s): %v", username, err)
+		utils.SendJSONResponse(w, false, "Failed to create user, the name may be taken", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "User created successfully", user)
+}
+
+// EditUserHandler changes the role of a user and enables or disables the account.
+func (h *Handlers) EditUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid user ID", nil)
+		return
+	}
+
+	var requestData struct {
+		Role     string `json:"role"`
+		Disabled bool   `json:"disabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+	if !models.ValidRole(requestData.Role) {
+		utils.SendJSONResponse(w, false, "Unknown role", nil)
+		return
+	}
+
+	user, err := h.UserRepo.GetByID(r.Context(), id)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "User not found", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	if id == session.Values[utils.UserIDKey].(int) && (requestData.Disabled || requestData.Role != models.RoleAdmin) {
+		utils.SendJSONResponse(w, false, "You cannot disable yourself or give up your own admin role", nil)
+		return
+	}
+
+	losesAdmin := user.IsAdmin() && !user.Disabled && (requestData.Role != models.RoleAdmin || requestData.Disabled)
+	if losesAdmin && !h.hasOtherAdmins(r, w) {
+		return
+	}
+
+	if err := h.UserRepo.UpdateAccess(r.Context(), id, requestData.Role, requestData.Disabled); err != nil {
+		log.Printf("[ERROR] UserRepo.UpdateAccess (ID: %d): %v", id, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	// A disabled or demoted user must not keep working in already opened terminals, tunnels and proxies
+	losesWrite := user.CanWrite() && !(&models.User{Role: requestData.Role}).CanWrite()
+	if requestData.Disabled || losesWrite {
+		h.SSHService.TerminateUserSessions(id)
+	}
+
+	utils.SendJSONResponse(w, true, "User updated successfully", map[string]interface{}{
+		"id":       id,
+		"role":     requestData.Role,
+		"disabled": requestData.Disabled,
+	})
+}
+
+// ResetUserPasswordHandler sets a new password for a user and ends their sessions.
+func (h *Handlers) ResetUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid user ID", nil)
+		return
+	}
+
+	var requestData struct {
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.NewPassword == "" {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+
+	user, err := h.UserRepo.GetByID(r.Context(), id)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "User not found", nil)
+		return
+	}
+	if !user.IsLocal() {
+		utils.SendJSONResponse(w, false, "The password of the user is managed by their identity provider", nil)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(requestData.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Password hashing error", nil)
+		return
+	}
+
+	if err := h.UserRepo.UpdatePassword(r.Context(), id, string(hash)); err != nil {
+		log.Printf("[ERROR] UserRepo.UpdatePassword (ID: %d): %v", id, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	// The new password also logs the user out, open terminals included
+	h.SSHService.TerminateUserSessions(id)
+
+	utils.SendJSONResponse(w, true, "Password reset successfully", nil)
+}
+
+// DeleteUserHandler deletes a user with their hosts and keys.
+func (h *Handlers) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid user ID", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	if id == session.Values[utils.UserIDKey].(int) {
+		utils.SendJSONResponse(w, false, "You cannot delete yourself", nil)
+		return
+	}
+
+	user, err := h.UserRepo.GetByID(r.Context(), id)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "User not found", nil)
+		return
+	}
+	if user.IsAdmin() && !user.Disabled && !h.hasOtherAdmins(r, w) {
+		return
+	}
+
+	h.SSHService.TerminateUserSessions(id)
+
+	if err := h.UserRepo.Delete(r.Context(), id); err != nil {
+		log.Printf("[ERROR] UserRepo.Delete (ID: %d): %v", id, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	utils.SendJSONResponse(w, true, "User deleted successfully", map[string]interface{}{
+		"id": id,
+	})
+}
+
+// hasOtherAdmins makes sure that the last active admin is not removed, the response is sent if not.
+func (h *Handlers) hasOtherAdmins(r *http.Request, w http.ResponseWriter) bool {
+	count, err := h.UserRepo.CountActiveAdmins(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] UserRepo.CountActiveAdmins: %v", err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return false
+	}
+	if count <= 1 {
+		utils.SendJSONResponse(w, false, "At least one active admin must remain", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/utils"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+// Ceremonies kept in the session between the begin and the finish request.
+const (
+	webAuthnRegister     = "register"
+	webAuthnLogin        = "login"         // Passkey instead of the password
+	webAuthnSecondFactor = "second_factor" // Passkey after the password
+)
+
+// maxPasskeyNameLength the longest name of a credential.
+const maxPasskeyNameLength = 64
+
+// errPasskeyCloned is returned when the sign counter of a credential goes backwards.
+var errPasskeyCloned = errors.New("the authenticator may have been cloned")
+
+// webAuthnUser adapts a user and their stored credentials to the webauthn library.
+type webAuthnUser struct {
+	user        *models.User
+	stored      []models.WebAuthnCredential
+	credentials []webauthn.Credential
+}
+
+// WebAuthnID the user handle, the ID of the user.
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return userHandle(u.user.ID)
+}
+
+// WebAuthnName the name shown by the authenticator.
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+// WebAuthnDisplayName the name shown by the authenticator.
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+// WebAuthnCredentials the credentials the user can log in with.
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// storedID returns the row ID of the credential.
+func (u *webAuthnUser) storedID(credentialID []byte) int {
+	id := base64.RawURLEncoding.EncodeToString(credentialID)
+	for _, c := range u.stored {
+		if c.CredentialID == id {
+			return c.ID
+		}
+	}
+	return 0
+}
+
+// userHandle encodes the user ID as the WebAuthn user handle.
+func userHandle(userID int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(userID))
+	return b
+}
+
+// loadWebAuthnUser loads the credentials of the user.
+func (h *Handlers) loadWebAuthnUser(ctx context.Context, user *models.User) (*webAuthnUser, error) {
+	stored, err := h.WebAuthnRepo.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	wu := &webAuthnUser{user: user, stored: stored}
+	for _, c := range stored {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(c.Data, &credential); err != nil {
+			return nil, err
+		}
+		wu.credentials = append(wu.credentials, credential)
+	}
+	return wu, nil
+}
+
+// webAuthn returns the relying party. It is configured with WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS,
+// without them the host the browser uses is taken.
+func (h *Handlers) webAuthn(r *http.Request) (*webauthn.WebAuthn, error) {
+	if h.WebAuthn != nil {
+		return h.WebAuthn, nil
+	}
+
+	hostname := r.Host
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		hostname = host
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          hostname,
+		RPDisplayName: totpIssuer,
+		RPOrigins:     []string{scheme + "://" + r.Host},
+	})
+}
+
+// saveWebAuthnSession keeps the ceremony data in the session until the browser answers.
+func saveWebAuthnSession(w http.ResponseWriter, r *http.Request, session *sessions.Session, ceremony string, data *webauthn.SessionData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	session.Values[utils.WebAuthnSessionKey] = ceremony + ":" + string(b)
+	return session.Save(r, w)
+}
+
+// takeWebAuthnSession returns the data of the ceremony and removes it, every challenge is answered only once.
+func takeWebAuthnSession(session *sessions.Session, ceremony string) (*webauthn.SessionData, bool) {
+	value, _ := session.Values[utils.WebAuthnSessionKey].(string)
+	delete(session.Values, utils.WebAuthnSessionKey)
+
+	data, ok := strings.CutPrefix(value, ceremony+":")
+	if !ok {
+		return nil, false
+	}
+	var sd webauthn.SessionData
+	if err := json.Unmarshal([]byte(data), &sd); err != nil {
+		return nil, false
+	}
+	return &sd, true
+}
+
+// saveLoginCredential stores the sign counter after a login and refuses credentials that look cloned.
+func (h *Handlers) saveLoginCredential(ctx context.Context, wu *webAuthnUser, credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		return errPasskeyCloned
+	}
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	return h.WebAuthnRepo.UpdateAfterLogin(ctx, wu.storedID(credential.ID), data)
+}
+
+// BeginPasskeyRegistrationHandler returns the options for navigator.credentials.create.
+func (h *Handlers) BeginPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		utils.SendJSONResponse(w, false, "Invalid request data", nil)
+		return
+	}
+	name := strings.TrimSpace(requestData.Name)
+	if name == "" || len(name) > maxPasskeyNameLength {
+		utils.SendJSONResponse(w, false, "Enter a name of up to 64 characters", nil)
+		return
+	}
+
+	wa, err := h.webAuthn(r)
+	if err != nil {
+		utils.LogErrorf("Invalid WebAuthn configuration", err)
+		utils.SendJSONResponse(w, false, "Passkeys are not configured correctly", nil)
+		return
+	}
+
+	user := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	// A passkey must not bypass the identity provider
+	if user.TwoFactorAtProvider() {
+		utils.SendJSONResponse(w, false, "Your account is managed by the identity provider", nil)
+		return
+	}
+	wu, err := h.loadWebAuthnUser(r.Context(), user)
+	if err != nil {
+		log.Printf("[ERROR] loadWebAuthnUser (userID: %d): %v", user.ID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	// A discoverable credential also works without the password
+	creation, sd, err := wa.BeginRegistration(wu,
+		webauthn.WithExclusions(webauthn.Credentials(wu.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		utils.LogErrorf("Failed to begin passkey registration", err, "user_id", user.ID)
+		utils.SendJSONResponse(w, false, "Failed to start the registration", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	session.Values[utils.WebAuthnNameKey] = name
+	if err := saveWebAuthnSession(w, r, session, webAuthnRegister, sd); err != nil {
+		utils.SendJSONResponse(w, false, "Session save error", nil)
+		return
+	}
+	utils.SendJSONResponse(w, true, "Confirm with your authenticator", creation)
+}
+
+// FinishPasskeyRegistrationHandler verifies the new credential and stores it.
+func (h *Handlers) FinishPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	wa, err := h.webAuthn(r)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Passkeys are not configured correctly", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	sd, ok := takeWebAuthnSession(session, webAuthnRegister)
+	name, _ := session.Values[utils.WebAuthnNameKey].(string)
+	delete(session.Values, utils.WebAuthnNameKey)
+	_ = session.Save(r, w)
+	if !ok {
+		utils.SendJSONResponse(w, false, "Start the registration again", nil)
+		return
+	}
+
+	user := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	wu, err := h.loadWebAuthnUser(r.Context(), user)
+	if err != nil {
+		log.Printf("[ERROR] loadWebAuthnUser (userID: %d): %v", user.ID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	credential, err := wa.FinishRegistration(wu, *sd, r)
+	if err != nil {
+		utils.LogErrorf("Passkey registration failed", err, "user_id", user.ID)
+		utils.SendJSONResponse(w, false, "The passkey could not be verified", nil)
+		return
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Failed to save the passkey", nil)
+		return
+	}
+	stored := &models.WebAuthnCredential{
+		UserID:       user.ID,
+		Name:         name,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Data:         data,
+	}
+	if err := h.WebAuthnRepo.Create(r.Context(), stored); err != nil {
+		log.Printf("[ERROR] WebAuthnRepo.Create (userID: %d): %v", user.ID, err)
+		utils.SendJSONResponse(w, false, "Failed to save the passkey, it may be registered already", nil)
+		return
+	}
+	utils.SendJSONResponse(w, true, "Passkey registered", stored)
+}
+
+// ListPasskeysHandler returns the credentials of the current user.
+func (h *Handlers) ListPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.Store.Get(r, utils.SessionName)
+	userID := session.Values[utils.UserIDKey].(int)
+
+	credentials, err := h.WebAuthnRepo.GetByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] WebAuthnRepo.GetByUserID (userID: %d): %v", userID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	if credentials == nil {
+		credentials = []models.WebAuthnCredential{}
+	}
+	utils.SendJSONResponse(w, true, "Passkeys retrieved successfully", credentials)
+}
+
+// DeletePasskeyHandler revokes a credential of the current user.
+func (h *Handlers) DeletePasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Invalid passkey ID", nil)
+		return
+	}
+
+	// The last second factor cannot be removed while 2FA is required
+	user := r.Context().Value(utils.CurrentUserKey).(*models.User)
+	if !user.TOTPEnabled && user.Passkeys <= 1 {
+		required, err := h.SettingsRepo.GetBool(r.Context(), models.SettingRequire2FA)
+		if err != nil || required {
+			utils.SendJSONResponse(w, false, "Two-factor authentication is required by the administrator, keep at least one passkey or set up an authenticator app", nil)
+			return
+		}
+	}
+
+	deleted, err := h.WebAuthnRepo.Delete(r.Context(), id, user.ID)
+	if err != nil {
+		log.Printf("[ERROR] WebAuthnRepo.Delete (ID: %d): %v", id, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	if !deleted {
+		utils.SendJSONResponse(w, false, "Passkey not found", nil)
+		return
+	}
+	utils.SendJSONResponse(w, true, "Passkey revoked", nil)
+}
+
+// BeginPasskeyLoginHandler returns the options for navigator.credentials.get for a login without a password.
+func (h *Handlers) BeginPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if h.DisableLocalLogin {
+		utils.SendJSONResponse(w, false, "Passkey login is disabled, sign in with your directory or single sign-on account", nil)
+		return
+	}
+	wa, err := h.webAuthn(r)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Passkeys are not configured correctly", nil)
+		return
+	}
+
+	// Without the password the authenticator has to verify the user (PIN, biometrics)
+	assertion, sd, err := wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		utils.LogErrorf("Failed to begin passkey login", err)
+		utils.SendJSONResponse(w, false, "Failed to start the login", nil)
+		return
+	}
+
+	session, _ := h.Store.Get(r, utils.SessionName)
+	if err := saveWebAuthnSession(w, r, session, webAuthnLogin, sd); err != nil {
+		utils.SendJSONResponse(w, false, "Session error. Please try again later.", nil)
+		return
+	}
+	utils.SendJSONResponse(w, true, "Confirm with your passkey", assertion)
+}
+
+// FinishPasskeyLoginHandler logs the owner of the passkey in.
+func (h *Handlers) FinishPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	wa, err := h.webAuthn(r)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Passkeys are not configured correctly", nil)
+		return
+	}
+
+	session, err := h.Store.Get(r, utils.SessionName)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Session error. Please try again later.", nil)
+		return
+	}
+	sd, ok := takeWebAuthnSession(session, webAuthnLogin)
+	if !ok {
+		_ = session.Save(r, w)
+		utils.SendJSONResponse(w, false, "The login has expired, try again", nil)
+		return
+	}
+
+	var wu *webAuthnUser
+	findUser := func(rawID, handle []byte) (webauthn.User, error) {
+		stored, err := h.WebAuthnRepo.GetByCredentialID(r.Context(), base64.RawURLEncoding.EncodeToString(rawID))
+		if err != nil {
+			return nil, err
+		}
+		user, err := h.UserRepo.GetByID(r.Context(), stored.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if wu, err = h.loadWebAuthnUser(r.Context(), user); err != nil {
+			return nil, err
+		}
+		return wu, nil
+	}
+
+	_, credential, err := wa.FinishPasskeyLogin(findUser, *sd, r)
+	if err == nil {
+		err = h.saveLoginCredential(r.Context(), wu, credential)
+	}
+	if err != nil {
+		utils.LogErrorf("Passkey login failed", err)
+		_ = session.Save(r, w)
+		utils.SendJSONResponse(w, false, "The passkey could not be verified", nil)
+		return
+	}
+	if wu.user.Disabled || !wu.user.IsLocal() {
+		_ = session.Save(r, w)
+		utils.SendJSONResponse(w, false, "Account is disabled", nil)
+		return
+	}
+
+	h.completeLogin(w, r, session, wu.user, "Login succesful")
+}
+
+// BeginPasskeySecondFactorHandler returns the options for navigator.credentials.get after the password.
+func (h *Handlers) BeginPasskeySecondFactorHandler(w http.ResponseWriter, r *http.Request) {
+	session, user, _, ok := h.pendingLogin(w, r)
+	if !ok {
+		return
+	}
+
+	wa, err := h.webAuthn(r)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Passkeys are not configured correctly", nil)
+		return
+	}
+	wu, err := h.loadWebAuthnUser(r.Context(), user)
+	if err != nil {
+		log.Printf("[ERROR] loadWebAuthnUser (userID: %d): %v", user.ID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+	if len(wu.credentials) == 0 {
+		utils.SendJSONResponse(w, false, "No passkey is registered, enter a code", nil)
+		return
+	}
+
+	assertion, sd, err := wa.BeginLogin(wu)
+	if err != nil {
+		utils.LogErrorf("Failed to begin passkey login", err, "user_id", user.ID)
+		utils.SendJSONResponse(w, false, "Failed to start the login", nil)
+		return
+	}
+	if err := saveWebAuthnSession(w, r, session, webAuthnSecondFactor, sd); err != nil {
+		utils.SendJSONResponse(w, false, "Session error. Please try again later.", nil)
+		return
+	}
+	utils.SendJSONResponse(w, true, "Confirm with your passkey", assertion)
+}
+
+// FinishPasskeySecondFactorHandler completes a login with a passkey after the password.
+func (h *Handlers) FinishPasskeySecondFactorHandler(w http.ResponseWriter, r *http.Request) {
+	session, user, attempts, ok := h.pendingLogin(w, r)
+	if !ok {
+		return
+	}
+
+	wa, err := h.webAuthn(r)
+	if err != nil {
+		utils.SendJSONResponse(w, false, "Passkeys are not configured correctly", nil)
+		return
+	}
+	sd, found := takeWebAuthnSession(session, webAuthnSecondFactor)
+	if !found {
+		_ = session.Save(r, w)
+		utils.SendJSONResponse(w, false, "Start the passkey login again", nil)
+		return
+	}
+	wu, err := h.loadWebAuthnUser(r.Context(), user)
+	if err != nil {
+		log.Printf("[ERROR] loadWebAuthnUser (userID: %d): %v", user.ID, err)
+		utils.SendJSONResponse(w, false, "Database error", nil)
+		return
+	}
+
+	credential, err := wa.FinishLogin(wu, *sd, r)
+	if err == nil {
+		err = h.saveLoginCredential(r.Context(), wu, credential)
+	}
+	if err != nil {
+		utils.LogErrorf("Passkey second factor failed", err, "user_id", user.ID)
+		session.Values[utils.PendingAttemptsKey] = attempts + 1
+		_ = session.Save(r, w)
+		utils.SendJSONResponse(w, false, "The passkey could not be verified", nil)
+		return
+	}
+
+	h.completeLogin(w, r, session, user, "Login succesful")
+}
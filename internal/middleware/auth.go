@@ -1,14 +1,31 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/repository"
 	"ssh_manager/internal/utils"
+	"strings"
 
 	"github.com/gorilla/sessions"
 )
 
 type Middleware struct {
-	Store *sessions.CookieStore
+	Store        *sessions.CookieStore
+	UserRepo     *repository.UserRepository
+	SettingsRepo *repository.SettingsRepository
+}
+
+// twoFactorSetupPaths stay open to users who have to set up two-factor authentication first.
+var twoFactorSetupPaths = map[string]bool{
+	"/profile":                 true,
+	"/profile/2fa/setup":       true,
+	"/profile/2fa/enable":      true,
+	"/profile/passkeys":        true,
+	"/profile/passkeys/begin":  true,
+	"/profile/passkeys/finish": true,
+	"/logout":                  true,
 }
 
 // AuthMiddleware checks whether the user is authorized.
@@ -28,7 +45,67 @@ func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// The account may have been disabled or deleted since the login, or its password changed
+		userID, _ := session.Values[utils.UserIDKey].(int)
+		sessionVersion, _ := session.Values[utils.SessionVersionKey].(int)
+		user, err := m.UserRepo.GetByID(r.Context(), userID)
+		if err != nil || user.Disabled || user.SessionVersion != sessionVersion {
+			session.Values[utils.IsAuthenticated] = false
+			_ = session.Save(r, w)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		// Enforced 2FA: without it only the setup on the profile page is reachable.
+		// Users of a single sign-on provider confirm their second factor there.
+		if !user.TwoFactorAtProvider() && !user.HasSecondFactor() && !twoFactorSetupPaths[r.URL.Path] {
+			required, err := m.SettingsRepo.GetBool(r.Context(), models.SettingRequire2FA)
+			if err != nil || required {
+				if err != nil {
+					utils.LogErrorf("Failed to read the 2FA policy", err)
+				}
+				if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+					http.Redirect(w, r, "/profile", http.StatusSeeOther)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				utils.SendJSONResponse(w, false, "Set up two-factor authentication on the profile page first", nil)
+				return
+			}
+		}
+
 		// If authorization is successful, we call the next handler
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), utils.CurrentUserKey, user)))
 	})
 }
+
+// RequireRole allows the request only for users with one of the roles.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := r.Context().Value(utils.CurrentUserKey).(*models.User)
+			if ok {
+				for _, role := range roles {
+					if user.Role == role {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			// Pages opened in the browser get the error page, fetch calls get JSON
+			if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				w.WriteHeader(http.StatusForbidden)
+				utils.RenderTemplate(w, "4xx.html", map[string]interface{}{
+					"Title": "Access Denied",
+					"Code":  "403",
+				}, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			utils.SendJSONResponse(w, false, "Access denied", nil)
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Group a team whose members share hosts and keys.
+type Group struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Members   []User    `json:"members,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
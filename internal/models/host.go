@@ -9,7 +9,11 @@ import (
 
 // HostSettings Contains settings specific to SFTP and other features.
 type HostSettings struct {
-	DefaultPath string `json:"default_path"` // Папка, которая откроется первой
+	DefaultPath    string `json:"default_path"`    // Папка, которая откроется первой
+	RecordSessions bool   `json:"record_sessions"` // Terminal sessions are recorded for audit
+	// SSH agent with the host key (and AgentKeyIDs) is forwarded to the host, e.g. for git
+	AgentForwarding bool  `json:"agent_forwarding"`
+	AgentKeyIDs     []int `json:"agent_key_ids,omitempty"` // Additional keys offered by the forwarded agent
 }
 
 // Value to write to the database.
@@ -37,15 +41,23 @@ func (s *HostSettings) Scan(value interface{}) error {
 
 // Host host model.
 type Host struct {
-	ID        int          `json:"id"`
-	UserID    int          `json:"user_id"`
-	Name      string       `json:"name"`
-	Address   string       `json:"address"`
-	Username  string       `json:"username"`
-	Port      int          `json:"port,string"`
-	AuthType  string       `json:"auth_type"`
-	Password  string       `json:"password,omitempty"`
-	KeyID     *int         `json:"key_id,string"`
-	Settings  HostSettings `json:"settings"`
-	CreatedAt time.Time    `json:"created_at"`
+	ID         int          `json:"id"`
+	UserID     int          `json:"user_id"`
+	Name       string       `json:"name"`
+	Address    string       `json:"address"`
+	Username   string       `json:"username"`
+	Port       int          `json:"port,string"`
+	AuthType   string       `json:"auth_type"`
+	Password   string       `json:"password,omitempty"`
+	TOTPSecret string       `json:"totp_secret,omitempty"` // Encrypted seed for one-time code prompts
+	HasTOTP    bool         `json:"has_totp"`              // Set in responses instead of the seed
+	KeyID      *int         `json:"key_id,string"`
+	JumpHostID *int         `json:"jump_host_id,string"` // Bastion the host is reached through
+	GroupID    *int         `json:"group_id,string"`     // Group the host is shared with
+	GroupName  string       `json:"group_name,omitempty"`
+	Folder     string       `json:"folder"` // Slash separated path like "prod/db", empty for the top level
+	Tags       []string     `json:"tags"`
+	Settings   HostSettings `json:"settings"`
+	HostKeys   []HostKey    `json:"host_keys,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
 }
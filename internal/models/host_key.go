@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// HostKey is a server public key pinned to a host on the first connection.
+type HostKey struct {
+	ID          int       `json:"id"`
+	HostID      int       `json:"host_id"`
+	KeyType     string    `json:"key_type"`
+	Fingerprint string    `json:"fingerprint"`
+	PublicKey   string    `json:"public_key"`
+	FirstSeen   time.Time `json:"first_seen"`
+}
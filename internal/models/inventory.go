@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// How secrets are written to an inventory export.
+const (
+	SecretsOmitted    = "omitted"
+	SecretsPassphrase = "passphrase" // Encrypted with a passphrase of the user, never with the server key
+)
+
+// Inventory hosts and keys moved between managers. Everything refers to each other by name,
+// as IDs differ from server to server.
+type Inventory struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Secrets    string          `json:"secrets"`
+	Keys       []InventoryKey  `json:"keys"`
+	Hosts      []InventoryHost `json:"hosts"`
+}
+
+// InventoryKey a key of an inventory.
+type InventoryKey struct {
+	Name           string `json:"name"`
+	Group          string `json:"group,omitempty"`
+	PrivateKey     string `json:"private_key,omitempty"`
+	PassphraseMode string `json:"passphrase_mode,omitempty"`
+	Passphrase     string `json:"passphrase,omitempty"` // Of the private key, a secret like it
+}
+
+// InventoryHost a host of an inventory.
+type InventoryHost struct {
+	Name            string   `json:"name"`
+	Address         string   `json:"address"`
+	Port            int      `json:"port"`
+	Username        string   `json:"username"`
+	AuthType        string   `json:"auth_type"`
+	Password        string   `json:"password,omitempty"`
+	Key             string   `json:"key,omitempty"`
+	JumpHost        string   `json:"jump_host,omitempty"`
+	Group           string   `json:"group,omitempty"`
+	Folder          string   `json:"folder,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	DefaultPath     string   `json:"default_path,omitempty"`
+	RecordSessions  bool     `json:"record_sessions,omitempty"`
+	AgentForwarding bool     `json:"agent_forwarding,omitempty"`
+	AgentKeys       []string `json:"agent_keys,omitempty"`
+	TOTPSecret      string   `json:"totp_secret,omitempty"` // A secret like the password
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Job statuses.
+const (
+	JobRunning     = "running"
+	JobFinished    = "finished"
+	JobInterrupted = "interrupted" // The server stopped while the job was running
+)
+
+// Job result statuses of a single host.
+const (
+	ResultPending = "pending"
+	ResultRunning = "running"
+	ResultSuccess = "success" // Exit code 0
+	ResultFailed  = "failed"  // Non-zero exit code
+	ResultTimeout = "timeout"
+	ResultError   = "error" // The command could not be run, e.g. the host is unreachable
+)
+
+// Job a command run on several hosts at once.
+type Job struct {
+	ID             int         `json:"id"`
+	UserID         int         `json:"user_id"`
+	Command        string      `json:"command"`
+	Status         string      `json:"status"`
+	Parallelism    int         `json:"parallelism"`
+	TimeoutSeconds int         `json:"timeout_seconds"`
+	CreatedAt      time.Time   `json:"created_at"`
+	FinishedAt     *time.Time  `json:"finished_at"`
+	Results        []JobResult `json:"results,omitempty"`
+}
+
+// JobResult outcome of a job on one host.
+type JobResult struct {
+	ID         int        `json:"id"`
+	JobID      int        `json:"job_id"`
+	HostID     int        `json:"host_id"`
+	HostName   string     `json:"host_name"`
+	Status     string     `json:"status"`
+	ExitCode   *int       `json:"exit_code"`
+	Stdout     string     `json:"stdout"`
+	Stderr     string     `json:"stderr"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
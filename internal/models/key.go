@@ -2,11 +2,24 @@ package models
 
 import "time"
 
+// How the passphrase of a protected key is provided.
+const (
+	PassphraseStored = "stored" // Kept encrypted with the key
+	PassphrasePrompt = "prompt" // Asked for on every connection, never stored
+)
+
 // Key represents a private key model.
 type Key struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Name      string    `json:"name"`
-	KeyData   string    `json:"key_data"`
-	CreatedAt time.Time `json:"created_at"`
+	ID             int       `json:"id"`
+	UserID         int       `json:"user_id"`
+	Name           string    `json:"name"`
+	KeyData        string    `json:"key_data"`
+	PublicKey      string    `json:"public_key"`           // authorized_keys line
+	Fingerprint    string    `json:"fingerprint"`          // SHA256 fingerprint of the public key
+	KeyType        string    `json:"key_type"`             // e.g. ssh-ed25519
+	Passphrase     string    `json:"passphrase,omitempty"` // Encrypted, only set for PassphraseStored
+	PassphraseMode string    `json:"passphrase_mode"`      // Empty for keys without a passphrase
+	GroupID        *int      `json:"group_id,string"`      // Group the key is shared with
+	GroupName      string    `json:"group_name,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
 }
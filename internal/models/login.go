@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// What a lockout counts the failures of.
+const (
+	LockoutUser = "user" // A username, lower case
+	LockoutIP   = "ip"   // A client address
+)
+
+// Why a login failed.
+const (
+	FailurePassword     = "password"      // Unknown user or wrong password
+	FailureSecondFactor = "second_factor" // Wrong code after the password
+	FailureLocked       = "locked"        // Refused during a wait or lockout, the password was not checked
+	FailureDisabled     = "disabled"      // Right password of a disabled account
+	FailureNoAccess     = "no_access"     // Right password, but no allowed group or role
+)
+
+// LoginFailure a failed login attempt.
+type LoginFailure struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginLockout failures in a row of a username or an address.
+type LoginLockout struct {
+	Kind        string    `json:"kind"`
+	Subject     string    `json:"subject"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Locked reports whether logins are refused at the time.
+func (l *LoginLockout) Locked(now time.Time) bool {
+	return now.Before(l.LockedUntil)
+}
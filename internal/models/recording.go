@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Recording metadata of a terminal session recorded in the asciicast v2 format.
+type Recording struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Username  string     `json:"username"` // Empty when the user was deleted
+	HostID    int        `json:"host_id"`
+	HostName  string     `json:"host_name"`
+	ShellID   string     `json:"shell_id"`
+	FilePath  string     `json:"-"`
+	Size      int64      `json:"size"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+}
+
+// RecordingFilter conditions for searching recordings, zero values are ignored.
+type RecordingFilter struct {
+	UserID int
+	HostID int
+	From   time.Time
+	To     time.Time
+}
@@ -2,23 +2,41 @@ package models
 
 import (
 	"io"
+	"ssh_manager/internal/recording"
 	"sync"
 	"time"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
+// ShellSession model of a single shell channel opened over the host connection.
+type ShellSession struct {
+	ID           string
+	SSHSession   *ssh.Session
+	Stdin        io.WriteCloser
+	OutputBuffer []byte
+	CreatedAt    time.Time
+	Recorder     *recording.Recorder // nil when the host is not recorded
+	RecordingID  int
+	Mu           sync.Mutex
+	Clients      map[chan []byte]bool
+}
+
 // ActiveSession model of active SSH user connections.
 type ActiveSession struct {
 	HostID       int
+	Host         *Host // Host data at the moment of connecting
 	SSHClient    *ssh.Client
-	SSHSession   *ssh.Session
+	JumpClients  []*ssh.Client // Bastions the client is tunnelled through, outermost first
 	SFTPClient   *sftp.Client
-	Stdin        io.WriteCloser
-	OutputBuffer []byte
+	Agent        agent.Agent              // In-memory keyring forwarded to the host, nil when forwarding is off
+	Shells       map[string]*ShellSession // [shellID]
+	Tunnels      map[int]*ActiveTunnel    // Running port forwardings [tunnelID]
+	Proxies      map[int]*ActiveProxy     // Running SOCKS5 proxies [bindPort]
 	LastActivity time.Time
 	Mu           sync.Mutex
+	ShellMu      sync.Mutex // Held while the first shell is opened, kept apart from Mu because it waits for the host
 	RefCount     int
-	Clients      map[chan []byte]bool
 }
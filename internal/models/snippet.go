@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// snippetVariable matches a "{{name}}" placeholder of a snippet.
+var snippetVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// Snippet a saved command, "{{name}}" placeholders are filled in before it is used.
+type Snippet struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	Name        string    `json:"name"`
+	Command     string    `json:"command"`
+	Description string    `json:"description"`
+	Variables   []string  `json:"variables"`       // Placeholder names in the order of appearance
+	GroupID     *int      `json:"group_id,string"` // Group the snippet is shared with
+	GroupName   string    `json:"group_name,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ParseVariables fills Variables from the placeholders of the command.
+func (s *Snippet) ParseVariables() {
+	s.Variables = []string{}
+	seen := make(map[string]bool)
+	for _, m := range snippetVariable.FindAllStringSubmatch(s.Command, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			s.Variables = append(s.Variables, m[1])
+		}
+	}
+}
+
+// Render returns the command with the placeholders replaced by the values, every variable must have one.
+func (s *Snippet) Render(values map[string]string) (string, error) {
+	var missing string
+	command := snippetVariable.ReplaceAllStringFunc(s.Command, func(placeholder string) string {
+		name := snippetVariable.FindStringSubmatch(placeholder)[1]
+		value, ok := values[name]
+		if !ok && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("no value for variable %q", missing)
+	}
+	return command, nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tunnel directions.
+const (
+	TunnelLocal  = "local"  // Like ssh -L: listens on the manager, connects from the host
+	TunnelRemote = "remote" // Like ssh -R: listens on the host, connects from the manager
+)
+
+// Tunnel port forwarding defined by a user for a host.
+type Tunnel struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	HostID      int       `json:"host_id"`
+	Name        string    `json:"name"`
+	Direction   string    `json:"direction"`
+	BindAddress string    `json:"bind_address"`
+	BindPort    int       `json:"bind_port"`
+	TargetHost  string    `json:"target_host"`
+	TargetPort  int       `json:"target_port"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Forwarder a listener with the connections it forwards and their traffic counters,
+// the common part of running tunnels and proxies.
+type Forwarder struct {
+	Listener    io.Closer
+	StartedAt   time.Time
+	Connections atomic.Int64 // Currently open connections
+	Total       atomic.Int64 // Connections accepted since the start
+	BytesSent   atomic.Int64 // From the listening side to the target
+	BytesRecv   atomic.Int64 // From the target back to the listening side
+	Mu          sync.Mutex
+	Conns       map[io.Closer]bool // Open connections, closed when the forwarder stops
+	Stopped     bool
+}
+
+// ActiveTunnel a running tunnel on the host connection.
+type ActiveTunnel struct {
+	Tunnel Tunnel
+	Forwarder
+}
+
+// ActiveProxy a running SOCKS5 proxy (like ssh -D) that connects through the host.
+type ActiveProxy struct {
+	HostID      int
+	BindAddress string
+	BindPort    int
+	Username    string // SOCKS credentials, no authentication when empty
+	Password    string
+	Forwarder
+}
@@ -1,8 +1,77 @@
 package models
 
+import "time"
+
+// User roles.
+const (
+	RoleAdmin    = "admin"    // Manages users and everything an operator can do
+	RoleOperator = "operator" // Manages own hosts and keys, works in terminals
+	RoleReadOnly = "readonly" // Watches terminals without input
+)
+
+// Where users log in.
+const (
+	AuthLocal = "local" // Password stored by the manager
+	AuthOIDC  = "oidc"  // OpenID Connect identity provider
+	AuthLDAP  = "ldap"  // Password checked by an LDAP directory
+)
+
 // User user model.
 type User struct {
-	ID           int
-	Username     string
-	PasswordHash string
+	ID             int       `json:"id"`
+	Username       string    `json:"username"`
+	PasswordHash   string    `json:"-"`
+	Role           string    `json:"role"`
+	Disabled       bool      `json:"disabled"`
+	TOTPSecret     string    `json:"-"` // Encrypted, empty while 2FA is off
+	TOTPCounter    int64     `json:"-"` // Period of the last accepted code
+	TOTPEnabled    bool      `json:"totp_enabled"`
+	Passkeys       int       `json:"passkeys"` // Registered WebAuthn credentials
+	AuthProvider   string    `json:"auth_provider"`
+	ExternalID     string    `json:"-"` // Subject at the identity provider
+	SessionVersion int       `json:"-"` // Sessions of an older version were started before a password change
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// IsAdmin reports whether the user can administer other users.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsLocal reports whether the manager keeps the password of the user, users of an identity provider
+// log in and confirm their identity there.
+func (u *User) IsLocal() bool {
+	return u.AuthProvider == AuthLocal
+}
+
+// TwoFactorAtProvider reports whether the identity provider asks for the second factor on its own login page,
+// the two-factor authentication of the manager does not apply then.
+func (u *User) TwoFactorAtProvider() bool {
+	return u.AuthProvider == AuthOIDC
+}
+
+// HasSecondFactor reports whether a login needs a code or a passkey after the password.
+func (u *User) HasSecondFactor() bool {
+	return u.TOTPEnabled || u.Passkeys > 0
+}
+
+// CanWrite reports whether the user can change data and send input to terminals.
+func (u *User) CanWrite() bool {
+	return u.Role == RoleAdmin || u.Role == RoleOperator
+}
+
+// Application settings changed by admins.
+const (
+	SettingRequire2FA = "require_2fa" // "true" if every user has to use two-factor authentication
+)
+
+// Manages reports whether the user may change or delete a shared entry of the owner, the other members
+// of the group only use it. Entries whose owner was deleted (owner 0) are managed by the admins.
+func (u *User) Manages(ownerID int) bool {
+	return ownerID == u.ID || (ownerID == 0 && u.IsAdmin())
+}
+
+// ValidRole checks that the role is one of the known ones.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleOperator || role == RoleReadOnly
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// WebAuthnCredential a passkey or security key registered by a user.
+type WebAuthnCredential struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	Name         string     `json:"name"`
+	CredentialID string     `json:"-"` // base64url, as the browser sends it
+	Data         []byte     `json:"-"` // JSON of the verified credential
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
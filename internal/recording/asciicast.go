@@ -0,0 +1,122 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Header first line of an asciicast v2 file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder writes terminal events to a file in the asciicast v2 format.
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	start   time.Time
+	pending []byte // Incomplete UTF-8 sequence left from the previous output chunk
+	closed  bool
+}
+
+// NewRecorder creates the cast file and writes its header.
+func NewRecorder(path string, width, height int, title string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{file: f, start: time.Now()}
+	header, _ := json.Marshal(Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	if _, err := f.Write(append(header, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Output records data printed by the remote shell.
+func (r *Recorder) Output(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A chunk may end in the middle of a multibyte character, keep the tail for the next one
+	buf := append(r.pending, data...)
+	cut := len(buf)
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), buf[cut:]...)
+	r.writeEvent("o", string(buf[:cut]))
+}
+
+// Input records data typed by the user.
+func (r *Recorder) Input(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent("i", string(data))
+}
+
+// Resize records a terminal size change.
+func (r *Recorder) Resize(cols, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close flushes the events and closes the file, returning its size.
+func (r *Recorder) Close() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, nil
+	}
+	if len(r.pending) > 0 {
+		r.writeEvent("o", string(r.pending))
+		r.pending = nil
+	}
+	r.closed = true
+
+	info, err := r.file.Stat()
+	r.file.Close()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writeEvent appends one [time, type, data] line, the lock must be held.
+// Events are written straight to the file so that nothing is lost if the process dies.
+func (r *Recorder) writeEvent(kind, data string) {
+	if r.closed || data == "" {
+		return
+	}
+	elapsed := time.Since(r.start).Seconds()
+	line, err := json.Marshal([]interface{}{elapsed, kind, data})
+	if err != nil {
+		return
+	}
+	r.file.Write(append(line, '\n'))
+}
@@ -12,3 +12,26 @@ type DBTX interface {
 	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
+
+// txBeginner is implemented by *sql.DB.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// WithTx runs fn in a transaction. If db is already a transaction, fn simply runs in it.
+func WithTx(ctx context.Context, db DBTX, fn func(tx DBTX) error) error {
+	beginner, ok := db.(txBeginner)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := beginner.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ssh_manager/internal/models"
+)
+
+// ErrGroupInUse is returned when a group that still owns hosts, keys or snippets is deleted.
+var ErrGroupInUse = errors.New("group still owns hosts, keys or snippets")
+
+type GroupRepository struct {
+	DB DBTX
+}
+
+// GetAll gets all groups with their members.
+func (r *GroupRepository) GetAll(ctx context.Context) ([]models.Group, error) {
+	groups, err := r.list(ctx, `SELECT id, name, created_at FROM user_groups ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		if groups[i].Members, err = r.GetMembers(ctx, groups[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// GetByUserID gets the groups the user is a member of.
+func (r *GroupRepository) GetByUserID(ctx context.Context, userID int) ([]models.Group, error) {
+	return r.list(ctx, `SELECT g.id, g.name, g.created_at FROM user_groups g
+		JOIN group_members m ON m.group_id = g.id WHERE m.user_id = $1 ORDER BY g.name`, userID)
+}
+
+// list runs a query returning groups without members.
+func (r *GroupRepository) list(ctx context.Context, query string, args ...interface{}) ([]models.Group, error) {
+	rows, err := r.DB.QueryContext(ctx, Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.Group
+	for rows.Next() {
+		var g models.Group
+		if err := rows.Scan(&g.ID, &g.Name, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// GetMembers gets the members of the group.
+func (r *GroupRepository) GetMembers(ctx context.Context, groupID int) ([]models.User, error) {
+	query := Rebind(`SELECT u.id, u.username, u.role, u.disabled, u.created_at FROM users u
+		JOIN group_members m ON m.user_id = u.id WHERE m.group_id = $1 ORDER BY u.username`)
+	rows, err := r.DB.QueryContext(ctx, query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.Disabled, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// IsMember checks whether the user belongs to the group.
+func (r *GroupRepository) IsMember(ctx context.Context, groupID, userID int) (bool, error) {
+	var count int
+	query := Rebind(`SELECT COUNT(*) FROM group_members WHERE group_id = $1 AND user_id = $2`)
+	err := r.DB.QueryRowContext(ctx, query, groupID, userID).Scan(&count)
+	return count > 0, err
+}
+
+// Create creates a group.
+func (r *GroupRepository) Create(ctx context.Context, g *models.Group) error {
+	query := Rebind(`INSERT INTO user_groups (name) VALUES ($1) RETURNING id`)
+	return r.DB.QueryRowContext(ctx, query, g.Name).Scan(&g.ID)
+}
+
+// Delete deletes a group that owns no hosts, keys and snippets.
+func (r *GroupRepository) Delete(ctx context.Context, groupID int) error {
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		var owned int
+		query := Rebind(`SELECT (SELECT COUNT(*) FROM hosts WHERE group_id = $1) + (SELECT COUNT(*) FROM keys WHERE group_id = $2)
+			+ (SELECT COUNT(*) FROM snippets WHERE group_id = $3)`)
+		if err := tx.QueryRowContext(ctx, query, groupID, groupID, groupID).Scan(&owned); err != nil {
+			return err
+		}
+		if owned > 0 {
+			return ErrGroupInUse
+		}
+
+		if _, err := tx.ExecContext(ctx, Rebind(`DELETE FROM group_members WHERE group_id = $1`), groupID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, Rebind(`DELETE FROM user_groups WHERE id = $1`), groupID)
+		return err
+	})
+}
+
+// AddMember adds the user to the group.
+func (r *GroupRepository) AddMember(ctx context.Context, groupID, userID int) error {
+	query := Rebind(`INSERT INTO group_members (group_id, user_id) VALUES ($1, $2)`)
+	_, err := r.DB.ExecContext(ctx, query, groupID, userID)
+	return err
+}
+
+// RemoveMember removes the user from the group.
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupID, userID int) error {
+	query := Rebind(`DELETE FROM group_members WHERE group_id = $1 AND user_id = $2`)
+	_, err := r.DB.ExecContext(ctx, query, groupID, userID)
+	return err
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"ssh_manager/internal/models"
+)
+
+type HostKeyRepository struct {
+	DB DBTX
+}
+
+// GetByHostID gets all keys pinned to the host.
+func (r *HostKeyRepository) GetByHostID(ctx context.Context, hostID int) ([]models.HostKey, error) {
+	query := Rebind(`SELECT id, host_id, key_type, fingerprint, public_key, first_seen FROM host_keys WHERE host_id = $1 ORDER BY first_seen`)
+	rows, err := r.DB.QueryContext(ctx, query, hostID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.HostKey
+	for rows.Next() {
+		var k models.HostKey
+		if err := rows.Scan(&k.ID, &k.HostID, &k.KeyType, &k.Fingerprint, &k.PublicKey, &k.FirstSeen); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Create pins a new key to the host.
+func (r *HostKeyRepository) Create(ctx context.Context, k *models.HostKey) error {
+	query := Rebind(`INSERT INTO host_keys (host_id, key_type, fingerprint, public_key, first_seen) VALUES ($1, $2, $3, $4, $5) RETURNING id`)
+	return r.DB.QueryRowContext(ctx, query, k.HostID, k.KeyType, k.Fingerprint, k.PublicKey, k.FirstSeen).Scan(&k.ID)
+}
+
+// DeleteByHostID removes all pinned keys of the host.
+func (r *HostKeyRepository) DeleteByHostID(ctx context.Context, hostID int) error {
+	query := Rebind(`DELETE FROM host_keys WHERE host_id = $1`)
+	_, err := r.DB.ExecContext(ctx, query, hostID)
+	return err
+}
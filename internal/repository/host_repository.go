@@ -2,68 +2,298 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"ssh_manager/internal/models"
+	"strings"
 )
 
 type HostRepository struct {
 	DB DBTX
 }
 
-// GetByUserID gets data from all user hosts by their ID.
+// hostColumns columns selected for a host, the group name is joined from user_groups.
+const hostColumns = `h.id, COALESCE(h.user_id, 0), h.name, h.address, h.port, h.username, h.key_id, h.jump_host_id, h.group_id, COALESCE(g.name, ''), h.folder, h.auth_type, h.password, h.totp_secret, h.settings`
+
+// hostAccess limits a query to the hosts the user owns or can reach through group membership.
+const hostAccess = `(h.user_id = $1 OR h.group_id IN (SELECT group_id FROM group_members WHERE user_id = $2))`
+
+// hostSortColumns the columns hosts can be sorted by.
+var hostSortColumns = map[string]string{
+	"name":    "h.name",
+	"address": "h.address",
+	"folder":  "h.folder",
+	"created": "h.created_at",
+}
+
+// HostFilter narrows down and orders the hosts returned by Search.
+type HostFilter struct {
+	Query   string // Part of the name or of the address
+	Name    string // Part of the name
+	Address string // Part of the address
+	Tag     string
+	Folder  string // The folder together with its subfolders
+	IDs     []int  // Only these hosts if not nil, e.g. the ones with an active session
+	Sort    string // One of hostSortColumns, by folder and name if empty
+	Desc    bool
+	Limit   int // All matching hosts if zero
+	Offset  int
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanHost reads a row of hostColumns.
+func scanHost(row scanner, h *models.Host) error {
+	return row.Scan(&h.ID, &h.UserID, &h.Name, &h.Address, &h.Port, &h.Username, &h.KeyID, &h.JumpHostID, &h.GroupID, &h.GroupName, &h.Folder, &h.AuthType, &h.Password, &h.TOTPSecret, &h.Settings)
+}
+
+// GetByUserID gets data from all hosts the user owns or can reach through group membership, ordered by folder and name.
 func (r *HostRepository) GetByUserID(ctx context.Context, userID int) ([]models.Host, error) {
-	query := Rebind(`SELECT id, name, address, port, username, key_id, auth_type, password, settings FROM hosts WHERE user_id = $1`)
-	rows, err := r.DB.QueryContext(ctx, query, userID)
+	hosts, _, err := r.Search(ctx, userID, HostFilter{})
+	return hosts, err
+}
+
+// Search gets the user's hosts matching the filter and the number of matches without the limit.
+func (r *HostRepository) Search(ctx context.Context, userID int, f HostFilter) ([]models.Host, int, error) {
+	args := []interface{}{userID, userID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{hostAccess}
+	if f.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(f.Query)) + "%"
+		where = append(where, fmt.Sprintf(`(LOWER(h.name) LIKE %s ESCAPE '\' OR LOWER(h.address) LIKE %s ESCAPE '\')`, arg(pattern), arg(pattern)))
+	}
+	if f.Name != "" {
+		where = append(where, `LOWER(h.name) LIKE `+arg("%"+escapeLike(strings.ToLower(f.Name))+"%")+` ESCAPE '\'`)
+	}
+	if f.Address != "" {
+		where = append(where, `LOWER(h.address) LIKE `+arg("%"+escapeLike(strings.ToLower(f.Address))+"%")+` ESCAPE '\'`)
+	}
+	if f.Tag != "" {
+		where = append(where, `h.id IN (SELECT host_id FROM host_tags WHERE tag = `+arg(f.Tag)+`)`)
+	}
+	if f.Folder != "" {
+		where = append(where, fmt.Sprintf(`(h.folder = %s OR h.folder LIKE %s ESCAPE '\')`, arg(f.Folder), arg(escapeLike(f.Folder)+"/%")))
+	}
+	if f.IDs != nil {
+		if len(f.IDs) == 0 {
+			return nil, 0, nil
+		}
+		placeholders := make([]string, len(f.IDs))
+		for i, id := range f.IDs {
+			placeholders[i] = arg(id)
+		}
+		where = append(where, `h.id IN (`+strings.Join(placeholders, ", ")+`)`)
+	}
+	conditions := strings.Join(where, " AND ")
+
+	var total int
+	if err := r.DB.QueryRowContext(ctx, Rebind(`SELECT COUNT(*) FROM hosts h WHERE `+conditions), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order := "h.folder, h.name"
+	if column, ok := hostSortColumns[f.Sort]; ok {
+		order = column
+	}
+	if f.Desc {
+		order = strings.ReplaceAll(order, ",", " DESC,") + " DESC"
+	}
+	query := `SELECT ` + hostColumns + ` FROM hosts h LEFT JOIN user_groups g ON g.id = h.group_id
+		WHERE ` + conditions + ` ORDER BY ` + order + `, h.id`
+	if f.Limit > 0 {
+		query += ` LIMIT ` + arg(f.Limit) + ` OFFSET ` + arg(f.Offset)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, Rebind(query), args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var hosts []models.Host
 	for rows.Next() {
 		var h models.Host
-		err := rows.Scan(
-			&h.ID,
-			&h.Name,
-			&h.Address,
-			&h.Port,
-			&h.Username,
-			&h.KeyID,
-			&h.AuthType,
-			&h.Password,
-			&h.Settings,
-		)
-		if err != nil {
-			return nil, err
+		if err := scanHost(rows, &h); err != nil {
+			return nil, 0, err
 		}
 		hosts = append(hosts, h)
 	}
-	return hosts, nil
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	if err := r.loadTags(ctx, hosts); err != nil {
+		return nil, 0, err
+	}
+	return hosts, total, nil
 }
 
-// GetByID gets host data by user ID and host ID.
+// GetByID gets host data by host ID if the user owns it or is a member of its group.
 func (r *HostRepository) GetByID(ctx context.Context, hostID, userID int) (*models.Host, error) {
 	h := &models.Host{}
-	query := Rebind(`SELECT id, name, address, port, username, key_id, auth_type, password, settings FROM hosts WHERE id = $1 AND user_id = $2`)
-	err := r.DB.QueryRowContext(ctx, query, hostID, userID).Scan(&h.ID, &h.Name, &h.Address, &h.Port, &h.Username, &h.KeyID, &h.AuthType, &h.Password, &h.Settings)
-	return h, err
+	query := Rebind(`SELECT ` + hostColumns + ` FROM hosts h LEFT JOIN user_groups g ON g.id = h.group_id
+		WHERE h.id = $1 AND (h.user_id = $2 OR h.group_id IN (SELECT group_id FROM group_members WHERE user_id = $3))`)
+	if err := scanHost(r.DB.QueryRowContext(ctx, query, hostID, userID, userID), h); err != nil {
+		return h, err
+	}
+	hosts := []models.Host{*h}
+	if err := r.loadTags(ctx, hosts); err != nil {
+		return h, err
+	}
+	return &hosts[0], nil
+}
+
+// GetTags gets the tags used on the hosts the user can reach.
+func (r *HostRepository) GetTags(ctx context.Context, userID int) ([]string, error) {
+	query := Rebind(`SELECT DISTINCT t.tag FROM host_tags t JOIN hosts h ON h.id = t.host_id WHERE ` + hostAccess + ` ORDER BY t.tag`)
+	rows, err := r.DB.QueryContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// loadTags fills the tags of the hosts.
+func (r *HostRepository) loadTags(ctx context.Context, hosts []models.Host) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Host, len(hosts))
+	placeholders := make([]string, len(hosts))
+	args := make([]interface{}, len(hosts))
+	for i := range hosts {
+		hosts[i].Tags = []string{}
+		byID[hosts[i].ID] = &hosts[i]
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = hosts[i].ID
+	}
+
+	query := Rebind(`SELECT host_id, tag FROM host_tags WHERE host_id IN (` + strings.Join(placeholders, ", ") + `) ORDER BY tag`)
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hostID int
+		var tag string
+		if err := rows.Scan(&hostID, &tag); err != nil {
+			return err
+		}
+		byID[hostID].Tags = append(byID[hostID].Tags, tag)
+	}
+	return rows.Err()
+}
+
+// saveTags replaces the tags of the host.
+func saveTags(ctx context.Context, tx DBTX, hostID int, tags []string) error {
+	if _, err := tx.ExecContext(ctx, Rebind(`DELETE FROM host_tags WHERE host_id = $1`), hostID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, Rebind(`INSERT INTO host_tags (host_id, tag) VALUES ($1, $2)`), hostID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, the queries use '\' as the escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// GetIDsByGroupID returns the IDs of the hosts shared with the group.
+func (r *HostRepository) GetIDsByGroupID(ctx context.Context, groupID int) ([]int, error) {
+	rows, err := r.DB.QueryContext(ctx, Rebind(`SELECT id FROM hosts WHERE group_id = $1`), groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
 }
 
 // Create will create a host.
 func (r *HostRepository) Create(ctx context.Context, h *models.Host) error {
-	query := Rebind(`INSERT INTO hosts (user_id, name, address, port, username, key_id, auth_type, password, settings) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`)
-	return r.DB.QueryRowContext(ctx, query, h.UserID, h.Name, h.Address, h.Port, h.Username, h.KeyID, h.AuthType, h.Password, h.Settings).Scan(&h.ID)
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		query := Rebind(`INSERT INTO hosts (user_id, name, address, port, username, key_id, jump_host_id, group_id, folder, auth_type, password, totp_secret, settings) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`)
+		if err := tx.QueryRowContext(ctx, query, h.UserID, h.Name, h.Address, h.Port, h.Username, h.KeyID, h.JumpHostID, h.GroupID, h.Folder, h.AuthType, h.Password, h.TOTPSecret, h.Settings).Scan(&h.ID); err != nil {
+			return err
+		}
+		return saveTags(ctx, tx, h.ID, h.Tags)
+	})
 }
 
-// Update updates host data.
-func (r *HostRepository) Update(ctx context.Context, h *models.Host) error {
-	query := Rebind(`UPDATE hosts SET name = $1, address = $2, port = $3, username = $4, key_id = $5, auth_type = $6, password = $7, settings = $8 WHERE id = $9 AND user_id = $10`)
-	_, err := r.DB.ExecContext(ctx, query, h.Name, h.Address, h.Port, h.Username, h.KeyID, h.AuthType, h.Password, h.Settings, h.ID, h.UserID)
-	return err
+// Update updates host data of the owner, 0 for a shared host whose owner was deleted. Group members only
+// connect to shared hosts, otherwise they could send the stored password to a server of their own.
+func (r *HostRepository) Update(ctx context.Context, h *models.Host, ownerID int) error {
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		query := Rebind(`UPDATE hosts SET name = $1, address = $2, port = $3, username = $4, key_id = $5, jump_host_id = $6, group_id = $7, folder = $8, auth_type = $9, password = $10, totp_secret = $11, settings = $12
+			WHERE id = $13 AND COALESCE(user_id, 0) = $14`)
+		res, err := tx.ExecContext(ctx, query, h.Name, h.Address, h.Port, h.Username, h.KeyID, h.JumpHostID, h.GroupID, h.Folder, h.AuthType, h.Password, h.TOTPSecret, h.Settings, h.ID, ownerID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		return saveTags(ctx, tx, h.ID, h.Tags)
+	})
 }
 
-// Delete deletes a host by its ID.
-func (r *HostRepository) Delete(ctx context.Context, hostID, userID int) error {
-	query := Rebind(`DELETE FROM hosts WHERE id = $1 AND user_id = $2`)
-	_, err := r.DB.ExecContext(ctx, query, hostID, userID)
-	return err
+// Delete deletes a host of the owner by its ID, 0 for a shared host whose owner was deleted.
+func (r *HostRepository) Delete(ctx context.Context, hostID, ownerID int) error {
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		var id int
+		query := Rebind(`SELECT id FROM hosts WHERE id = $1 AND COALESCE(user_id, 0) = $2`)
+		if err := tx.QueryRowContext(ctx, query, hostID, ownerID).Scan(&id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		// Hosts behind it connect directly from now on, the reference would also block the delete on Postgres
+		if _, err := tx.ExecContext(ctx, Rebind(`UPDATE hosts SET jump_host_id = NULL WHERE jump_host_id = $1`), hostID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, Rebind(`DELETE FROM hosts WHERE id = $1`), hostID); err != nil {
+			return err
+		}
+		// Tunnels of all users and tags, SQLite does not cascade without the foreign_keys pragma
+		if _, err := tx.ExecContext(ctx, Rebind(`DELETE FROM tunnels WHERE host_id = $1`), hostID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, Rebind(`DELETE FROM host_tags WHERE host_id = $1`), hostID)
+		return err
+	})
 }
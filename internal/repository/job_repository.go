@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"ssh_manager/internal/models"
+	"time"
+)
+
+type JobRepository struct {
+	DB DBTX
+}
+
+// List gets the user's jobs without their results, newest first.
+func (r *JobRepository) List(ctx context.Context, userID int) ([]models.Job, error) {
+	query := Rebind(`SELECT id, user_id, command, status, parallelism, timeout_seconds, created_at, finished_at FROM jobs WHERE user_id = $1 ORDER BY id DESC`)
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		var j models.Job
+		if err := rows.Scan(&j.ID, &j.UserID, &j.Command, &j.Status, &j.Parallelism, &j.TimeoutSeconds, &j.CreatedAt, &j.FinishedAt); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// GetByID gets a job of the user with the results of all its hosts.
+func (r *JobRepository) GetByID(ctx context.Context, jobID, userID int) (*models.Job, error) {
+	j := &models.Job{}
+	query := Rebind(`SELECT id, user_id, command, status, parallelism, timeout_seconds, created_at, finished_at FROM jobs WHERE id = $1 AND user_id = $2`)
+	err := r.DB.QueryRowContext(ctx, query, jobID, userID).Scan(&j.ID, &j.UserID, &j.Command, &j.Status, &j.Parallelism, &j.TimeoutSeconds, &j.CreatedAt, &j.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.QueryContext(ctx, Rebind(`SELECT id, job_id, host_id, host_name, status, exit_code, stdout, stderr, error, started_at, finished_at FROM job_results WHERE job_id = $1 ORDER BY id`), jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.JobResult
+		if err := rows.Scan(&res.ID, &res.JobID, &res.HostID, &res.HostName, &res.Status, &res.ExitCode, &res.Stdout, &res.Stderr, &res.Error, &res.StartedAt, &res.FinishedAt); err != nil {
+			return nil, err
+		}
+		j.Results = append(j.Results, res)
+	}
+	return j, rows.Err()
+}
+
+// Create stores a new job together with a pending result for each of its hosts.
+func (r *JobRepository) Create(ctx context.Context, j *models.Job) error {
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		query := Rebind(`INSERT INTO jobs (user_id, command, status, parallelism, timeout_seconds, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`)
+		if err := tx.QueryRowContext(ctx, query, j.UserID, j.Command, j.Status, j.Parallelism, j.TimeoutSeconds, j.CreatedAt).Scan(&j.ID); err != nil {
+			return err
+		}
+
+		query = Rebind(`INSERT INTO job_results (job_id, host_id, host_name, status) VALUES ($1, $2, $3, $4) RETURNING id`)
+		for i := range j.Results {
+			res := &j.Results[i]
+			res.JobID = j.ID
+			if err := tx.QueryRowContext(ctx, query, res.JobID, res.HostID, res.HostName, res.Status).Scan(&res.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateResult saves the state and output of a host.
+func (r *JobRepository) UpdateResult(ctx context.Context, res *models.JobResult) error {
+	query := Rebind(`UPDATE job_results SET status = $1, exit_code = $2, stdout = $3, stderr = $4, error = $5, started_at = $6, finished_at = $7 WHERE id = $8`)
+	_, err := r.DB.ExecContext(ctx, query, res.Status, res.ExitCode, res.Stdout, res.Stderr, res.Error, res.StartedAt, res.FinishedAt, res.ID)
+	return err
+}
+
+// Finish marks the job as done.
+func (r *JobRepository) Finish(ctx context.Context, jobID int, status string, finishedAt time.Time) error {
+	query := Rebind(`UPDATE jobs SET status = $1, finished_at = $2 WHERE id = $3`)
+	_, err := r.DB.ExecContext(ctx, query, status, finishedAt, jobID)
+	return err
+}
+
+// MarkInterrupted closes the jobs that were still running when the server stopped.
+func (r *JobRepository) MarkInterrupted(ctx context.Context) error {
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		query := Rebind(`UPDATE job_results SET status = $1, error = 'server stopped before the command finished'
+			WHERE status IN ($2, $3) AND job_id IN (SELECT id FROM jobs WHERE status = $4)`)
+		if _, err := tx.ExecContext(ctx, query, models.ResultError, models.ResultPending, models.ResultRunning, models.JobRunning); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, Rebind(`UPDATE jobs SET status = $1 WHERE status = $2`), models.JobInterrupted, models.JobRunning)
+		return err
+	})
+}
@@ -9,10 +9,11 @@ type KeyRepository struct {
 	DB DBTX
 }
 
-// GetAllByUserID gets all private keys of a user by his ID.
+// GetAllByUserID gets all private keys the user owns or can use through group membership.
 func (r *KeyRepository) GetAllByUserID(ctx context.Context, userID int) ([]models.Key, error) {
-	query := Rebind(`SELECT id, name FROM keys WHERE user_id = $1 ORDER BY created_at DESC`)
-	rows, err := r.DB.QueryContext(ctx, query, userID)
+	query := Rebind(`SELECT k.id, COALESCE(k.user_id, 0), k.name, k.public_key, k.fingerprint, k.key_type, k.passphrase_mode, k.group_id, COALESCE(g.name, '') FROM keys k LEFT JOIN user_groups g ON g.id = k.group_id
+		WHERE k.user_id = $1 OR k.group_id IN (SELECT group_id FROM group_members WHERE user_id = $2) ORDER BY k.created_at DESC`)
+	rows, err := r.DB.QueryContext(ctx, query, userID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -21,7 +22,7 @@ func (r *KeyRepository) GetAllByUserID(ctx context.Context, userID int) ([]model
 	var keys []models.Key
 	for rows.Next() {
 		var k models.Key
-		if err := rows.Scan(&k.ID, &k.Name); err != nil {
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.PublicKey, &k.Fingerprint, &k.KeyType, &k.PassphraseMode, &k.GroupID, &k.GroupName); err != nil {
 			return nil, err
 		}
 		keys = append(keys, k)
@@ -29,30 +30,60 @@ func (r *KeyRepository) GetAllByUserID(ctx context.Context, userID int) ([]model
 	return keys, nil
 }
 
-// GetByID gets user key data by its ID.
+// GetByID gets key data by its ID if the user owns it or is a member of its group.
+// The private key is included, callers must not hand it out to anyone but the owner.
 func (r *KeyRepository) GetByID(ctx context.Context, keyID, userID int) (*models.Key, error) {
 	k := &models.Key{}
-	query := Rebind(`SELECT id, name, private_key FROM keys WHERE id = $1 AND user_id = $2`)
-	err := r.DB.QueryRowContext(ctx, query, keyID, userID).Scan(&k.ID, &k.Name, &k.KeyData)
+	query := Rebind(`SELECT k.id, COALESCE(k.user_id, 0), k.name, k.private_key, k.public_key, k.fingerprint, k.key_type, k.passphrase, k.passphrase_mode, k.group_id, COALESCE(g.name, '') FROM keys k LEFT JOIN user_groups g ON g.id = k.group_id
+		WHERE k.id = $1 AND (k.user_id = $2 OR k.group_id IN (SELECT group_id FROM group_members WHERE user_id = $3))`)
+	err := r.DB.QueryRowContext(ctx, query, keyID, userID, userID).Scan(&k.ID, &k.UserID, &k.Name, &k.KeyData, &k.PublicKey, &k.Fingerprint, &k.KeyType, &k.Passphrase, &k.PassphraseMode, &k.GroupID, &k.GroupName)
 	return k, err
 }
 
 // Create creates a key.
 func (r *KeyRepository) Create(ctx context.Context, key *models.Key) error {
-	query := Rebind(`INSERT INTO keys (user_id, name, private_key) VALUES ($1, $2, $3) RETURNING id`)
-	return r.DB.QueryRowContext(ctx, query, key.UserID, key.Name, key.KeyData).Scan(&key.ID)
+	query := Rebind(`INSERT INTO keys (user_id, name, private_key, public_key, fingerprint, key_type, passphrase, passphrase_mode, group_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`)
+	return r.DB.QueryRowContext(ctx, query, key.UserID, key.Name, key.KeyData, key.PublicKey, key.Fingerprint, key.KeyType, key.Passphrase, key.PassphraseMode, key.GroupID).Scan(&key.ID)
 }
 
-// Update updates the key.
-func (r *KeyRepository) Update(ctx context.Context, key *models.Key) error {
-	query := Rebind(`UPDATE keys SET name = $1, private_key = $2 WHERE id = $3 AND user_id = $4`)
-	_, err := r.DB.ExecContext(ctx, query, key.Name, key.KeyData, key.ID, key.UserID)
+// Update updates the key of the owner, 0 for a shared key whose owner was deleted. Group members only use shared keys.
+func (r *KeyRepository) Update(ctx context.Context, key *models.Key, ownerID int) error {
+	query := Rebind(`UPDATE keys SET name = $1, private_key = $2, public_key = $3, fingerprint = $4, key_type = $5, passphrase = $6, passphrase_mode = $7, group_id = $8
+		WHERE id = $9 AND COALESCE(user_id, 0) = $10`)
+	_, err := r.DB.ExecContext(ctx, query, key.Name, key.KeyData, key.PublicKey, key.Fingerprint, key.KeyType, key.Passphrase, key.PassphraseMode, key.GroupID, key.ID, ownerID)
 	return err
 }
 
-// Delete deletes a key by ID.
-func (r *KeyRepository) Delete(ctx context.Context, keyID, userID int) error {
-	query := Rebind(`DELETE FROM keys WHERE id = $1 AND user_id = $2`)
-	_, err := r.DB.ExecContext(ctx, query, keyID, userID)
+// Delete deletes a key of the owner by ID, 0 for a shared key whose owner was deleted.
+func (r *KeyRepository) Delete(ctx context.Context, keyID, ownerID int) error {
+	query := Rebind(`DELETE FROM keys WHERE id = $1 AND COALESCE(user_id, 0) = $2`)
+	_, err := r.DB.ExecContext(ctx, query, keyID, ownerID)
+	return err
+}
+
+// GetWithoutPublicKey gets the keys, with their private key, whose public key has not been derived yet.
+func (r *KeyRepository) GetWithoutPublicKey(ctx context.Context) ([]models.Key, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, name, private_key, passphrase FROM keys WHERE public_key = ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.Key
+	for rows.Next() {
+		var k models.Key
+		if err := rows.Scan(&k.ID, &k.Name, &k.KeyData, &k.Passphrase); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// SetPublicKey stores the public half derived from the private key.
+func (r *KeyRepository) SetPublicKey(ctx context.Context, key *models.Key) error {
+	query := Rebind(`UPDATE keys SET public_key = $1, fingerprint = $2, key_type = $3 WHERE id = $4`)
+	_, err := r.DB.ExecContext(ctx, query, key.PublicKey, key.Fingerprint, key.KeyType, key.ID)
 	return err
 }
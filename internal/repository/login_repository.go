@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"ssh_manager/internal/models"
+	"time"
+)
+
+type LoginRepository struct {
+	DB DBTX
+}
+
+// AddFailure records a failed login.
+func (r *LoginRepository) AddFailure(ctx context.Context, f *models.LoginFailure) error {
+	query := Rebind(`INSERT INTO login_failures (username, ip, user_agent, reason, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`)
+	return r.DB.QueryRowContext(ctx, query, f.Username, f.IP, f.UserAgent, f.Reason, f.CreatedAt.UTC()).Scan(&f.ID)
+}
+
+// GetRecentFailures gets the latest failed logins, the newest first.
+func (r *LoginRepository) GetRecentFailures(ctx context.Context, limit int) ([]models.LoginFailure, error) {
+	query := Rebind(`SELECT id, username, ip, user_agent, reason, created_at FROM login_failures ORDER BY id DESC LIMIT $1`)
+	rows, err := r.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []models.LoginFailure
+	for rows.Next() {
+		var f models.LoginFailure
+		if err := rows.Scan(&f.ID, &f.Username, &f.IP, &f.UserAgent, &f.Reason, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+// DeleteFailuresBefore deletes the failed logins older than the time.
+func (r *LoginRepository) DeleteFailuresBefore(ctx context.Context, before time.Time) error {
+	query := Rebind(`DELETE FROM login_failures WHERE created_at < $1`)
+	_, err := r.DB.ExecContext(ctx, query, before.UTC())
+	return err
+}
+
+// GetLockout gets the failures in a row of a username or an address, sql.ErrNoRows if there are none.
+func (r *LoginRepository) GetLockout(ctx context.Context, kind, subject string) (*models.LoginLockout, error) {
+	l := models.LoginLockout{Kind: kind, Subject: subject}
+	query := Rebind(`SELECT failures, last_failure, locked_until FROM login_lockouts WHERE kind = $1 AND subject = $2`)
+	if err := r.DB.QueryRowContext(ctx, query, kind, subject).Scan(&l.Failures, &l.LastFailure, &l.LockedUntil); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetLockouts gets all counted failures, the longest locked first.
+func (r *LoginRepository) GetLockouts(ctx context.Context) ([]models.LoginLockout, error) {
+	query := Rebind(`SELECT kind, subject, failures, last_failure, locked_until FROM login_lockouts ORDER BY locked_until DESC`)
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockouts []models.LoginLockout
+	for rows.Next() {
+		var l models.LoginLockout
+		if err := rows.Scan(&l.Kind, &l.Subject, &l.Failures, &l.LastFailure, &l.LockedUntil); err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, rows.Err()
+}
+
+// SaveLockout saves the failures in a row of a username or an address.
+func (r *LoginRepository) SaveLockout(ctx context.Context, l *models.LoginLockout) error {
+	query := Rebind(`INSERT INTO login_lockouts (kind, subject, failures, last_failure, locked_until) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (kind, subject) DO UPDATE SET failures = excluded.failures, last_failure = excluded.last_failure, locked_until = excluded.locked_until`)
+	_, err := r.DB.ExecContext(ctx, query, l.Kind, l.Subject, l.Failures, l.LastFailure.UTC(), l.LockedUntil.UTC())
+	return err
+}
+
+// DeleteLockout forgets the failures of a username or an address. Returns false if there were none.
+func (r *LoginRepository) DeleteLockout(ctx context.Context, kind, subject string) (bool, error) {
+	query := Rebind(`DELETE FROM login_lockouts WHERE kind = $1 AND subject = $2`)
+	res, err := r.DB.ExecContext(ctx, query, kind, subject)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteLockoutsBefore deletes the failures last counted before the time whose lockout is over by then.
+func (r *LoginRepository) DeleteLockoutsBefore(ctx context.Context, before time.Time) error {
+	query := Rebind(`DELETE FROM login_lockouts WHERE last_failure < $1 AND locked_until < $2`)
+	_, err := r.DB.ExecContext(ctx, query, before.UTC(), before.UTC())
+	return err
+}
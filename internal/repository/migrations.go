@@ -2,61 +2,300 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"embed"
+	"fmt"
 	"log"
+	"path"
+	"sort"
+	"ssh_manager/internal/models"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-// InitDB rolls out the pattern depending on the type of base.
-func InitDB(db DBTX, dbType string) error {
-	// SQL for Postgres (with SERIAL)
-	pgSchema := `
-	CREATE TABLE IF NOT EXISTS users (id SERIAL PRIMARY KEY, username TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL, created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP);
-	CREATE TABLE IF NOT EXISTS keys (id SERIAL PRIMARY KEY, user_id INTEGER REFERENCES users(id), name TEXT NOT NULL, private_key TEXT NOT NULL, created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP);
-	CREATE TABLE IF NOT EXISTS hosts (id SERIAL PRIMARY KEY, user_id INTEGER REFERENCES users(id), name TEXT NOT NULL, address TEXT NOT NULL, port INTEGER DEFAULT 22, username TEXT NOT NULL, auth_type TEXT DEFAULT 'key', password TEXT, key_id INTEGER REFERENCES keys(id), settings TEXT DEFAULT '{}', created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP);
-	`
-
-	// SQL for SQLite (with AUTOINCREMENT and without TimeZone in the same syntax)
-	sqliteSchema := `
-	CREATE TABLE IF NOT EXISTS users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);
-    CREATE TABLE IF NOT EXISTS keys (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER REFERENCES users(id), name TEXT NOT NULL, private_key TEXT NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);
-    CREATE TABLE IF NOT EXISTS hosts (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER REFERENCES users(id), name TEXT NOT NULL, address TEXT NOT NULL, port INTEGER DEFAULT 22, username TEXT NOT NULL, auth_type TEXT DEFAULT 'key', password TEXT, key_id INTEGER REFERENCES keys(id), settings TEXT DEFAULT '{}', created_at DATETIME DEFAULT CURRENT_TIMESTAMP);
-	`
-
-	schema := pgSchema
-	if dbType == "sqlite" {
-		schema = sqliteSchema
-	}
-
-	// We are creating tables
-	for _, query := range strings.Split(schema, ";") {
-		q := strings.TrimSpace(query)
-		if q == "" {
+// migrationFiles numbered up-migrations, one directory per dialect: sql/<dialect>/NNNN_name.sql.
+//
+//go:embed sql
+var migrationFiles embed.FS
+
+// migrationLockID key of the Postgres advisory lock held while migrating.
+const migrationLockID = 7318531
+
+// Migration a single numbered schema change.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationState shows whether a migration has been applied.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil if pending
+	Known     bool       // false if the database has a version this binary does not know
+}
+
+// LoadMigrations returns the migrations of the dialect ordered by version.
+func LoadMigrations(dbType string) ([]Migration, error) {
+	dir := path.Join("sql", dialect(dbType))
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		if e.IsDir() || name == e.Name() {
 			continue
 		}
-		if _, err := db.ExecContext(context.Background(), q); err != nil {
+
+		prefix, rest, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: file name must start with a version number", e.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, e.Name())
+		}
+		seen[version] = e.Name()
+
+		body, err := migrationFiles.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: rest, SQL: string(body)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate applies the pending migrations in one transaction. The transaction holds a lock,
+// so a second replica starting at the same time waits and then finds nothing to do.
+func Migrate(ctx context.Context, db *sql.DB, dbType string) error {
+	migrations, err := LoadMigrations(dbType)
+	if err != nil {
+		return err
+	}
+
+	// One connection, SQLite takes its write lock with BEGIN IMMEDIATE on it
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var tx DBTX
+	var commit, rollback func() error
+	if dbType == "postgres" {
+		t, err := conn.BeginTx(ctx, nil)
+		if err != nil {
 			return err
 		}
+		if _, err := t.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+			t.Rollback()
+			return err
+		}
+		tx, commit, rollback = t, t.Commit, t.Rollback
+	} else {
+		if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+			return err
+		}
+		exec := func(q string) func() error {
+			return func() error {
+				_, err := conn.ExecContext(context.Background(), q)
+				return err
+			}
+		}
+		tx, commit, rollback = conn, exec(`COMMIT`), exec(`ROLLBACK`)
+	}
+
+	applied, err := applyMigrations(ctx, tx, dbType, migrations)
+	if err != nil {
+		rollback()
+		return err
+	}
+	if err := commit(); err != nil {
+		return err
+	}
+
+	if applied > 0 {
+		log.Printf("Applied %d migration(s) for %s, schema version %d", applied, dbType, migrations[len(migrations)-1].Version)
+	} else {
+		log.Printf("Database schema is up to date for %s", dbType)
 	}
-	log.Printf("Database schema initialized for %s", dbType)
 	return nil
 }
 
+// applyMigrations runs the migrations that are not recorded in schema_migrations yet.
+func applyMigrations(ctx context.Context, tx DBTX, dbType string, migrations []Migration) (int, error) {
+	if _, err := tx.ExecContext(ctx, schemaMigrationsTable(dbType)); err != nil {
+		return 0, err
+	}
+
+	done, err := appliedVersions(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+
+		for _, query := range strings.Split(m.SQL, ";") {
+			q := strings.TrimSpace(query)
+			if q == "" || isComment(q) {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				return 0, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+
+		query := Rebind(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`)
+		if _, err := tx.ExecContext(ctx, query, m.Version, m.Name); err != nil {
+			return 0, err
+		}
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		applied++
+	}
+	return applied, nil
+}
+
+// MigrationStatus lists the known migrations and those recorded in the database.
+func MigrationStatus(ctx context.Context, db DBTX, dbType string) ([]MigrationState, error) {
+	migrations, err := LoadMigrations(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := tableExists(ctx, db, dbType, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int]appliedMigration)
+	if exists {
+		if done, err = appliedVersions(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	var states []MigrationState
+	for _, m := range migrations {
+		state := MigrationState{Version: m.Version, Name: m.Name, Known: true}
+		if a, ok := done[m.Version]; ok {
+			state.AppliedAt = &a.appliedAt
+			delete(done, m.Version)
+		}
+		states = append(states, state)
+	}
+	for version, a := range done {
+		appliedAt := a.appliedAt
+		states = append(states, MigrationState{Version: version, Name: a.name, AppliedAt: &appliedAt})
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+type appliedMigration struct {
+	name      string
+	appliedAt time.Time
+}
+
+// appliedVersions reads schema_migrations.
+func appliedVersions(ctx context.Context, db DBTX) (map[int]appliedMigration, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = a
+	}
+	return done, rows.Err()
+}
+
+// schemaMigrationsTable DDL of the table recording applied migrations.
+func schemaMigrationsTable(dbType string) string {
+	if dbType == "postgres" {
+		return `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP)`
+	}
+	return `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP)`
+}
+
+// tableExists checks whether the table has been created.
+func tableExists(ctx context.Context, db DBTX, dbType, table string) (bool, error) {
+	var exists bool
+	var err error
+	if dbType == "postgres" {
+		err = db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists)
+	} else {
+		err = db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&exists)
+	}
+	return exists, err
+}
+
+// dialect directory with the migrations of the database type.
+func dialect(dbType string) string {
+	if dbType == "postgres" {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// isComment reports whether the statement consists of comment lines only.
+func isComment(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
 // EnsureAdminUser During initialization, it creates a user with a password in the application.
+// Nothing is created while there is at least one active admin, so deleted accounts do not come back.
 func EnsureAdminUser(db DBTX, dbType string, defaultUser, defaultPass string) {
+	var admins int
+	err := db.QueryRowContext(context.Background(), Rebind(`SELECT COUNT(*) FROM users WHERE role = $1 AND disabled = $2`), models.RoleAdmin, false).Scan(&admins)
+	if err != nil {
+		log.Printf("Failed to ensure admin user: %v", err)
+		return
+	}
+	if admins > 0 {
+		log.Printf("Initial user check done (%d active admins)", admins)
+		return
+	}
+
 	// Hashing the password
 	hash, _ := bcrypt.GenerateFromPassword([]byte(defaultPass), bcrypt.DefaultCost)
 
 	var query string
 	if dbType == "postgres" {
-		query = `INSERT INTO users (username, password_hash) VALUES ($1, $2) ON CONFLICT (username) DO NOTHING`
+		query = `INSERT INTO users (username, password_hash, role) VALUES ($1, $2, $3) ON CONFLICT (username) DO NOTHING`
 	} else {
 		// SQLite requires a separate check, as older versions do not always support ON CONFLICT
-		query = `INSERT OR IGNORE INTO users (username, password_hash) VALUES (?, ?)`
+		query = `INSERT OR IGNORE INTO users (username, password_hash, role) VALUES (?, ?, ?)`
 	}
 
-	_, err := db.ExecContext(context.Background(), query, defaultUser, string(hash))
+	_, err = db.ExecContext(context.Background(), query, defaultUser, string(hash), models.RoleAdmin)
 	if err != nil {
 		log.Printf("Failed to ensure admin user: %v", err)
 	} else {
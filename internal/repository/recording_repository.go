@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"ssh_manager/internal/models"
+	"strings"
+	"time"
+)
+
+type RecordingRepository struct {
+	DB DBTX
+}
+
+// List gets recordings matching the filter, newest first.
+func (r *RecordingRepository) List(ctx context.Context, f models.RecordingFilter) ([]models.Recording, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.UserID != 0 {
+		add("r.user_id = $%d", f.UserID)
+	}
+	if f.HostID != 0 {
+		add("r.host_id = $%d", f.HostID)
+	}
+	if !f.From.IsZero() {
+		add("r.started_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("r.started_at <= $%d", f.To)
+	}
+
+	query := `SELECT r.id, r.user_id, COALESCE(u.username, ''), r.host_id, COALESCE(h.name, ''), r.shell_id, r.file_path, r.size, r.started_at, r.ended_at
+		FROM recordings r LEFT JOIN hosts h ON h.id = r.host_id LEFT JOIN users u ON u.id = r.user_id`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY r.started_at DESC"
+
+	rows, err := r.DB.QueryContext(ctx, Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recordings []models.Recording
+	for rows.Next() {
+		var rec models.Recording
+		err := rows.Scan(&rec.ID, &rec.UserID, &rec.Username, &rec.HostID, &rec.HostName, &rec.ShellID, &rec.FilePath, &rec.Size, &rec.StartedAt, &rec.EndedAt)
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, rec)
+	}
+	return recordings, nil
+}
+
+// GetByID gets a recording of the user by its ID.
+func (r *RecordingRepository) GetByID(ctx context.Context, recordingID, userID int) (*models.Recording, error) {
+	rec := &models.Recording{}
+	query := Rebind(`SELECT id, user_id, host_id, shell_id, file_path, size, started_at, ended_at FROM recordings WHERE id = $1 AND user_id = $2`)
+	err := r.DB.QueryRowContext(ctx, query, recordingID, userID).Scan(&rec.ID, &rec.UserID, &rec.HostID, &rec.ShellID, &rec.FilePath, &rec.Size, &rec.StartedAt, &rec.EndedAt)
+	return rec, err
+}
+
+// GetAnyByID gets a recording of any user by its ID, for the admin review.
+func (r *RecordingRepository) GetAnyByID(ctx context.Context, recordingID int) (*models.Recording, error) {
+	rec := &models.Recording{}
+	query := Rebind(`SELECT id, user_id, host_id, shell_id, file_path, size, started_at, ended_at FROM recordings WHERE id = $1`)
+	err := r.DB.QueryRowContext(ctx, query, recordingID).Scan(&rec.ID, &rec.UserID, &rec.HostID, &rec.ShellID, &rec.FilePath, &rec.Size, &rec.StartedAt, &rec.EndedAt)
+	return rec, err
+}
+
+// Create registers a recording that has just started.
+func (r *RecordingRepository) Create(ctx context.Context, rec *models.Recording) error {
+	query := Rebind(`INSERT INTO recordings (user_id, host_id, shell_id, file_path, started_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`)
+	return r.DB.QueryRowContext(ctx, query, rec.UserID, rec.HostID, rec.ShellID, rec.FilePath, rec.StartedAt).Scan(&rec.ID)
+}
+
+// Finish marks the recording as ended and stores its final size.
+func (r *RecordingRepository) Finish(ctx context.Context, recordingID int, endedAt time.Time, size int64) error {
+	query := Rebind(`UPDATE recordings SET ended_at = $1, size = $2 WHERE id = $3`)
+	_, err := r.DB.ExecContext(ctx, query, endedAt, size, recordingID)
+	return err
+}
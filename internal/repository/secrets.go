@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"ssh_manager/internal/encryption"
+)
+
+// encryptedColumns columns that hold values encrypted with the encryption keyring.
+var encryptedColumns = []struct {
+	table, column string
+}{
+	{"keys", "private_key"},
+	{"keys", "passphrase"},
+	{"hosts", "password"},
+	{"hosts", "totp_secret"},
+	{"users", "totp_secret"},
+}
+
+// ReencryptStats how many values of a column were re-encrypted.
+type ReencryptStats struct {
+	Table, Column      string
+	Total, Reencrypted int
+}
+
+// ReencryptSecrets re-encrypts every stored secret with the newest key in one transaction.
+// If any value cannot be decrypted nothing is changed.
+func ReencryptSecrets(ctx context.Context, db DBTX) ([]ReencryptStats, error) {
+	var stats []ReencryptStats
+	err := WithTx(ctx, db, func(tx DBTX) error {
+		stats = nil
+		for _, c := range encryptedColumns {
+			s, err := reencryptColumn(ctx, tx, c.table, c.column)
+			if err != nil {
+				return err
+			}
+			stats = append(stats, s)
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// reencryptColumn re-encrypts the non-empty values of one column.
+func reencryptColumn(ctx context.Context, tx DBTX, table, column string) (ReencryptStats, error) {
+	stats := ReencryptStats{Table: table, Column: column}
+
+	query := fmt.Sprintf(`SELECT id, %s FROM %s WHERE %s IS NOT NULL AND %s <> ''`, column, table, column, column)
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return stats, err
+	}
+
+	// The rows are read first, SQLite does not like updates while a query is open
+	values := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return stats, err
+		}
+		values[id] = value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	update := Rebind(fmt.Sprintf(`UPDATE %s SET %s = $1 WHERE id = $2`, table, column))
+	for id, value := range values {
+		stats.Total++
+		reencrypted, changed, err := encryption.Reencrypt(value)
+		if err != nil {
+			return stats, fmt.Errorf("%s.%s of row %d: %w", table, column, id, err)
+		}
+		if !changed {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, update, reencrypted, id); err != nil {
+			return stats, err
+		}
+		stats.Reencrypted++
+	}
+	return stats, nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type SettingsRepository struct {
+	DB DBTX
+}
+
+// Get returns the value of the setting, an empty string if it was never set.
+func (r *SettingsRepository) Get(ctx context.Context, name string) (string, error) {
+	var value string
+	query := Rebind(`SELECT value FROM app_settings WHERE name = $1`)
+	err := r.DB.QueryRowContext(ctx, query, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// GetBool reports whether the setting is "true".
+func (r *SettingsRepository) GetBool(ctx context.Context, name string) (bool, error) {
+	value, err := r.Get(ctx, name)
+	return value == "true", err
+}
+
+// Set saves the value of the setting.
+func (r *SettingsRepository) Set(ctx context.Context, name, value string) error {
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		if _, err := tx.ExecContext(ctx, Rebind(`DELETE FROM app_settings WHERE name = $1`), name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, Rebind(`INSERT INTO app_settings (name, value) VALUES ($1, $2)`), name, value)
+		return err
+	})
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"ssh_manager/internal/models"
+)
+
+type SnippetRepository struct {
+	DB DBTX
+}
+
+// GetByUserID gets the snippets the user owns or can use through group membership.
+func (r *SnippetRepository) GetByUserID(ctx context.Context, userID int) ([]models.Snippet, error) {
+	query := Rebind(`SELECT s.id, COALESCE(s.user_id, 0), s.name, s.command, s.description, s.group_id, COALESCE(g.name, ''), s.created_at
+		FROM snippets s LEFT JOIN user_groups g ON g.id = s.group_id
+		WHERE s.user_id = $1 OR s.group_id IN (SELECT group_id FROM group_members WHERE user_id = $2) ORDER BY s.name`)
+	rows, err := r.DB.QueryContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []models.Snippet
+	for rows.Next() {
+		var s models.Snippet
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Name, &s.Command, &s.Description, &s.GroupID, &s.GroupName, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		s.ParseVariables()
+		snippets = append(snippets, s)
+	}
+	return snippets, nil
+}
+
+// GetByID gets a snippet if the user owns it or is a member of its group.
+func (r *SnippetRepository) GetByID(ctx context.Context, snippetID, userID int) (*models.Snippet, error) {
+	s := &models.Snippet{}
+	query := Rebind(`SELECT s.id, COALESCE(s.user_id, 0), s.name, s.command, s.description, s.group_id, COALESCE(g.name, ''), s.created_at
+		FROM snippets s LEFT JOIN user_groups g ON g.id = s.group_id
+		WHERE s.id = $1 AND (s.user_id = $2 OR s.group_id IN (SELECT group_id FROM group_members WHERE user_id = $3))`)
+	err := r.DB.QueryRowContext(ctx, query, snippetID, userID, userID).Scan(&s.ID, &s.UserID, &s.Name, &s.Command, &s.Description, &s.GroupID, &s.GroupName, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.ParseVariables()
+	return s, nil
+}
+
+// Create creates a snippet.
+func (r *SnippetRepository) Create(ctx context.Context, s *models.Snippet) error {
+	query := Rebind(`INSERT INTO snippets (user_id, name, command, description, group_id) VALUES ($1, $2, $3, $4, $5) RETURNING id`)
+	return r.DB.QueryRowContext(ctx, query, s.UserID, s.Name, s.Command, s.Description, s.GroupID).Scan(&s.ID)
+}
+
+// Update updates the snippet of the owner, 0 for a shared snippet whose owner was deleted.
+// Group members only run shared snippets.
+func (r *SnippetRepository) Update(ctx context.Context, s *models.Snippet, ownerID int) error {
+	query := Rebind(`UPDATE snippets SET name = $1, command = $2, description = $3, group_id = $4
+		WHERE id = $5 AND COALESCE(user_id, 0) = $6`)
+	_, err := r.DB.ExecContext(ctx, query, s.Name, s.Command, s.Description, s.GroupID, s.ID, ownerID)
+	return err
+}
+
+// Delete deletes a snippet of the owner by ID, 0 for a shared snippet whose owner was deleted.
+func (r *SnippetRepository) Delete(ctx context.Context, snippetID, ownerID int) error {
+	query := Rebind(`DELETE FROM snippets WHERE id = $1 AND COALESCE(user_id, 0) = $2`)
+	_, err := r.DB.ExecContext(ctx, query, snippetID, ownerID)
+	return err
+}
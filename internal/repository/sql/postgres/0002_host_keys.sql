@@ -0,0 +1 @@
+CREATE TABLE host_keys (id SERIAL PRIMARY KEY, host_id INTEGER REFERENCES hosts(id) ON DELETE CASCADE, key_type TEXT NOT NULL, fingerprint TEXT NOT NULL, public_key TEXT NOT NULL, first_seen TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP);
@@ -0,0 +1,4 @@
+CREATE TABLE user_groups (id SERIAL PRIMARY KEY, name TEXT UNIQUE NOT NULL, created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP);
+CREATE TABLE group_members (group_id INTEGER NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE, user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, PRIMARY KEY (group_id, user_id));
+ALTER TABLE hosts ADD COLUMN group_id INTEGER REFERENCES user_groups(id);
+ALTER TABLE keys ADD COLUMN group_id INTEGER REFERENCES user_groups(id);
@@ -0,0 +1,4 @@
+-- Batch command runs kept as history, user_id has no foreign key like in recordings
+CREATE TABLE jobs (id SERIAL PRIMARY KEY, user_id INTEGER NOT NULL, command TEXT NOT NULL, status TEXT NOT NULL DEFAULT 'running', parallelism INTEGER NOT NULL, timeout_seconds INTEGER NOT NULL, created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP, finished_at TIMESTAMP WITH TIME ZONE);
+CREATE TABLE job_results (id SERIAL PRIMARY KEY, job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE, host_id INTEGER NOT NULL, host_name TEXT NOT NULL, status TEXT NOT NULL DEFAULT 'pending', exit_code INTEGER, stdout TEXT NOT NULL DEFAULT '', stderr TEXT NOT NULL DEFAULT '', error TEXT NOT NULL DEFAULT '', started_at TIMESTAMP WITH TIME ZONE, finished_at TIMESTAMP WITH TIME ZONE);
+CREATE INDEX idx_job_results_job_id ON job_results(job_id);
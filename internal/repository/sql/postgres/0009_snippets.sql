@@ -0,0 +1 @@
+CREATE TABLE snippets (id SERIAL PRIMARY KEY, user_id INTEGER REFERENCES users(id), group_id INTEGER REFERENCES user_groups(id), name TEXT NOT NULL, command TEXT NOT NULL, description TEXT NOT NULL DEFAULT '', created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP);
@@ -0,0 +1,4 @@
+-- public half of the private key, derived by the server
+ALTER TABLE keys ADD COLUMN public_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE keys ADD COLUMN fingerprint TEXT NOT NULL DEFAULT '';
+ALTER TABLE keys ADD COLUMN key_type TEXT NOT NULL DEFAULT '';
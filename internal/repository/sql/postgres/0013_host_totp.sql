@@ -0,0 +1,2 @@
+-- Encrypted base32 TOTP seed used to answer one-time code prompts of keyboard-interactive logins
+ALTER TABLE hosts ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
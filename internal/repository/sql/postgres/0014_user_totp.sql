@@ -0,0 +1,7 @@
+-- totp_secret is the encrypted seed of the authenticator app, empty while 2FA is off
+-- totp_counter is the period of the last accepted code, a code is never accepted twice
+ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN totp_counter BIGINT NOT NULL DEFAULT 0;
+CREATE TABLE recovery_codes (id SERIAL PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, code_hash TEXT NOT NULL);
+CREATE INDEX idx_recovery_codes_user ON recovery_codes (user_id);
+CREATE TABLE app_settings (name TEXT PRIMARY KEY, value TEXT NOT NULL);
@@ -0,0 +1,3 @@
+-- data is the JSON of the verified credential with its public key and sign counter
+CREATE TABLE webauthn_credentials (id SERIAL PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, name TEXT NOT NULL, credential_id TEXT NOT NULL UNIQUE, data TEXT NOT NULL, created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP, last_used_at TIMESTAMP WITH TIME ZONE);
+CREATE INDEX idx_webauthn_credentials_user ON webauthn_credentials (user_id);
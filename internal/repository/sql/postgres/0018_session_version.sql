@@ -0,0 +1,2 @@
+-- Raised when the password changes, sessions of an older version are logged out
+ALTER TABLE users ADD COLUMN session_version INTEGER NOT NULL DEFAULT 0;
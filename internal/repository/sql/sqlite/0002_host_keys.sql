@@ -0,0 +1 @@
+CREATE TABLE host_keys (id INTEGER PRIMARY KEY AUTOINCREMENT, host_id INTEGER REFERENCES hosts(id) ON DELETE CASCADE, key_type TEXT NOT NULL, fingerprint TEXT NOT NULL, public_key TEXT NOT NULL, first_seen DATETIME DEFAULT CURRENT_TIMESTAMP);
@@ -0,0 +1,2 @@
+-- user_id has no foreign key, recordings outlive deleted users for the audit
+CREATE TABLE recordings (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, host_id INTEGER NOT NULL, shell_id TEXT NOT NULL, file_path TEXT NOT NULL, size INTEGER DEFAULT 0, started_at DATETIME DEFAULT CURRENT_TIMESTAMP, ended_at DATETIME);
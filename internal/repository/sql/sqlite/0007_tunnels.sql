@@ -0,0 +1,2 @@
+-- direction is "local" (ssh -L, listens on the manager) or "remote" (ssh -R, listens on the host)
+CREATE TABLE tunnels (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, host_id INTEGER NOT NULL REFERENCES hosts(id) ON DELETE CASCADE, name TEXT NOT NULL, direction TEXT NOT NULL DEFAULT 'local', bind_address TEXT NOT NULL, bind_port INTEGER NOT NULL, target_host TEXT NOT NULL, target_port INTEGER NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);
@@ -0,0 +1,4 @@
+-- Batch command runs kept as history, user_id has no foreign key like in recordings
+CREATE TABLE jobs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, command TEXT NOT NULL, status TEXT NOT NULL DEFAULT 'running', parallelism INTEGER NOT NULL, timeout_seconds INTEGER NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, finished_at DATETIME);
+CREATE TABLE job_results (id INTEGER PRIMARY KEY AUTOINCREMENT, job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE, host_id INTEGER NOT NULL, host_name TEXT NOT NULL, status TEXT NOT NULL DEFAULT 'pending', exit_code INTEGER, stdout TEXT NOT NULL DEFAULT '', stderr TEXT NOT NULL DEFAULT '', error TEXT NOT NULL DEFAULT '', started_at DATETIME, finished_at DATETIME);
+CREATE INDEX idx_job_results_job_id ON job_results(job_id);
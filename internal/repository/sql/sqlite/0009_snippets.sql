@@ -0,0 +1 @@
+CREATE TABLE snippets (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER REFERENCES users(id), group_id INTEGER REFERENCES user_groups(id), name TEXT NOT NULL, command TEXT NOT NULL, description TEXT NOT NULL DEFAULT '', created_at DATETIME DEFAULT CURRENT_TIMESTAMP);
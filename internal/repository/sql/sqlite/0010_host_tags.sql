@@ -0,0 +1,4 @@
+-- folder is a slash separated path like "prod/db", empty for the top level
+ALTER TABLE hosts ADD COLUMN folder TEXT NOT NULL DEFAULT '';
+CREATE TABLE host_tags (host_id INTEGER NOT NULL REFERENCES hosts(id) ON DELETE CASCADE, tag TEXT NOT NULL, PRIMARY KEY (host_id, tag));
+CREATE INDEX idx_host_tags_tag ON host_tags (tag);
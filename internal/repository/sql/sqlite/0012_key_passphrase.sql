@@ -0,0 +1,4 @@
+-- passphrase_mode is empty for keys without a passphrase, "stored" if the encrypted passphrase is kept in passphrase
+-- and "prompt" if it is asked for on every connection
+ALTER TABLE keys ADD COLUMN passphrase TEXT NOT NULL DEFAULT '';
+ALTER TABLE keys ADD COLUMN passphrase_mode TEXT NOT NULL DEFAULT '';
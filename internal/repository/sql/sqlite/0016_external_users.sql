@@ -0,0 +1,5 @@
+-- auth_provider is where the user logs in: local (password) or an identity provider such as oidc
+-- external_id is the subject of the user at that provider, empty for local users
+ALTER TABLE users ADD COLUMN auth_provider TEXT NOT NULL DEFAULT 'local';
+ALTER TABLE users ADD COLUMN external_id TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX idx_users_external_id ON users (auth_provider, external_id) WHERE external_id <> '';
@@ -0,0 +1,5 @@
+-- Every failed login with the address and the browser it came from
+CREATE TABLE login_failures (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL, ip TEXT NOT NULL, user_agent TEXT NOT NULL DEFAULT '', reason TEXT NOT NULL, created_at DATETIME NOT NULL);
+CREATE INDEX idx_login_failures_created_at ON login_failures (created_at);
+-- Failures in a row per username (kind user) or address (kind ip), logins are refused until locked_until
+CREATE TABLE login_lockouts (kind TEXT NOT NULL, subject TEXT NOT NULL, failures INTEGER NOT NULL, last_failure DATETIME NOT NULL, locked_until DATETIME NOT NULL, PRIMARY KEY (kind, subject));
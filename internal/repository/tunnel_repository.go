@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"ssh_manager/internal/models"
+)
+
+type TunnelRepository struct {
+	DB DBTX
+}
+
+// tunnelColumns columns selected for a tunnel.
+const tunnelColumns = `id, user_id, host_id, name, direction, bind_address, bind_port, target_host, target_port, created_at`
+
+// GetByHostID gets the tunnels the user defined for the host.
+func (r *TunnelRepository) GetByHostID(ctx context.Context, hostID, userID int) ([]models.Tunnel, error) {
+	query := Rebind(`SELECT ` + tunnelColumns + ` FROM tunnels WHERE host_id = $1 AND user_id = $2 ORDER BY id`)
+	rows, err := r.DB.QueryContext(ctx, query, hostID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tunnels []models.Tunnel
+	for rows.Next() {
+		var t models.Tunnel
+		if err := rows.Scan(&t.ID, &t.UserID, &t.HostID, &t.Name, &t.Direction, &t.BindAddress, &t.BindPort, &t.TargetHost, &t.TargetPort, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tunnels = append(tunnels, t)
+	}
+	return tunnels, nil
+}
+
+// GetByID gets a tunnel of the user by its ID.
+func (r *TunnelRepository) GetByID(ctx context.Context, tunnelID, userID int) (*models.Tunnel, error) {
+	t := &models.Tunnel{}
+	query := Rebind(`SELECT ` + tunnelColumns + ` FROM tunnels WHERE id = $1 AND user_id = $2`)
+	err := r.DB.QueryRowContext(ctx, query, tunnelID, userID).Scan(&t.ID, &t.UserID, &t.HostID, &t.Name, &t.Direction, &t.BindAddress, &t.BindPort, &t.TargetHost, &t.TargetPort, &t.CreatedAt)
+	return t, err
+}
+
+// Create adds a new tunnel.
+func (r *TunnelRepository) Create(ctx context.Context, t *models.Tunnel) error {
+	query := Rebind(`INSERT INTO tunnels (user_id, host_id, name, direction, bind_address, bind_port, target_host, target_port) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`)
+	return r.DB.QueryRowContext(ctx, query, t.UserID, t.HostID, t.Name, t.Direction, t.BindAddress, t.BindPort, t.TargetHost, t.TargetPort).Scan(&t.ID)
+}
+
+// Delete deletes a tunnel of the user.
+func (r *TunnelRepository) Delete(ctx context.Context, tunnelID, userID int) error {
+	query := Rebind(`DELETE FROM tunnels WHERE id = $1 AND user_id = $2`)
+	_, err := r.DB.ExecContext(ctx, query, tunnelID, userID)
+	return err
+}
@@ -12,14 +12,76 @@ type UserRepository struct {
 // GetByUsername gets user data by name.
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	var u models.User
-	query := Rebind(`SELECT id, username, password_hash FROM users WHERE username = $1`)
-	err := r.DB.QueryRowContext(ctx, query, username).Scan(&u.ID, &u.Username, &u.PasswordHash)
+	query := Rebind(`SELECT id, username, password_hash, role, disabled, totp_secret, totp_counter, (SELECT COUNT(*) FROM webauthn_credentials w WHERE w.user_id = users.id), auth_provider, external_id, session_version, created_at FROM users WHERE username = $1`)
+	err := r.DB.QueryRowContext(ctx, query, username).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &u.TOTPSecret, &u.TOTPCounter, &u.Passkeys, &u.AuthProvider, &u.ExternalID, &u.SessionVersion, &u.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
+	u.TOTPEnabled = u.TOTPSecret != ""
 	return &u, nil
 }
 
+// GetByID gets user data by ID.
+func (r *UserRepository) GetByID(ctx context.Context, userID int) (*models.User, error) {
+	var u models.User
+	query := Rebind(`SELECT id, username, password_hash, role, disabled, totp_secret, totp_counter, (SELECT COUNT(*) FROM webauthn_credentials w WHERE w.user_id = users.id), auth_provider, external_id, session_version, created_at FROM users WHERE id = $1`)
+	err := r.DB.QueryRowContext(ctx, query, userID).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &u.TOTPSecret, &u.TOTPCounter, &u.Passkeys, &u.AuthProvider, &u.ExternalID, &u.SessionVersion, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	u.TOTPEnabled = u.TOTPSecret != ""
+	return &u, nil
+}
+
+// GetByExternalID gets the user with the subject at the identity provider.
+func (r *UserRepository) GetByExternalID(ctx context.Context, provider, externalID string) (*models.User, error) {
+	var u models.User
+	query := Rebind(`SELECT id, username, password_hash, role, disabled, totp_secret, totp_counter, (SELECT COUNT(*) FROM webauthn_credentials w WHERE w.user_id = users.id), auth_provider, external_id, session_version, created_at FROM users WHERE auth_provider = $1 AND external_id = $2`)
+	err := r.DB.QueryRowContext(ctx, query, provider, externalID).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &u.TOTPSecret, &u.TOTPCounter, &u.Passkeys, &u.AuthProvider, &u.ExternalID, &u.SessionVersion, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	u.TOTPEnabled = u.TOTPSecret != ""
+	return &u, nil
+}
+
+// GetAll gets all users ordered by name.
+func (r *UserRepository) GetAll(ctx context.Context) ([]models.User, error) {
+	query := Rebind(`SELECT id, username, role, disabled, totp_secret <> '', (SELECT COUNT(*) FROM webauthn_credentials w WHERE w.user_id = users.id), auth_provider, created_at FROM users ORDER BY username`)
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.Disabled, &u.TOTPEnabled, &u.Passkeys, &u.AuthProvider, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// CountActiveAdmins returns the number of admins that are not disabled.
+func (r *UserRepository) CountActiveAdmins(ctx context.Context) (int, error) {
+	var count int
+	query := Rebind(`SELECT COUNT(*) FROM users WHERE role = $1 AND disabled = $2`)
+	err := r.DB.QueryRowContext(ctx, query, models.RoleAdmin, false).Scan(&count)
+	return count, err
+}
+
+// Create creates a user, a local one unless the identity provider is set.
+func (r *UserRepository) Create(ctx context.Context, u *models.User) error {
+	if u.AuthProvider == "" {
+		u.AuthProvider = models.AuthLocal
+	}
+	query := Rebind(`INSERT INTO users (username, password_hash, role, disabled, auth_provider, external_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`)
+	return r.DB.QueryRowContext(ctx, query, u.Username, u.PasswordHash, u.Role, u.Disabled, u.AuthProvider, u.ExternalID).Scan(&u.ID)
+}
+
 // UpdateUSername updates the username by its ID.
 func (r *UserRepository) UpdateUSername(ctx context.Context, userID int, newUsername string) error {
 	query := Rebind(`UPDATE users SET username = $1 WHERE id = $2`)
@@ -27,9 +89,109 @@ func (r *UserRepository) UpdateUSername(ctx context.Context, userID int, newUser
 	return err
 }
 
-// UpdatePassword updates the user's password by its ID.
+// UpdatePassword updates the user's password by its ID and logs out the sessions started with the old one.
 func (r *UserRepository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
-	query := Rebind(`UPDATE users SET password_hash = $1 WHERE id = $2`)
+	query := Rebind(`UPDATE users SET password_hash = $1, session_version = session_version + 1 WHERE id = $2`)
 	_, err := r.DB.ExecContext(ctx, query, passwordHash, userID)
 	return err
 }
+
+// UpdateAccess updates the role and the disabled flag of the user.
+func (r *UserRepository) UpdateAccess(ctx context.Context, userID int, role string, disabled bool) error {
+	query := Rebind(`UPDATE users SET role = $1, disabled = $2 WHERE id = $3`)
+	_, err := r.DB.ExecContext(ctx, query, role, disabled, userID)
+	return err
+}
+
+// SetTOTP turns two-factor authentication on with the encrypted seed and the recovery code hashes,
+// or off with an empty seed. The old recovery codes are always removed.
+func (r *UserRepository) SetTOTP(ctx context.Context, userID int, secret string, codeHashes []string) error {
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		if _, err := tx.ExecContext(ctx, Rebind(`UPDATE users SET totp_secret = $1, totp_counter = 0 WHERE id = $2`), secret, userID); err != nil {
+			return err
+		}
+		return saveRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+}
+
+// UpdateTOTPCounter remembers the period of the last accepted code. Returns false if a code
+// of the same or a later period was accepted meanwhile.
+func (r *UserRepository) UpdateTOTPCounter(ctx context.Context, userID int, counter int64) (bool, error) {
+	query := Rebind(`UPDATE users SET totp_counter = $1 WHERE id = $2 AND totp_counter < $3`)
+	res, err := r.DB.ExecContext(ctx, query, counter, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ReplaceRecoveryCodes replaces the recovery codes of the user.
+func (r *UserRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		return saveRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+}
+
+// UseRecoveryCode removes the recovery code with the hash. Returns false if the user has no such code.
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	query := Rebind(`DELETE FROM recovery_codes WHERE user_id = $1 AND code_hash = $2`)
+	res, err := r.DB.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has.
+func (r *UserRepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var count int
+	query := Rebind(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1`)
+	err := r.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// saveRecoveryCodes replaces the recovery codes inside a transaction.
+func saveRecoveryCodes(ctx context.Context, tx DBTX, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, Rebind(`DELETE FROM recovery_codes WHERE user_id = $1`), userID); err != nil {
+		return err
+	}
+	query := Rebind(`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`)
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, query, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes the user together with their personal hosts, keys and snippets.
+// Those shared with a group stay with the group. Recordings are kept for the audit.
+func (r *UserRepository) Delete(ctx context.Context, userID int) error {
+	return WithTx(ctx, r.DB, func(tx DBTX) error {
+		queries := []string{
+			`DELETE FROM tunnels WHERE user_id = $1`,
+			`DELETE FROM host_keys WHERE host_id IN (SELECT id FROM hosts WHERE user_id = $1 AND group_id IS NULL)`,
+			`DELETE FROM host_tags WHERE host_id IN (SELECT id FROM hosts WHERE user_id = $1 AND group_id IS NULL)`,
+			`UPDATE hosts SET jump_host_id = NULL WHERE jump_host_id IN (SELECT id FROM hosts WHERE user_id = $1 AND group_id IS NULL)`,
+			`UPDATE hosts SET key_id = NULL WHERE key_id IN (SELECT id FROM keys WHERE user_id = $1 AND group_id IS NULL)`,
+			`DELETE FROM hosts WHERE user_id = $1 AND group_id IS NULL`,
+			`DELETE FROM keys WHERE user_id = $1 AND group_id IS NULL`,
+			`DELETE FROM snippets WHERE user_id = $1 AND group_id IS NULL`,
+			`UPDATE hosts SET user_id = NULL WHERE user_id = $1`,
+			`UPDATE keys SET user_id = NULL WHERE user_id = $1`,
+			`UPDATE snippets SET user_id = NULL WHERE user_id = $1`,
+			`DELETE FROM group_members WHERE user_id = $1`,
+			`DELETE FROM recovery_codes WHERE user_id = $1`,
+			`DELETE FROM webauthn_credentials WHERE user_id = $1`,
+			`DELETE FROM users WHERE id = $1`,
+		}
+		for _, q := range queries {
+			if _, err := tx.ExecContext(ctx, Rebind(q), userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
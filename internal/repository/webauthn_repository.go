@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"ssh_manager/internal/models"
+	"time"
+)
+
+type WebAuthnRepository struct {
+	DB DBTX
+}
+
+const webAuthnColumns = `id, user_id, name, credential_id, data, created_at, last_used_at`
+
+// scanWebAuthnCredential reads a row selected with webAuthnColumns.
+func scanWebAuthnCredential(row interface{ Scan(...interface{}) error }, c *models.WebAuthnCredential) error {
+	var data string
+	if err := row.Scan(&c.ID, &c.UserID, &c.Name, &c.CredentialID, &data, &c.CreatedAt, &c.LastUsedAt); err != nil {
+		return err
+	}
+	c.Data = []byte(data)
+	return nil
+}
+
+// GetByUserID gets the credentials of the user, the oldest first.
+func (r *WebAuthnRepository) GetByUserID(ctx context.Context, userID int) ([]models.WebAuthnCredential, error) {
+	query := Rebind(`SELECT ` + webAuthnColumns + ` FROM webauthn_credentials WHERE user_id = $1 ORDER BY id`)
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []models.WebAuthnCredential
+	for rows.Next() {
+		var c models.WebAuthnCredential
+		if err := scanWebAuthnCredential(rows, &c); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, c)
+	}
+	return credentials, rows.Err()
+}
+
+// GetByCredentialID gets a credential by the ID the authenticator gave it.
+func (r *WebAuthnRepository) GetByCredentialID(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	var c models.WebAuthnCredential
+	query := Rebind(`SELECT ` + webAuthnColumns + ` FROM webauthn_credentials WHERE credential_id = $1`)
+	if err := scanWebAuthnCredential(r.DB.QueryRowContext(ctx, query, credentialID), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Create saves a new credential.
+func (r *WebAuthnRepository) Create(ctx context.Context, c *models.WebAuthnCredential) error {
+	query := Rebind(`INSERT INTO webauthn_credentials (user_id, name, credential_id, data) VALUES ($1, $2, $3, $4) RETURNING id`)
+	return r.DB.QueryRowContext(ctx, query, c.UserID, c.Name, c.CredentialID, string(c.Data)).Scan(&c.ID)
+}
+
+// UpdateAfterLogin saves the credential data changed by a login (the sign counter, backup state) and the time.
+func (r *WebAuthnRepository) UpdateAfterLogin(ctx context.Context, id int, data []byte) error {
+	query := Rebind(`UPDATE webauthn_credentials SET data = $1, last_used_at = $2 WHERE id = $3`)
+	_, err := r.DB.ExecContext(ctx, query, string(data), time.Now().UTC(), id)
+	return err
+}
+
+// Delete deletes a credential of the user. Returns false if the user has no such credential.
+func (r *WebAuthnRepository) Delete(ctx context.Context, id, userID int) (bool, error) {
+	query := Rebind(`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`)
+	res, err := r.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteByUserID deletes all credentials of the user.
+func (r *WebAuthnRepository) DeleteByUserID(ctx context.Context, userID int) error {
+	query := Rebind(`DELETE FROM webauthn_credentials WHERE user_id = $1`)
+	_, err := r.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"ssh_manager/internal/models"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startAgentForwarding creates an in-memory agent with the host key and the additional keys chosen
+// for the host, and serves it to the host connection. The shells request it with RequestAgentForwarding.
+func (s *SSHService) startAgentForwarding(ctx context.Context, userID int, host *models.Host, client *ssh.Client, prompter Prompter) (agent.Agent, error) {
+	var keyIDs []int
+	if host.AuthType != "password" && host.KeyID != nil && *host.KeyID != 0 {
+		keyIDs = append(keyIDs, *host.KeyID)
+	}
+	keyIDs = append(keyIDs, host.Settings.AgentKeyIDs...)
+
+	keyring := agent.NewKeyring()
+	added := make(map[int]bool)
+	for _, keyID := range keyIDs {
+		if added[keyID] {
+			continue
+		}
+		added[keyID] = true
+
+		privateKey, err := s.privateKey(ctx, userID, keyID, prompter)
+		if err != nil {
+			keyring.RemoveAll()
+			return nil, fmt.Errorf("agent key %d: %w", keyID, err)
+		}
+		if err := keyring.Add(agent.AddedKey{PrivateKey: privateKey, Comment: fmt.Sprintf("ssh-manager key %d", keyID)}); err != nil {
+			keyring.RemoveAll()
+			return nil, fmt.Errorf("agent key %d: %w", keyID, err)
+		}
+	}
+
+	// ForwardToRemote needs a unix socket of a running agent, the keyring lives in memory instead
+	if err := agent.ForwardToAgent(client, keyring); err != nil {
+		keyring.RemoveAll()
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// destroyAgent wipes the keys of a forwarded agent.
+func destroyAgent(as *models.ActiveSession) {
+	if as.Agent == nil {
+		return
+	}
+	as.Agent.RemoveAll()
+	as.Agent = nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ssh_manager/internal/encryption"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/totp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrChallengeNotAvailable is returned when the server asks a question nobody can answer.
+var ErrChallengeNotAvailable = errors.New("the server asks for a one-time code, open a terminal to enter it")
+
+// Words of the questions answered with the stored password or the code of the stored TOTP seed.
+// Questions for a new password, e.g. of an expired one, are never answered with the stored password.
+var (
+	passwordQuestionWords    = []string{"password"}
+	newPasswordQuestionWords = []string{"new password", "new unix password", "retype", "re-enter"}
+	codeQuestionWords        = []string{"code", "otp", "token", "one-time", "one time", "verification", "2fa", "totp", "authenticator"}
+)
+
+// keyboardInteractive answers the questions of a keyboard-interactive login (PAM). Password questions get
+// the stored password, code questions the code of the stored TOTP seed, the rest goes to the prompter.
+func keyboardInteractive(host *models.Host, prompter Prompter) ssh.AuthMethod {
+	return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			answer, err := answerQuestion(host, prompter, strings.TrimSpace(name+"\n"+instruction), question, echos[i])
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = answer
+		}
+		return answers, nil
+	})
+}
+
+// answerQuestion answers a single question of a keyboard-interactive round.
+func answerQuestion(host *models.Host, prompter Prompter, instruction, question string, echo bool) (string, error) {
+	lower := strings.ToLower(question)
+
+	// Code questions come first, pam_oath asks for a "One-time password (OATH)"
+	if host.TOTPSecret != "" && containsAny(lower, codeQuestionWords) {
+		secret, err := encryption.Decrypt(host.TOTPSecret)
+		if err != nil {
+			return "", err
+		}
+		code, err := totp.Code(secret, time.Now())
+		if err != nil {
+			return "", fmt.Errorf("TOTP secret of host %q: %w", host.Name, err)
+		}
+		return code, nil
+	}
+
+	if !echo && host.AuthType == "password" && host.Password != "" &&
+		containsAny(lower, passwordQuestionWords) && !containsAny(lower, newPasswordQuestionWords) {
+		return encryption.Decrypt(host.Password)
+	}
+
+	if prompter == nil {
+		return "", fmt.Errorf("%w: host %q asks %q", ErrChallengeNotAvailable, host.Name, strings.TrimSpace(question))
+	}
+	return prompter.AnswerChallenge(host.Name, instruction, question, echo)
+}
+
+// containsAny reports whether s contains one of the words.
+func containsAny(s string, words []string) bool {
+	for _, word := range words {
+		if strings.Contains(s, word) {
+			return true
+		}
+	}
+	return false
+}
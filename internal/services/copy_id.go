@@ -0,0 +1,165 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"ssh_manager/internal/models"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// InstallKeyResult what InstallKey did on the host.
+type InstallKeyResult struct {
+	AuthorizedKeys string `json:"authorized_keys"` // Path of the file on the host
+	AlreadyPresent bool   `json:"already_present"` // The key was installed before, the file was left as it was
+	Fingerprint    string `json:"fingerprint"`
+}
+
+// InstallKey works like ssh-copy-id: it appends the public key to ~/.ssh/authorized_keys of the host
+// over the SFTP client of the user's session, unless it is already there, and fixes the permissions of
+// the directory and the file. Then it logs in with the key on a new connection and, only if that works,
+// switches the host to the key. The stored password is kept.
+func (s *SSHService) InstallKey(ctx context.Context, userID, hostID, keyID int) (*InstallKeyResult, error) {
+	host, err := s.HostRepo.GetByID(ctx, hostID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("host not found: %w", err)
+	}
+	key, err := s.KeyRepo.GetByID(ctx, keyID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("key not found: %w", err)
+	}
+	if key.PublicKey == "" {
+		return nil, fmt.Errorf("the public key of %q is unknown", key.Name)
+	}
+	if key.PassphraseMode == models.PassphrasePrompt {
+		return nil, fmt.Errorf("%w: key %q", ErrPassphraseNotAvailable, key.Name)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	as, err := s.GetSession(userID, hostID, ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	as.Mu.Lock()
+	sftpClient := as.SFTPClient
+	as.LastActivity = time.Now()
+	as.Mu.Unlock()
+	if sftpClient == nil {
+		return nil, errors.New("SFTP is not available on this host")
+	}
+
+	result := &InstallKeyResult{Fingerprint: key.Fingerprint}
+	result.AuthorizedKeys, result.AlreadyPresent, err = appendAuthorizedKey(sftpClient, publicKey, key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// A fresh login proves the key works before the host relies on it
+	test := *host
+	test.AuthType = "key"
+	test.KeyID = &keyID
+	client, jumpClients, err := s.dialHost(ctx, userID, &test, nil)
+	if err != nil {
+		return result, fmt.Errorf("the key was installed but logging in with it failed, the host was not changed: %w", err)
+	}
+	client.Close()
+	for i := len(jumpClients) - 1; i >= 0; i-- {
+		jumpClients[i].Close()
+	}
+
+	host.AuthType = "key"
+	host.KeyID = &keyID
+	if err := s.HostRepo.Update(ctx, host, host.UserID); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// appendAuthorizedKey adds the line to authorized_keys in the home directory of the SFTP user,
+// unless a line with the same key is there already. Returns the path of the file.
+func appendAuthorizedKey(client *sftp.Client, publicKey ssh.PublicKey, line string) (string, bool, error) {
+	home, err := client.Getwd()
+	if err != nil {
+		return "", false, fmt.Errorf("cannot find the home directory: %w", err)
+	}
+	dir := path.Join(home, ".ssh")
+	file := path.Join(dir, "authorized_keys")
+
+	if err := client.MkdirAll(dir); err != nil {
+		return file, false, fmt.Errorf("cannot create %s: %w", dir, err)
+	}
+	// sshd refuses keys in files others can write to
+	if err := client.Chmod(dir, 0o700); err != nil {
+		return file, false, fmt.Errorf("cannot set the permissions of %s: %w", dir, err)
+	}
+
+	var existing []byte
+	f, err := client.Open(file)
+	switch {
+	case err == nil:
+		existing, err = io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return file, false, fmt.Errorf("cannot read %s: %w", file, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return file, false, fmt.Errorf("cannot read %s: %w", file, err)
+	}
+
+	present := hasAuthorizedKey(existing, publicKey)
+	if !present {
+		f, err := client.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+		if err != nil {
+			return file, false, fmt.Errorf("cannot open %s: %w", file, err)
+		}
+		// The client writes at its own offset, not every server appends on its own
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return file, false, fmt.Errorf("cannot write %s: %w", file, err)
+		}
+		entry := line + "\n"
+		if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+			entry = "\n" + entry
+		}
+		_, err = f.Write([]byte(entry))
+		f.Close()
+		if err != nil {
+			return file, false, fmt.Errorf("cannot write %s: %w", file, err)
+		}
+	}
+
+	if err := client.Chmod(file, 0o600); err != nil {
+		return file, present, fmt.Errorf("cannot set the permissions of %s: %w", file, err)
+	}
+	return file, present, nil
+}
+
+// hasAuthorizedKey reports whether the authorized_keys content has a line for the key, whatever its options and comment.
+func hasAuthorizedKey(content []byte, publicKey ssh.PublicKey) bool {
+	want := publicKey.Marshal()
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err == nil && bytes.Equal(key.Marshal(), want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"ssh_manager/internal/encryption"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/sshkeys"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrJumpHostCycle is returned when the chain of jump hosts leads back to a host already in it.
+var ErrJumpHostCycle = errors.New("jump host chain contains a cycle")
+
+// handshakeTimeout how long the SSH handshake with one hop may take, the time the user is asked is not counted.
+const handshakeTimeout = 30 * time.Second
+
+// ErrPassphraseNotAvailable is returned when a key needs a passphrase but nobody can be asked for it.
+var ErrPassphraseNotAvailable = errors.New("the key passphrase is asked for when connecting, open a terminal to enter it")
+
+// authMethods builds the SSH authentication methods from the credentials stored for the host.
+// Keyboard-interactive comes last, for servers that ask for a one-time code after the password or key.
+func (s *SSHService) authMethods(ctx context.Context, userID int, host *models.Host, prompter Prompter) ([]ssh.AuthMethod, error) {
+	interactive := keyboardInteractive(host, prompter)
+
+	switch host.AuthType {
+	case "interactive":
+		return []ssh.AuthMethod{interactive}, nil
+	case "password":
+		if host.Password == "" {
+			return nil, fmt.Errorf("no password is set for host %q", host.Name)
+		}
+
+		decryptedPassword, err := encryption.Decrypt(host.Password)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.Password(decryptedPassword), interactive}, nil
+	}
+
+	if host.KeyID == nil {
+		return nil, fmt.Errorf("no key is selected for host %q", host.Name)
+	}
+
+	privateKey, err := s.privateKey(ctx, userID, *host.KeyID, prompter)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return []ssh.AuthMethod{ssh.PublicKeys(signer), interactive}, nil
+}
+
+// privateKey loads and decrypts a stored key the user has access to. The passphrase of a protected key
+// is either stored with it or asked for through the prompter.
+func (s *SSHService) privateKey(ctx context.Context, userID, keyID int, prompter Prompter) (interface{}, error) {
+	key, err := s.KeyRepo.GetByID(ctx, keyID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	decryptedKey, err := encryption.Decrypt(key.KeyData)
+	if err != nil {
+		return nil, err
+	}
+
+	var passphrase string
+	switch key.PassphraseMode {
+	case models.PassphraseStored:
+		if passphrase, err = encryption.Decrypt(key.Passphrase); err != nil {
+			return nil, err
+		}
+	case models.PassphrasePrompt:
+		if prompter == nil {
+			return nil, fmt.Errorf("%w: key %q", ErrPassphraseNotAvailable, key.Name)
+		}
+		if passphrase, err = prompter.AskPassphrase(key.ID, key.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	privateKey, err := sshkeys.Parse(decryptedKey, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", key.Name, err)
+	}
+	return privateKey, nil
+}
+
+// passphraseCache asks for the passphrase of every key only once while a session is opened,
+// the same key may be used by several jump hosts and the agent. Keys are told apart by ID,
+// a personal and a shared key may have the same name.
+type passphraseCache struct {
+	Prompter
+	passphrases map[int]string
+}
+
+// withPassphraseCache wraps the prompter, nil stays nil.
+func withPassphraseCache(prompter Prompter) Prompter {
+	if prompter == nil {
+		return nil
+	}
+	return &passphraseCache{Prompter: prompter, passphrases: make(map[int]string)}
+}
+
+// AskPassphrase asks for the passphrase unless it was already given.
+func (c *passphraseCache) AskPassphrase(keyID int, keyName string) (string, error) {
+	if passphrase, ok := c.passphrases[keyID]; ok {
+		return passphrase, nil
+	}
+	passphrase, err := c.Prompter.AskPassphrase(keyID, keyName)
+	if err != nil {
+		return "", err
+	}
+	c.passphrases[keyID] = passphrase
+	return passphrase, nil
+}
+
+// resolveJumpChain returns the hosts to pass through, from the outermost bastion to the target itself.
+func (s *SSHService) resolveJumpChain(ctx context.Context, userID int, host *models.Host) ([]*models.Host, error) {
+	chain := []*models.Host{host}
+	visited := map[int]bool{host.ID: true}
+
+	current := host
+	for current.JumpHostID != nil && *current.JumpHostID != 0 {
+		jumpID := *current.JumpHostID
+		if visited[jumpID] {
+			repeated := fmt.Sprintf("host %d", jumpID)
+			for _, h := range chain {
+				if h.ID == jumpID {
+					repeated = h.Name
+				}
+			}
+			return nil, jumpCycleError(chain, repeated)
+		}
+		visited[jumpID] = true
+
+		jump, err := s.HostRepo.GetByID(ctx, jumpID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("jump host %d of %q: %w", jumpID, current.Name, err)
+		}
+		chain = append([]*models.Host{jump}, chain...)
+		current = jump
+	}
+	return chain, nil
+}
+
+// ValidateJumpHost checks that using jumpHostID as the bastion of hostID does not create a cycle.
+// hostID is 0 for a host that is not saved yet.
+func (s *SSHService) ValidateJumpHost(ctx context.Context, userID, hostID int, jumpHostID *int) error {
+	if jumpHostID == nil || *jumpHostID == 0 {
+		return nil
+	}
+	if *jumpHostID == hostID {
+		return fmt.Errorf("%w: a host cannot be its own jump host", ErrJumpHostCycle)
+	}
+
+	jump, err := s.HostRepo.GetByID(ctx, *jumpHostID, userID)
+	if err != nil {
+		return fmt.Errorf("jump host not found: %w", err)
+	}
+
+	chain, err := s.resolveJumpChain(ctx, userID, jump)
+	if err != nil {
+		return err
+	}
+	for _, hop := range chain {
+		if hop.ID == hostID {
+			return jumpCycleError(chain, "this host")
+		}
+	}
+	return nil
+}
+
+// dialHost connects to the host, tunnelling through its jump hosts one hop after another.
+// Each hop uses its own credentials and pinned host keys. The returned jump clients have to be
+// closed together with the target client.
+func (s *SSHService) dialHost(ctx context.Context, userID int, host *models.Host, prompter Prompter) (*ssh.Client, []*ssh.Client, error) {
+	chain, err := s.resolveJumpChain(ctx, userID, host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+
+	for i, hop := range chain {
+		deadline := &handshakeDeadline{}
+		hopPrompter := withHandshakeDeadline(prompter, deadline)
+
+		auth, err := s.authMethods(ctx, userID, hop, hopPrompter)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+
+		algorithms, err := s.hostKeyAlgorithms(ctx, hop.ID)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+
+		addr := net.JoinHostPort(hop.Address, strconv.Itoa(hop.Port))
+		config := &ssh.ClientConfig{
+			User:              hop.Username,
+			Auth:              auth,
+			HostKeyCallback:   s.hostKeyCallback(ctx, hop.ID, hopPrompter),
+			HostKeyAlgorithms: algorithms,
+			Timeout:           10 * time.Second,
+		}
+
+		var conn net.Conn
+		if i == 0 {
+			conn, err = net.DialTimeout("tcp", addr, config.Timeout)
+		} else {
+			conn, err = clients[i-1].Dial("tcp", addr)
+		}
+		var client *ssh.Client
+		if err == nil {
+			client, err = handshake(ctx, conn, addr, config, deadline)
+		}
+		if err != nil {
+			closeAll()
+			if i < len(chain)-1 {
+				return nil, nil, fmt.Errorf("jump host %q: %w", hop.Name, err)
+			}
+			return nil, nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	return clients[len(clients)-1], clients[:len(clients)-1], nil
+}
+
+// handshake runs the SSH handshake on a connection to the hop. It is ended when the context is done
+// or the server hangs, which ClientConfig.Timeout does not cover.
+func handshake(ctx context.Context, conn net.Conn, addr string, config *ssh.ClientConfig, deadline *handshakeDeadline) (*ssh.Client, error) {
+	stopWatching := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stopWatching()
+
+	deadline.start(conn)
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !deadline.stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, fmt.Errorf("ssh handshake with %s timed out", addr)
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// handshakeDeadline closes the connection of a hop whose handshake takes too long. Channels through
+// a jump host have no deadlines, so a timer closes the connection instead.
+type handshakeDeadline struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired bool
+}
+
+// start starts the timer for the connection.
+func (d *handshakeDeadline) start(conn net.Conn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.timer = time.AfterFunc(handshakeTimeout, func() {
+		d.mu.Lock()
+		d.expired = true
+		d.mu.Unlock()
+		conn.Close()
+	})
+}
+
+// stop stops the timer after the handshake, false if it has already closed the connection.
+func (d *handshakeDeadline) stop() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	return !d.expired
+}
+
+// pause stops the timer while the user is asked, the handshake is not started yet when a passphrase is asked.
+func (d *handshakeDeadline) pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil && !d.expired {
+		d.timer.Stop()
+	}
+}
+
+// resume gives the server the whole timeout again after the user answered.
+func (d *handshakeDeadline) resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil && !d.expired {
+		d.timer.Reset(handshakeTimeout)
+	}
+}
+
+// deadlinePrompter pauses the handshake deadline of a hop while the user is asked.
+type deadlinePrompter struct {
+	Prompter
+	deadline *handshakeDeadline
+}
+
+// withHandshakeDeadline wraps the prompter, nil stays nil.
+func withHandshakeDeadline(prompter Prompter, deadline *handshakeDeadline) Prompter {
+	if prompter == nil {
+		return nil
+	}
+	return &deadlinePrompter{Prompter: prompter, deadline: deadline}
+}
+
+// ConfirmHostKey asks without the deadline running.
+func (p *deadlinePrompter) ConfirmHostKey(host, keyType, fingerprint string) (bool, error) {
+	p.deadline.pause()
+	defer p.deadline.resume()
+	return p.Prompter.ConfirmHostKey(host, keyType, fingerprint)
+}
+
+// AskPassphrase asks without the deadline running.
+func (p *deadlinePrompter) AskPassphrase(keyID int, keyName string) (string, error) {
+	p.deadline.pause()
+	defer p.deadline.resume()
+	return p.Prompter.AskPassphrase(keyID, keyName)
+}
+
+// AnswerChallenge asks without the deadline running.
+func (p *deadlinePrompter) AnswerChallenge(host, instruction, question string, echo bool) (string, error) {
+	p.deadline.pause()
+	defer p.deadline.resume()
+	return p.Prompter.AnswerChallenge(host, instruction, question, echo)
+}
+
+// jumpCycleError describes the cycle for the user, starting from the target host.
+func jumpCycleError(chain []*models.Host, repeated string) error {
+	names := make([]string, 0, len(chain)+1)
+	for i := len(chain) - 1; i >= 0; i-- {
+		names = append(names, chain[i].Name)
+	}
+	names = append(names, repeated)
+	return fmt.Errorf("%w: %s", ErrJumpHostCycle, strings.Join(names, " -> "))
+}
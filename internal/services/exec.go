@@ -0,0 +1,118 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"ssh_manager/internal/models"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// commandOutputLimit how many bytes of stdout and of stderr are kept for a non-interactive command.
+const commandOutputLimit = 256 * 1024
+
+// CommandResult output of a command run without a terminal.
+type CommandResult struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// RunCommand runs a command without a PTY on the user's host connection, connecting to the host if needed.
+// A non-zero exit code is not an error. When ctx is done first, the command is aborted and ctx.Err() is returned.
+func (s *SSHService) RunCommand(ctx context.Context, userID, hostID int, command string) (*CommandResult, error) {
+	type connectResult struct {
+		as  *models.ActiveSession
+		err error
+	}
+	connected := make(chan connectResult, 1)
+	go func() {
+		as, err := s.GetSession(userID, hostID, ctx, nil)
+		connected <- connectResult{as, err}
+	}()
+
+	var as *models.ActiveSession
+	select {
+	case res := <-connected:
+		if res.err != nil {
+			return nil, res.err
+		}
+		as = res.as
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// The connection is in use while the command runs
+	as.Mu.Lock()
+	as.RefCount++
+	as.LastActivity = time.Now()
+	as.Mu.Unlock()
+	defer func() {
+		as.Mu.Lock()
+		as.RefCount--
+		as.LastActivity = time.Now()
+		as.Mu.Unlock()
+	}()
+
+	sess, err := as.SSHClient.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+
+	stdout := &limitedBuffer{limit: commandOutputLimit}
+	stderr := &limitedBuffer{limit: commandOutputLimit}
+	sess.Stdout = stdout
+	sess.Stderr = stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.Run(command)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		sess.Close()
+		return &CommandResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: -1}, ctx.Err()
+	}
+
+	result := &CommandResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitStatus()
+		return result, nil
+	}
+	if err != nil {
+		result.ExitCode = -1
+		return result, err
+	}
+	return result, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"io"
+	"net"
+	"ssh_manager/internal/models"
+	"sync/atomic"
+	"time"
+)
+
+// pipeConns copies the data between the accepted connection and its target in both directions.
+// While the connection is open the host connection counts as used and is not cleaned up.
+func pipeConns(as *models.ActiveSession, f *models.Forwarder, conn, target net.Conn) {
+	if !trackConns(f, conn, target) {
+		return
+	}
+	defer untrackConns(f, conn, target)
+
+	as.Mu.Lock()
+	as.RefCount++
+	as.LastActivity = time.Now()
+	as.Mu.Unlock()
+	defer func() {
+		as.Mu.Lock()
+		as.RefCount--
+		as.LastActivity = time.Now()
+		as.Mu.Unlock()
+	}()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(&countingWriter{w: target, n: &f.BytesSent}, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(&countingWriter{w: conn, n: &f.BytesRecv}, target)
+		done <- struct{}{}
+	}()
+
+	// When one side is finished the other one is closed too
+	<-done
+	conn.Close()
+	target.Close()
+	<-done
+}
+
+// trackConns registers the connections of the forwarder, false if it is already stopped.
+func trackConns(f *models.Forwarder, conns ...io.Closer) bool {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	if f.Stopped {
+		return false
+	}
+	for _, c := range conns {
+		f.Conns[c] = true
+	}
+	f.Connections.Add(1)
+	f.Total.Add(1)
+	return true
+}
+
+// untrackConns removes the finished connections of the forwarder.
+func untrackConns(f *models.Forwarder, conns ...io.Closer) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	for _, c := range conns {
+		delete(f.Conns, c)
+	}
+	f.Connections.Add(-1)
+}
+
+// closeForwarder closes the listener and all open connections of the forwarder.
+func closeForwarder(f *models.Forwarder) {
+	f.Mu.Lock()
+	defer f.Mu.Unlock()
+	if f.Stopped {
+		return
+	}
+	f.Stopped = true
+	f.Listener.Close()
+	for c := range f.Conns {
+		c.Close()
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
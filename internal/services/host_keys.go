@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"ssh_manager/internal/models"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrHostKeyUnverified is returned when a host has no pinned key and there is nobody to confirm it.
+var ErrHostKeyUnverified = errors.New("host key is not verified yet, open a terminal to confirm it")
+
+// ErrHostKeyRejected is returned when the user declines the key offered by the server.
+var ErrHostKeyRejected = errors.New("host key was rejected by the user")
+
+// HostKeyMismatchError is returned when the server presents a key that differs from the pinned ones.
+type HostKeyMismatchError struct {
+	Host        string
+	KeyType     string
+	Fingerprint string
+	Expected    []string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key for %s has changed: got %s %s, expected %s",
+		e.Host, e.KeyType, e.Fingerprint, strings.Join(e.Expected, ", "))
+}
+
+// Prompter asks the user questions while a connection is being established.
+type Prompter interface {
+	// ConfirmHostKey asks whether an unknown host key should be trusted.
+	ConfirmHostKey(host, keyType, fingerprint string) (bool, error)
+	// AskPassphrase asks for the passphrase of a key that is not stored.
+	AskPassphrase(keyID int, keyName string) (string, error)
+	// AnswerChallenge asks one question of a keyboard-interactive login, e.g. for a one-time code.
+	AnswerChallenge(host, instruction, question string, echo bool) (string, error)
+}
+
+// hostKeyAlgorithms returns the algorithms of the keys pinned to the host, so that a server with several
+// host keys offers a pinned one. Nil if none are pinned yet.
+func (s *SSHService) hostKeyAlgorithms(ctx context.Context, hostID int) ([]string, error) {
+	pinned, err := s.HostKeyRepo.GetByHostID(ctx, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pinned host keys: %w", err)
+	}
+
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, k := range pinned {
+		types := []string{k.KeyType}
+		if k.KeyType == ssh.KeyAlgoRSA {
+			// An RSA key is verified with SHA-2 signatures first
+			types = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, t := range types {
+			if !seen[t] {
+				seen[t] = true
+				algorithms = append(algorithms, t)
+			}
+		}
+	}
+	return algorithms, nil
+}
+
+// hostKeyCallback verifies the server key against the keys pinned to the host (trust on first use).
+func (s *SSHService) hostKeyCallback(ctx context.Context, hostID int, prompter Prompter) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+
+		pinned, err := s.HostKeyRepo.GetByHostID(ctx, hostID)
+		if err != nil {
+			return fmt.Errorf("failed to load pinned host keys: %w", err)
+		}
+
+		if len(pinned) > 0 {
+			expected := make([]string, 0, len(pinned))
+			for _, k := range pinned {
+				if k.Fingerprint == fingerprint {
+					return nil
+				}
+				expected = append(expected, k.KeyType+" "+k.Fingerprint)
+			}
+			return &HostKeyMismatchError{
+				Host:        hostname,
+				KeyType:     key.Type(),
+				Fingerprint: fingerprint,
+				Expected:    expected,
+			}
+		}
+
+		// First connection: the user has to confirm the key
+		if prompter == nil {
+			return ErrHostKeyUnverified
+		}
+		accepted, err := prompter.ConfirmHostKey(hostname, key.Type(), fingerprint)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return ErrHostKeyRejected
+		}
+
+		return s.HostKeyRepo.Create(ctx, &models.HostKey{
+			HostID:      hostID,
+			KeyType:     key.Type(),
+			Fingerprint: fingerprint,
+			PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+			FirstSeen:   time.Now().UTC(),
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/repository"
+	"sync"
+	"time"
+)
+
+// jobEventBuffer how many events a slow watcher may lag behind before it misses some.
+const jobEventBuffer = 64
+
+// JobService runs a command on many hosts at once and streams the results to the watchers.
+type JobService struct {
+	SSHService *SSHService
+	JobRepo    *repository.JobRepository
+	Mu         sync.Mutex
+	watchers   map[int]map[chan models.JobResult]bool // [jobID], only for running jobs
+}
+
+// NewJobService creates a new instance of JobService.
+func NewJobService(sshService *SSHService, jobRepo *repository.JobRepository) *JobService {
+	return &JobService{
+		SSHService: sshService,
+		JobRepo:    jobRepo,
+		watchers:   make(map[int]map[chan models.JobResult]bool),
+	}
+}
+
+// Start stores the job with a pending result for each host and runs it in the background.
+// The job passed in keeps its state at the start.
+func (js *JobService) Start(ctx context.Context, job *models.Job) error {
+	job.Status = models.JobRunning
+	job.CreatedAt = time.Now()
+	for i := range job.Results {
+		job.Results[i].Status = models.ResultPending
+	}
+	if err := js.JobRepo.Create(ctx, job); err != nil {
+		return err
+	}
+
+	js.Mu.Lock()
+	js.watchers[job.ID] = make(map[chan models.JobResult]bool)
+	js.Mu.Unlock()
+
+	// The job runs on its own copy, the caller may still send the one it passed in
+	running := *job
+	running.Results = append([]models.JobResult(nil), job.Results...)
+	go js.run(&running)
+	return nil
+}
+
+// Watch subscribes to the result updates of a running job. The channel is closed when the job is finished,
+// ok is false if the job is not running.
+func (js *JobService) Watch(jobID int) (<-chan models.JobResult, func(), bool) {
+	js.Mu.Lock()
+	defer js.Mu.Unlock()
+
+	watchers, ok := js.watchers[jobID]
+	if !ok {
+		return nil, nil, false
+	}
+	ch := make(chan models.JobResult, jobEventBuffer)
+	watchers[ch] = true
+
+	unwatch := func() {
+		js.Mu.Lock()
+		defer js.Mu.Unlock()
+		if watchers[ch] {
+			delete(watchers, ch)
+			close(ch)
+		}
+	}
+	return ch, unwatch, true
+}
+
+// run executes the command on the hosts, at most job.Parallelism at a time.
+func (js *JobService) run(job *models.Job) {
+	slots := make(chan struct{}, job.Parallelism)
+	var wg sync.WaitGroup
+	for i := range job.Results {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(res *models.JobResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			js.runOnHost(job, res)
+		}(&job.Results[i])
+	}
+	wg.Wait()
+
+	if err := js.JobRepo.Finish(context.Background(), job.ID, models.JobFinished, time.Now()); err != nil {
+		log.Printf("[ERROR] Failed to finish job %d: %v", job.ID, err)
+	}
+
+	js.Mu.Lock()
+	for ch := range js.watchers[job.ID] {
+		close(ch)
+		delete(js.watchers[job.ID], ch)
+	}
+	delete(js.watchers, job.ID)
+	js.Mu.Unlock()
+}
+
+// runOnHost runs the command on one host within the job timeout.
+func (js *JobService) runOnHost(job *models.Job, res *models.JobResult) {
+	startedAt := time.Now()
+	res.Status = models.ResultRunning
+	res.StartedAt = &startedAt
+	js.saveResult(res)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(job.TimeoutSeconds)*time.Second)
+	defer cancel()
+	output, err := js.SSHService.RunCommand(ctx, job.UserID, res.HostID, job.Command)
+
+	finishedAt := time.Now()
+	res.FinishedAt = &finishedAt
+	if output != nil {
+		res.Stdout = output.Stdout
+		res.Stderr = output.Stderr
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		res.Status = models.ResultTimeout
+		res.Error = "command timed out"
+	case err != nil:
+		res.Status = models.ResultError
+		res.Error = err.Error()
+	case output.ExitCode == 0:
+		res.Status = models.ResultSuccess
+		res.ExitCode = &output.ExitCode
+	default:
+		res.Status = models.ResultFailed
+		res.ExitCode = &output.ExitCode
+	}
+	js.saveResult(res)
+}
+
+// saveResult stores the result and passes it to the watchers of the job.
+func (js *JobService) saveResult(res *models.JobResult) {
+	if err := js.JobRepo.UpdateResult(context.Background(), res); err != nil {
+		log.Printf("[ERROR] Failed to save result of job %d on host %d: %v", res.JobID, res.HostID, err)
+	}
+
+	js.Mu.Lock()
+	defer js.Mu.Unlock()
+	for ch := range js.watchers[res.JobID] {
+		select {
+		case ch <- *res:
+		default:
+			// The watcher gets the full job from the database when the job is finished
+		}
+	}
+}
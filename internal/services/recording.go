@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"ssh_manager/internal/models"
+	"ssh_manager/internal/recording"
+	"time"
+)
+
+// startRecording starts writing the shell to an asciicast file and registers it in the database.
+func (s *SSHService) startRecording(userID int, host *models.Host, shell *models.ShellSession) error {
+	if err := os.MkdirAll(s.RecordingsDir, 0700); err != nil {
+		return err
+	}
+
+	startedAt := time.Now().UTC()
+	path := filepath.Join(s.RecordingsDir, fmt.Sprintf("%d_%d_%s_%s.cast", userID, host.ID, startedAt.Format("20060102T150405"), shell.ID))
+
+	recorder, err := recording.NewRecorder(path, 80, 40, fmt.Sprintf("%s@%s", host.Username, host.Name))
+	if err != nil {
+		return err
+	}
+
+	rec := &models.Recording{
+		UserID:    userID,
+		HostID:    host.ID,
+		ShellID:   shell.ID,
+		FilePath:  path,
+		StartedAt: startedAt,
+	}
+	if err := s.RecordingRepo.Create(context.Background(), rec); err != nil {
+		recorder.Close()
+		os.Remove(path)
+		return err
+	}
+
+	shell.Recorder = recorder
+	shell.RecordingID = rec.ID
+	return nil
+}
+
+// finishRecording closes the recording file of the shell and stores its final size.
+func (s *SSHService) finishRecording(shell *models.ShellSession) {
+	size, err := shell.Recorder.Close()
+	if err != nil {
+		log.Printf("Failed to close recording %d: %v", shell.RecordingID, err)
+	}
+	if err := s.RecordingRepo.Finish(context.Background(), shell.RecordingID, time.Now().UTC(), size); err != nil {
+		log.Printf("Failed to finish recording %d: %v", shell.RecordingID, err)
+	}
+}
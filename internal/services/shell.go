@@ -0,0 +1,257 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"ssh_manager/internal/models"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// outputBufferSize how many bytes of the shell output are kept for the newly connected clients.
+const outputBufferSize = 51200
+
+// ErrShellNotFound is returned when the requested shell does not exist on the host connection.
+var ErrShellNotFound = errors.New("shell session not found")
+
+// ShellInfo frontend structure.
+type ShellInfo struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Clients   int       `json:"clients"`
+}
+
+// OpenShell opens a new shell channel with its own PTY on the shared host connection.
+func (s *SSHService) OpenShell(userID, hostID int, as *models.ActiveSession) (*models.ShellSession, error) {
+	sshSess, err := as.SSHClient.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	stdin, _ := sshSess.StdinPipe()
+	stdout, _ := sshSess.StdoutPipe()
+	stderr, _ := sshSess.StderrPipe()
+
+	err = sshSess.RequestPty("xterm-256color", 40, 80, ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	})
+	if err != nil {
+		sshSess.Close()
+		return nil, err
+	}
+	if as.Agent != nil {
+		if err := agent.RequestAgentForwarding(sshSess); err != nil {
+			// The shell is still usable, only the agent is missing in it
+			log.Printf("[WARN] Agent forwarding was refused by host %d: %v", hostID, err)
+		}
+	}
+	if err := sshSess.Shell(); err != nil {
+		sshSess.Close()
+		return nil, err
+	}
+
+	shell := &models.ShellSession{
+		ID:           newShellID(),
+		SSHSession:   sshSess,
+		Stdin:        stdin,
+		OutputBuffer: make([]byte, 0),
+		CreatedAt:    time.Now(),
+		Clients:      make(map[chan []byte]bool),
+	}
+
+	if as.Host != nil && as.Host.Settings.RecordSessions {
+		if err := s.startRecording(userID, as.Host, shell); err != nil {
+			// Auditing is required for this host, so the shell is not given out without it
+			sshSess.Close()
+			return nil, fmt.Errorf("failed to start session recording: %w", err)
+		}
+	}
+
+	// Registered before the output is read, a shell that exits at once is cleaned up by its ID
+	as.Mu.Lock()
+	as.Shells[shell.ID] = shell
+	as.LastActivity = time.Now()
+	as.Mu.Unlock()
+
+	// Background reading of SSH output
+	go func() {
+		combined := io.MultiReader(stdout, stderr)
+		buf := make([]byte, 4096)
+		for {
+			n, err := combined.Read(buf)
+			if err != nil {
+				s.shellExited(userID, hostID, shell.ID)
+				return
+			}
+
+			data := make([]byte, n)
+			copy(data, buf[:n])
+
+			if shell.Recorder != nil {
+				shell.Recorder.Output(data)
+			}
+
+			shell.Mu.Lock()
+			shell.OutputBuffer = append(shell.OutputBuffer, data...)
+			if len(shell.OutputBuffer) > outputBufferSize {
+				shell.OutputBuffer = shell.OutputBuffer[len(shell.OutputBuffer)-outputBufferSize:]
+			}
+
+			for ch := range shell.Clients {
+				select {
+				case ch <- data:
+				default:
+				}
+			}
+			shell.Mu.Unlock()
+		}
+	}()
+
+	return shell, nil
+}
+
+// GetShell returns a shell of the connection by its ID.
+// An empty ID means the oldest shell, which is opened if the connection has none yet.
+func (s *SSHService) GetShell(userID, hostID int, as *models.ActiveSession, shellID string) (*models.ShellSession, error) {
+	if shellID != "" {
+		as.Mu.Lock()
+		shell, ok := as.Shells[shellID]
+		as.Mu.Unlock()
+		if !ok {
+			return nil, ErrShellNotFound
+		}
+		return shell, nil
+	}
+
+	// Clients connecting at the same time share the first shell instead of opening one each
+	as.ShellMu.Lock()
+	defer as.ShellMu.Unlock()
+
+	as.Mu.Lock()
+	var oldest *models.ShellSession
+	for _, shell := range as.Shells {
+		if oldest == nil || shell.CreatedAt.Before(oldest.CreatedAt) {
+			oldest = shell
+		}
+	}
+	as.Mu.Unlock()
+
+	if oldest != nil {
+		return oldest, nil
+	}
+	return s.OpenShell(userID, hostID, as)
+}
+
+// ListShells returns the shells opened on the user's host connection.
+func (s *SSHService) ListShells(userID, hostID int) []ShellInfo {
+	s.Mu.RLock()
+	as, ok := s.Sessions[userID][hostID]
+	s.Mu.RUnlock()
+
+	result := make([]ShellInfo, 0)
+	if !ok {
+		return result
+	}
+
+	as.Mu.Lock()
+	for _, shell := range as.Shells {
+		shell.Mu.Lock()
+		result = append(result, ShellInfo{
+			ID:        shell.ID,
+			CreatedAt: shell.CreatedAt,
+			Clients:   len(shell.Clients),
+		})
+		shell.Mu.Unlock()
+	}
+	as.Mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// CloseShell closes a single shell, the host connection stays alive.
+func (s *SSHService) CloseShell(userID, hostID int, shellID string) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	as, ok := s.Sessions[userID][hostID]
+	if !ok {
+		return ErrShellNotFound
+	}
+
+	as.Mu.Lock()
+	defer as.Mu.Unlock()
+
+	shell, ok := as.Shells[shellID]
+	if !ok {
+		return ErrShellNotFound
+	}
+	s.closeShell(shell)
+	delete(as.Shells, shellID)
+	return nil
+}
+
+// shellExited cleans up after a shell ended on its own (exit, connection loss).
+// When the last shell is gone and no tunnel or proxy is running the whole host connection is terminated.
+func (s *SSHService) shellExited(userID, hostID int, shellID string) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	as, ok := s.Sessions[userID][hostID]
+	if !ok {
+		return
+	}
+
+	as.Mu.Lock()
+	shell, ok := as.Shells[shellID]
+	if ok {
+		s.closeShell(shell)
+		delete(as.Shells, shellID)
+	}
+	remaining := len(as.Shells) + len(as.Tunnels) + len(as.Proxies)
+	as.Mu.Unlock()
+
+	if ok && remaining == 0 {
+		s.terminateSessionUnsafe(userID, hostID)
+	}
+}
+
+// closeShell closes the shell channel, finishes its recording and notifies its clients.
+func (s *SSHService) closeShell(shell *models.ShellSession) {
+	if shell.SSHSession != nil {
+		shell.SSHSession.Close()
+	}
+	if shell.Stdin != nil {
+		shell.Stdin.Close()
+	}
+	if shell.Recorder != nil {
+		s.finishRecording(shell)
+	}
+
+	shell.Mu.Lock()
+	for ch := range shell.Clients {
+		select {
+		case ch <- []byte("[STOPSESSION]"):
+		default:
+		}
+	}
+	shell.Mu.Unlock()
+}
+
+// newShellID generates a random shell ID.
+func newShellID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
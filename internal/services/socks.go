@@ -0,0 +1,329 @@
+package services
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"ssh_manager/internal/models"
+	"strconv"
+	"time"
+)
+
+// socksHandshakeTimeout how long a SOCKS client may take to negotiate before it is dropped.
+const socksHandshakeTimeout = 30 * time.Second
+
+// SOCKS5 protocol values (RFC 1928, RFC 1929).
+const (
+	socksVersion     = 0x05
+	socksAuthVersion = 0x01
+	socksNoAuth      = 0x00
+	socksUserPass    = 0x02
+	socksNoMethods   = 0xFF
+	socksConnect     = 0x01
+	socksIPv4        = 0x01
+	socksDomain      = 0x03
+	socksIPv6        = 0x04
+
+	socksSucceeded        = 0x00
+	socksGeneralFailure   = 0x01
+	socksCmdNotSupported  = 0x07
+	socksAddrNotSupported = 0x08
+	socksAuthSucceeded    = 0x00
+	socksAuthFailed       = 0x01
+)
+
+var (
+	// ErrProxyRunning is returned when the connection already has a proxy on the port.
+	ErrProxyRunning = errors.New("proxy is already running on this port")
+	// ErrProxyNotRunning is returned when a proxy that is not running is stopped.
+	ErrProxyNotRunning = errors.New("proxy is not running")
+)
+
+// ProxyInfo frontend structure.
+type ProxyInfo struct {
+	HostID           int       `json:"host_id"`
+	HostName         string    `json:"host_name"`
+	BindAddress      string    `json:"bind_address"`
+	BindPort         int       `json:"bind_port"`
+	Username         string    `json:"username,omitempty"`
+	StartedAt        time.Time `json:"started_at"`
+	Connections      int64     `json:"connections"`
+	TotalConnections int64     `json:"total_connections"`
+	BytesSent        int64     `json:"bytes_sent"`
+	BytesReceived    int64     `json:"bytes_received"`
+}
+
+// StartProxy starts a SOCKS5 proxy on the manager that opens its connections through the host, like ssh -D.
+// A running proxy keeps the host connection from being cleaned up until it is stopped.
+func (s *SSHService) StartProxy(as *models.ActiveSession, bindAddress string, bindPort int, username, password string) (*models.ActiveProxy, error) {
+	as.Mu.Lock()
+	defer as.Mu.Unlock()
+
+	if _, ok := as.Proxies[bindPort]; ok {
+		return nil, ErrProxyRunning
+	}
+
+	bindAddr := net.JoinHostPort(bindAddress, strconv.Itoa(bindPort))
+	listener, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", bindAddr, err)
+	}
+
+	p := &models.ActiveProxy{
+		HostID:      as.HostID,
+		BindAddress: bindAddress,
+		BindPort:    bindPort,
+		Username:    username,
+		Password:    password,
+	}
+	p.Listener = listener
+	p.StartedAt = time.Now()
+	p.Conns = make(map[io.Closer]bool)
+	if as.Proxies == nil {
+		as.Proxies = make(map[int]*models.ActiveProxy)
+	}
+	as.Proxies[bindPort] = p
+	as.RefCount++
+	as.LastActivity = time.Now()
+
+	go s.serveProxy(as, p, listener)
+	return p, nil
+}
+
+// StopProxy stops a running proxy and closes its connections, the host connection stays alive.
+func (s *SSHService) StopProxy(userID, hostID, bindPort int) error {
+	s.Mu.RLock()
+	as, ok := s.Sessions[userID][hostID]
+	s.Mu.RUnlock()
+	if !ok {
+		return ErrProxyNotRunning
+	}
+
+	as.Mu.Lock()
+	defer as.Mu.Unlock()
+	p, ok := as.Proxies[bindPort]
+	if !ok {
+		return ErrProxyNotRunning
+	}
+	removeProxy(as, p)
+	return nil
+}
+
+// ListProxies returns the running proxies of all the user's host connections.
+func (s *SSHService) ListProxies(userID int) []ProxyInfo {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+
+	result := make([]ProxyInfo, 0)
+	for _, as := range s.Sessions[userID] {
+		as.Mu.Lock()
+		for _, p := range as.Proxies {
+			info := ProxyInfo{
+				HostID:           p.HostID,
+				BindAddress:      p.BindAddress,
+				BindPort:         p.BindPort,
+				Username:         p.Username,
+				StartedAt:        p.StartedAt,
+				Connections:      p.Connections.Load(),
+				TotalConnections: p.Total.Load(),
+				BytesSent:        p.BytesSent.Load(),
+				BytesReceived:    p.BytesRecv.Load(),
+			}
+			if as.Host != nil {
+				info.HostName = as.Host.Name
+			}
+			result = append(result, info)
+		}
+		as.Mu.Unlock()
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].BindPort < result[j].BindPort
+	})
+	return result
+}
+
+// serveProxy accepts the SOCKS clients until the listener is closed.
+func (s *SSHService) serveProxy(as *models.ActiveSession, p *models.ActiveProxy, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			p.Mu.Lock()
+			stopped := p.Stopped
+			p.Mu.Unlock()
+			if !stopped {
+				log.Printf("[WARN] SOCKS proxy on port %d stopped accepting connections: %v", p.BindPort, err)
+				as.Mu.Lock()
+				if as.Proxies[p.BindPort] == p {
+					removeProxy(as, p)
+				}
+				as.Mu.Unlock()
+			}
+			return
+		}
+		go s.proxyConn(as, p, conn)
+	}
+}
+
+// proxyConn negotiates with a SOCKS client and connects it to its destination through the host.
+func (s *SSHService) proxyConn(as *models.ActiveSession, p *models.ActiveProxy, conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	target, err := socksHandshake(conn, p.Username, p.Password, func(addr string) (net.Conn, error) {
+		return as.SSHClient.Dial("tcp", addr)
+	})
+	if err != nil {
+		log.Printf("[WARN] SOCKS proxy on port %d, client %s: %v", p.BindPort, conn.RemoteAddr(), err)
+		return
+	}
+	defer target.Close()
+	_ = conn.SetDeadline(time.Time{})
+
+	pipeConns(as, &p.Forwarder, conn, target)
+}
+
+// socksHandshake authenticates the client, reads its CONNECT request and dials the destination.
+// Only CONNECT is supported, which covers what browsers and most tools use.
+func socksHandshake(conn io.ReadWriter, username, password string, dial func(addr string) (net.Conn, error)) (net.Conn, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[0] != socksVersion {
+		return nil, fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, err
+	}
+
+	method := byte(socksNoAuth)
+	if username != "" {
+		method = socksUserPass
+	}
+	offered := false
+	for _, m := range methods {
+		if m == method {
+			offered = true
+		}
+	}
+	if !offered {
+		_, _ = conn.Write([]byte{socksVersion, socksNoMethods})
+		return nil, errors.New("client offered no acceptable authentication method")
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return nil, err
+	}
+
+	if method == socksUserPass {
+		if err := socksAuthenticate(conn, username, password); err != nil {
+			return nil, err
+		}
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, err
+	}
+	if request[1] != socksConnect {
+		socksReply(conn, socksCmdNotSupported)
+		return nil, fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksIPv4, socksIPv6:
+		ip := make([]byte, net.IPv4len)
+		if request[3] == socksIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return nil, err
+		}
+		host = string(domain)
+	default:
+		socksReply(conn, socksAddrNotSupported)
+		return nil, fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+
+	target, err := dial(addr)
+	if err != nil {
+		socksReply(conn, socksGeneralFailure)
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	socksReply(conn, socksSucceeded)
+	return target, nil
+}
+
+// socksAuthenticate checks the username and password of the client (RFC 1929).
+func socksAuthenticate(conn io.ReadWriter, username, password string) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socksAuthVersion {
+		return fmt.Errorf("unsupported SOCKS auth version %d", header[0])
+	}
+	user := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, user); err != nil {
+		return err
+	}
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return err
+	}
+	pass := make([]byte, length[0])
+	if _, err := io.ReadFull(conn, pass); err != nil {
+		return err
+	}
+
+	userOK := subtle.ConstantTimeCompare(user, []byte(username)) == 1
+	passOK := subtle.ConstantTimeCompare(pass, []byte(password)) == 1
+	if !userOK || !passOK {
+		_, _ = conn.Write([]byte{socksAuthVersion, socksAuthFailed})
+		return fmt.Errorf("authentication failed for user %q", user)
+	}
+	_, err := conn.Write([]byte{socksAuthVersion, socksAuthSucceeded})
+	return err
+}
+
+// socksReply answers a CONNECT request, the bound address is not reported.
+func socksReply(conn io.Writer, code byte) {
+	_, _ = conn.Write([]byte{socksVersion, code, 0x00, socksIPv4, 0, 0, 0, 0, 0, 0})
+}
+
+// removeProxy stops the proxy and releases the host connection it held, the caller holds as.Mu.
+func removeProxy(as *models.ActiveSession, p *models.ActiveProxy) {
+	closeForwarder(&p.Forwarder)
+	delete(as.Proxies, p.BindPort)
+	as.RefCount--
+}
+
+// closeProxies stops all proxies of the connection, the caller holds as.Mu.
+func closeProxies(as *models.ActiveSession) {
+	for _, p := range as.Proxies {
+		removeProxy(as, p)
+	}
+}
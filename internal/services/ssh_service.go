@@ -3,22 +3,23 @@ package services
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
-	"ssh_manager/internal/encryption"
 	"ssh_manager/internal/models"
 	"ssh_manager/internal/repository"
 	"sync"
 	"time"
 
 	"github.com/pkg/sftp"
-	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 // SSHService manages the lifecycle of active SSH connections.
 type SSHService struct {
 	HostRepo        *repository.HostRepository
 	KeyRepo         *repository.KeyRepository
+	HostKeyRepo     *repository.HostKeyRepository
+	RecordingRepo   *repository.RecordingRepository
+	RecordingsDir   string
 	Sessions        map[int]map[int]*models.ActiveSession // [userID][hostID]
 	Mu              sync.RWMutex
 	CleanupInterval time.Duration
@@ -26,10 +27,13 @@ type SSHService struct {
 }
 
 // NewSSHService creates a new instance of SSHService and starts it.
-func NewSSHService(hRepo *repository.HostRepository, kRepo *repository.KeyRepository, cleanupInterval, sessionTimeout time.Duration) *SSHService {
+func NewSSHService(hRepo *repository.HostRepository, kRepo *repository.KeyRepository, hkRepo *repository.HostKeyRepository, rRepo *repository.RecordingRepository, recordingsDir string, cleanupInterval, sessionTimeout time.Duration) *SSHService {
 	s := &SSHService{
 		HostRepo:        hRepo,
 		KeyRepo:         kRepo,
+		HostKeyRepo:     hkRepo,
+		RecordingRepo:   rRepo,
+		RecordingsDir:   recordingsDir,
 		Sessions:        make(map[int]map[int]*models.ActiveSession),
 		CleanupInterval: cleanupInterval,
 		SessionTimeout:  sessionTimeout,
@@ -39,7 +43,8 @@ func NewSSHService(hRepo *repository.HostRepository, kRepo *repository.KeyReposi
 }
 
 // GetSession searches for an existing session or creates a new one.
-func (s *SSHService) GetSession(userID, hostID int, ctx context.Context) (*models.ActiveSession, error) {
+// The prompter is used to confirm unknown host keys, it may be nil when nobody can answer.
+func (s *SSHService) GetSession(userID, hostID int, ctx context.Context, prompter Prompter) (*models.ActiveSession, error) {
 	s.Mu.Lock()
 	if s.Sessions[userID] == nil {
 		s.Sessions[userID] = make(map[int]*models.ActiveSession)
@@ -53,77 +58,42 @@ func (s *SSHService) GetSession(userID, hostID int, ctx context.Context) (*model
 	}
 
 	// If there is no session, create a new one
-	return s.initNewSession(userID, hostID, ctx)
+	return s.initNewSession(userID, hostID, ctx, prompter)
+}
+
+// FindSession returns the open connection of the user to the host without connecting.
+func (s *SSHService) FindSession(userID, hostID int) (*models.ActiveSession, bool) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	as, ok := s.Sessions[userID][hostID]
+	return as, ok
 }
 
 // initNewSession creates a new ssh session.
-func (s *SSHService) initNewSession(userID, hostID int, ctx context.Context) (*models.ActiveSession, error) {
+func (s *SSHService) initNewSession(userID, hostID int, ctx context.Context, prompter Prompter) (*models.ActiveSession, error) {
 	host, err := s.HostRepo.GetByID(ctx, hostID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	var authMethods []ssh.AuthMethod
-
-	if host.AuthType == "password" {
-		if host.Password == "" {
-			return nil, err
-		}
-
-		decryptedPassword, err := encryption.Decrypt(host.Password)
-		if err != nil {
-			return nil, err
-		}
-		authMethods = append(authMethods, ssh.Password(decryptedPassword))
-	} else {
-		if host.KeyID == nil {
-			return nil, err
-		}
-
-		key, err := s.KeyRepo.GetByID(ctx, *host.KeyID, userID)
-		if err != nil {
-			return nil, err
-		}
-
-		decryptedKey, err := encryption.Decrypt(key.KeyData)
-		if err != nil {
-			return nil, err
-		}
-
-		signer, err := ssh.ParsePrivateKey([]byte(decryptedKey))
-		if err != nil {
-			return nil, err
-		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-	}
-
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host.Address, host.Port), &ssh.ClientConfig{
-		User:            host.Username,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
-	})
+	prompter = withPassphraseCache(prompter)
+	client, jumpClients, err := s.dialHost(ctx, userID, host, prompter)
 	if err != nil {
-		return nil, fmt.Errorf("Connection failed: %v", err)
+		return nil, fmt.Errorf("Connection failed: %w", err)
 	}
 
-	sshSess, err := client.NewSession()
-	if err != nil {
-		client.Close()
-		return nil, err
+	var keyring agent.Agent
+	if host.Settings.AgentForwarding {
+		keyring, err = s.startAgentForwarding(ctx, userID, host, client, prompter)
+		if err != nil {
+			client.Close()
+			for i := len(jumpClients) - 1; i >= 0; i-- {
+				jumpClients[i].Close()
+			}
+			return nil, fmt.Errorf("agent forwarding failed: %w", err)
+		}
 	}
 
-	stdin, _ := sshSess.StdinPipe()
-	stdout, _ := sshSess.StdoutPipe()
-	stderr, _ := sshSess.StderrPipe()
-
-	sshSess.RequestPty("xterm-256color", 40, 80, ssh.TerminalModes{
-		ssh.ECHO:          1,
-		ssh.TTY_OP_ISPEED: 14400,
-		ssh.TTY_OP_OSPEED: 14400,
-	})
-	sshSess.Shell()
-
 	sftpClient, err := sftp.NewClient(client)
 	if err != nil {
 		log.Printf("SFTP sub-protocol failed for host %d: %v", hostID, err)
@@ -132,45 +102,17 @@ func (s *SSHService) initNewSession(userID, hostID int, ctx context.Context) (*m
 
 	as := &models.ActiveSession{
 		HostID:       hostID,
+		Host:         host,
 		SSHClient:    client,
-		SSHSession:   sshSess,
+		JumpClients:  jumpClients,
 		SFTPClient:   sftpClient,
-		Stdin:        stdin,
-		Clients:      make(map[chan []byte]bool),
+		Agent:        keyring,
+		Shells:       make(map[string]*models.ShellSession),
+		Tunnels:      make(map[int]*models.ActiveTunnel),
+		Proxies:      make(map[int]*models.ActiveProxy),
 		LastActivity: time.Now(),
-		OutputBuffer: make([]byte, 0),
 	}
 
-	// Background reading of SSH output
-	go func() {
-		combined := io.MultiReader(stdout, stderr)
-		buf := make([]byte, 4096)
-		for {
-			n, err := combined.Read(buf)
-			if err != nil {
-				s.TerminateSession(userID, hostID)
-				return
-			}
-
-			data := make([]byte, n)
-			copy(data, buf[:n])
-
-			as.Mu.Lock()
-			as.OutputBuffer = append(as.OutputBuffer, data...)
-			if len(as.OutputBuffer) > 51200 {
-				as.OutputBuffer = as.OutputBuffer[len(as.OutputBuffer)-51200:]
-			}
-
-			for ch := range as.Clients {
-				select {
-				case ch <- data:
-				default:
-				}
-			}
-			as.Mu.Unlock()
-		}
-	}()
-
 	s.Mu.Lock()
 	s.Sessions[userID][hostID] = as
 	s.Mu.Unlock()
@@ -185,6 +127,16 @@ func (s *SSHService) TerminateSession(userID, hostID int) {
 	s.terminateSessionUnsafe(userID, hostID)
 }
 
+// TerminateUserSessions kills all sessions of the user, e.g. when the account is disabled.
+func (s *SSHService) TerminateUserSessions(userID int) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for hostID := range s.Sessions[userID] {
+		s.terminateSessionUnsafe(userID, hostID)
+	}
+	delete(s.Sessions, userID)
+}
+
 // terminateSessionUnsafe does the dirty work without locking the mutex s.Mu.
 func (s *SSHService) terminateSessionUnsafe(userID, hostID int) {
 	userMap, ok := s.Sessions[userID]
@@ -198,28 +150,27 @@ func (s *SSHService) terminateSessionUnsafe(userID, hostID int) {
 	}
 
 	// Closing everything
+	as.Mu.Lock()
+	for _, shell := range as.Shells {
+		s.closeShell(shell)
+	}
+	as.Shells = make(map[string]*models.ShellSession)
+	closeTunnels(as)
+	closeProxies(as)
+	as.Mu.Unlock()
+
 	if as.SFTPClient != nil {
 		as.SFTPClient.Close()
 	}
-	if as.SSHSession != nil {
-		as.SSHSession.Close()
-	}
 	if as.SSHClient != nil {
 		as.SSHClient.Close()
 	}
-	if as.Stdin != nil {
-		as.Stdin.Close()
-	}
-
-	// Notifying clients
-	as.Mu.Lock()
-	for ch := range as.Clients {
-		select {
-		case ch <- []byte("[STOPSESSION]"):
-		default:
-		}
+	// Bastions are closed from the innermost one outwards
+	for i := len(as.JumpClients) - 1; i >= 0; i-- {
+		as.JumpClients[i].Close()
 	}
-	as.Mu.Unlock()
+	// The forwarded keys must not outlive the connection
+	destroyAgent(as)
 
 	delete(userMap, hostID)
 }
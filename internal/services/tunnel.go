@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"ssh_manager/internal/models"
+	"strconv"
+	"time"
+)
+
+// tunnelDialTimeout how long a remote tunnel waits for its target on the manager side.
+const tunnelDialTimeout = 10 * time.Second
+
+var (
+	// ErrTunnelRunning is returned when the tunnel is started twice on the same connection.
+	ErrTunnelRunning = errors.New("tunnel is already running")
+	// ErrTunnelNotRunning is returned when a tunnel that is not running is stopped.
+	ErrTunnelNotRunning = errors.New("tunnel is not running")
+)
+
+// TunnelInfo frontend structure, the definition of the tunnel with its live counters.
+type TunnelInfo struct {
+	models.Tunnel
+	Running          bool       `json:"running"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	Connections      int64      `json:"connections"`
+	TotalConnections int64      `json:"total_connections"`
+	BytesSent        int64      `json:"bytes_sent"`
+	BytesReceived    int64      `json:"bytes_received"`
+}
+
+// StartTunnel starts listening for the tunnel: on the manager for local tunnels,
+// on the host for remote ones. The tunnel lives as long as the host connection.
+func (s *SSHService) StartTunnel(as *models.ActiveSession, t models.Tunnel) (*models.ActiveTunnel, error) {
+	as.Mu.Lock()
+	defer as.Mu.Unlock()
+
+	if _, ok := as.Tunnels[t.ID]; ok {
+		return nil, ErrTunnelRunning
+	}
+
+	bindAddr := net.JoinHostPort(t.BindAddress, strconv.Itoa(t.BindPort))
+	var listener net.Listener
+	var err error
+	if t.Direction == models.TunnelRemote {
+		listener, err = as.SSHClient.Listen("tcp", bindAddr)
+	} else {
+		listener, err = net.Listen("tcp", bindAddr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", bindAddr, err)
+	}
+
+	at := &models.ActiveTunnel{Tunnel: t}
+	at.Listener = listener
+	at.StartedAt = time.Now()
+	at.Conns = make(map[io.Closer]bool)
+	if as.Tunnels == nil {
+		as.Tunnels = make(map[int]*models.ActiveTunnel)
+	}
+	as.Tunnels[t.ID] = at
+	as.LastActivity = time.Now()
+
+	go s.serveTunnel(as, at, listener)
+	return at, nil
+}
+
+// StopTunnel stops a running tunnel and closes its connections, the host connection stays alive.
+func (s *SSHService) StopTunnel(userID, hostID, tunnelID int) error {
+	s.Mu.RLock()
+	as, ok := s.Sessions[userID][hostID]
+	s.Mu.RUnlock()
+	if !ok {
+		return ErrTunnelNotRunning
+	}
+
+	as.Mu.Lock()
+	at, ok := as.Tunnels[tunnelID]
+	delete(as.Tunnels, tunnelID)
+	as.Mu.Unlock()
+	if !ok {
+		return ErrTunnelNotRunning
+	}
+
+	closeForwarder(&at.Forwarder)
+	return nil
+}
+
+// ListTunnels adds the live state of the user's host connection to the tunnel definitions.
+func (s *SSHService) ListTunnels(userID, hostID int, tunnels []models.Tunnel) []TunnelInfo {
+	s.Mu.RLock()
+	as, ok := s.Sessions[userID][hostID]
+	s.Mu.RUnlock()
+
+	running := make(map[int]*models.ActiveTunnel)
+	if ok {
+		as.Mu.Lock()
+		for id, at := range as.Tunnels {
+			running[id] = at
+		}
+		as.Mu.Unlock()
+	}
+
+	result := make([]TunnelInfo, 0, len(tunnels))
+	for _, t := range tunnels {
+		info := TunnelInfo{Tunnel: t}
+		if at, ok := running[t.ID]; ok {
+			startedAt := at.StartedAt
+			info.Running = true
+			info.StartedAt = &startedAt
+			info.Connections = at.Connections.Load()
+			info.TotalConnections = at.Total.Load()
+			info.BytesSent = at.BytesSent.Load()
+			info.BytesReceived = at.BytesRecv.Load()
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// serveTunnel accepts the connections of the tunnel until its listener is closed.
+func (s *SSHService) serveTunnel(as *models.ActiveSession, at *models.ActiveTunnel, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			at.Mu.Lock()
+			stopped := at.Stopped
+			at.Mu.Unlock()
+			if !stopped {
+				// E.g. the host connection was lost, the tunnel must not be shown as running
+				log.Printf("[WARN] Tunnel %d stopped accepting connections: %v", at.Tunnel.ID, err)
+				as.Mu.Lock()
+				if as.Tunnels[at.Tunnel.ID] == at {
+					delete(as.Tunnels, at.Tunnel.ID)
+				}
+				as.Mu.Unlock()
+				closeForwarder(&at.Forwarder)
+			}
+			return
+		}
+		go s.forwardConn(as, at, conn)
+	}
+}
+
+// forwardConn connects an accepted connection with the target of the tunnel.
+func (s *SSHService) forwardConn(as *models.ActiveSession, at *models.ActiveTunnel, conn net.Conn) {
+	defer conn.Close()
+
+	targetAddr := net.JoinHostPort(at.Tunnel.TargetHost, strconv.Itoa(at.Tunnel.TargetPort))
+	var target net.Conn
+	var err error
+	if at.Tunnel.Direction == models.TunnelRemote {
+		target, err = net.DialTimeout("tcp", targetAddr, tunnelDialTimeout)
+	} else {
+		target, err = as.SSHClient.Dial("tcp", targetAddr)
+	}
+	if err != nil {
+		log.Printf("[WARN] Tunnel %d failed to connect to %s: %v", at.Tunnel.ID, targetAddr, err)
+		return
+	}
+	defer target.Close()
+
+	pipeConns(as, &at.Forwarder, conn, target)
+}
+
+// closeTunnels stops all tunnels of the connection, the caller holds as.Mu.
+func closeTunnels(as *models.ActiveSession) {
+	for id, at := range as.Tunnels {
+		closeForwarder(&at.Forwarder)
+		delete(as.Tunnels, id)
+	}
+}
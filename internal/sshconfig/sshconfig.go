@@ -0,0 +1,242 @@
+// Package sshconfig reads and writes the Host blocks of an OpenSSH client config (~/.ssh/config).
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Entry a concrete host of the config with the options that apply to it.
+type Entry struct {
+	Alias         string   `json:"alias"`
+	HostName      string   `json:"host_name"`
+	User          string   `json:"user"`
+	Port          int      `json:"port"`
+	IdentityFiles []string `json:"identity_files"`
+	ProxyJump     string   `json:"proxy_jump"`
+	Line          int      `json:"line"` // Line of the Host block the alias is declared in
+}
+
+// block a Host section with the options in the order they appear.
+type block struct {
+	patterns []string
+	line     int
+	options  [][2]string // [keyword in lower case, value]
+}
+
+// Parse reads the config and returns an entry for every alias without wildcards. Like ssh, the first value
+// of an option wins, so "Host *" defaults at the end of the file fill in what the host block does not set.
+// Match blocks and Include are skipped and reported in the warnings.
+func Parse(r io.Reader) ([]Entry, []string, error) {
+	var blocks []*block
+	var warnings []string
+	global := &block{patterns: []string{"*"}}
+	current := global
+	skipping := false
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		keyword, value := splitLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			current = &block{patterns: splitValues(value), line: lineNo}
+			blocks = append(blocks, current)
+			skipping = false
+			continue
+		case "match":
+			warnings = append(warnings, fmt.Sprintf("line %d: Match blocks are not supported and were skipped", lineNo))
+			skipping = true
+			continue
+		case "include":
+			warnings = append(warnings, fmt.Sprintf("line %d: Include is not supported, import the included file separately", lineNo))
+			continue
+		}
+		if !skipping {
+			current.options = append(current.options, [2]string{keyword, value})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// Options before the first Host apply to every host
+	blocks = append([]*block{global}, blocks...)
+
+	var entries []Entry
+	seen := make(map[string]bool)
+	for _, b := range blocks {
+		for _, alias := range b.patterns {
+			if seen[alias] || strings.ContainsAny(alias, "*?!") {
+				continue
+			}
+			seen[alias] = true
+			entry, err := resolve(alias, b.line, blocks)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("host %s: %v", alias, err))
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, warnings, nil
+}
+
+// resolve collects the options of all blocks matching the alias.
+func resolve(alias string, line int, blocks []*block) (Entry, error) {
+	entry := Entry{Alias: alias, Line: line}
+	var portErr error
+	for _, b := range blocks {
+		if !matches(alias, b.patterns) {
+			continue
+		}
+		for _, opt := range b.options {
+			value := opt[1]
+			switch opt[0] {
+			case "hostname":
+				if entry.HostName == "" {
+					entry.HostName = strings.ReplaceAll(value, "%h", alias)
+				}
+			case "user":
+				if entry.User == "" {
+					entry.User = value
+				}
+			case "port":
+				if entry.Port == 0 {
+					port, err := strconv.Atoi(value)
+					if err != nil || port < 1 || port > 65535 {
+						portErr = fmt.Errorf("invalid port %q", value)
+						continue
+					}
+					entry.Port = port
+				}
+			case "identityfile":
+				// Unlike the other options, every IdentityFile is used
+				entry.IdentityFiles = append(entry.IdentityFiles, value)
+			case "proxyjump":
+				if entry.ProxyJump == "" {
+					entry.ProxyJump = value
+				}
+			}
+		}
+	}
+
+	if entry.HostName == "" {
+		entry.HostName = alias
+	}
+	if entry.Port == 0 {
+		entry.Port = 22
+	}
+	if strings.EqualFold(entry.ProxyJump, "none") {
+		entry.ProxyJump = ""
+	}
+	return entry, portErr
+}
+
+// matches reports whether the alias matches the patterns of a Host line, a negated pattern excludes the alias.
+func matches(alias string, patterns []string) bool {
+	matched := false
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		if ok, _ := path.Match(strings.TrimPrefix(p, "!"), alias); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// splitLine splits "Keyword value" or "Keyword=value" and drops comments. The keyword is in lower case.
+func splitLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+	keyword := strings.ToLower(line[:i])
+	value := strings.TrimLeft(line[i:], " \t")
+	value = strings.TrimPrefix(value, "=")
+	value = strings.TrimSpace(value)
+	return keyword, unquote(value)
+}
+
+// splitValues splits a list of values separated by whitespace, double quotes keep a value with spaces together.
+func splitValues(value string) []string {
+	var values []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case (r == ' ' || r == '\t') && !quoted:
+			if current.Len() > 0 {
+				values = append(values, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		values = append(values, current.String())
+	}
+	return values
+}
+
+// unquote removes the double quotes around a single value.
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' && !strings.Contains(value[1:len(value)-1], `"`) {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Write writes the entries as Host blocks, the options that are empty or default are left out.
+func Write(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		fmt.Fprintf(bw, "Host %s\n", quote(e.Alias))
+		if e.HostName != "" && e.HostName != e.Alias {
+			fmt.Fprintf(bw, "    HostName %s\n", quote(e.HostName))
+		}
+		if e.User != "" {
+			fmt.Fprintf(bw, "    User %s\n", quote(e.User))
+		}
+		if e.Port != 0 && e.Port != 22 {
+			fmt.Fprintf(bw, "    Port %d\n", e.Port)
+		}
+		for _, file := range e.IdentityFiles {
+			fmt.Fprintf(bw, "    IdentityFile %s\n", quote(file))
+		}
+		if e.ProxyJump != "" {
+			fmt.Fprintf(bw, "    ProxyJump %s\n", quote(e.ProxyJump))
+		}
+	}
+	return bw.Flush()
+}
+
+// quote puts a value with whitespace in double quotes.
+func quote(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
@@ -0,0 +1,146 @@
+package sshconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		want         []Entry
+		wantWarnings int
+	}{
+		{
+			name:   "defaults",
+			config: "Host web\n",
+			want:   []Entry{{Alias: "web", HostName: "web", Port: 22, Line: 1}},
+		},
+		{
+			name: "options and comments",
+			config: `# comment
+Host web
+    HostName 10.0.0.1
+    User deploy
+    Port=2222
+    IdentityFile ~/.ssh/id_ed25519
+    IdentityFile "~/.ssh/with space"
+    ProxyJump bastion
+`,
+			want: []Entry{{Alias: "web", HostName: "10.0.0.1", User: "deploy", Port: 2222,
+				IdentityFiles: []string{"~/.ssh/id_ed25519", "~/.ssh/with space"}, ProxyJump: "bastion", Line: 2}},
+		},
+		{
+			name: "first value wins over the defaults at the end",
+			config: `Host web
+    User deploy
+Host *
+    User root
+    Port 2200
+`,
+			want: []Entry{{Alias: "web", HostName: "web", User: "deploy", Port: 2200, Line: 1}},
+		},
+		{
+			name: "options before the first host apply to all",
+			config: `User admin
+Host a b
+    HostName %h.example.com
+`,
+			want: []Entry{
+				{Alias: "a", HostName: "a.example.com", User: "admin", Port: 22, Line: 2},
+				{Alias: "b", HostName: "b.example.com", User: "admin", Port: 22, Line: 2},
+			},
+		},
+		{
+			name: "wildcards and negation",
+			config: `Host web db
+Host * !db
+    User deploy
+Host w?b
+    Port 2222
+`,
+			want: []Entry{
+				{Alias: "web", HostName: "web", User: "deploy", Port: 2222, Line: 1},
+				{Alias: "db", HostName: "db", Port: 22, Line: 1},
+			},
+		},
+		{
+			name: "proxy jump none",
+			config: `Host web
+    ProxyJump none
+Host *
+    ProxyJump bastion
+`,
+			want: []Entry{{Alias: "web", HostName: "web", Port: 22, Line: 1}},
+		},
+		{
+			name: "invalid port",
+			config: `Host web
+    Port 70000
+`,
+			want:         []Entry{{Alias: "web", HostName: "web", Port: 22, Line: 1}},
+			wantWarnings: 1,
+		},
+		{
+			name: "match and include are skipped",
+			config: `Include ~/.ssh/config.d/*
+Host web
+Match host web
+    User ignored
+`,
+			want:         []Entry{{Alias: "web", HostName: "web", Port: 22, Line: 2}},
+			wantWarnings: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, warnings, err := Parse(strings.NewReader(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, tt.want) {
+				t.Errorf("entries = %+v, want %+v", entries, tt.want)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestWriteParse(t *testing.T) {
+	entries := []Entry{
+		{Alias: "bastion", HostName: "203.0.113.5", User: "jump", Port: 22},
+		{Alias: "web", HostName: "10.0.0.1", User: "deploy", Port: 2222,
+			IdentityFiles: []string{"~/.ssh/my key"}, ProxyJump: "bastion"},
+	}
+	var b strings.Builder
+	if err := Write(&b, entries); err != nil {
+		t.Fatal(err)
+	}
+	want := `Host bastion
+    HostName 203.0.113.5
+    User jump
+
+Host web
+    HostName 10.0.0.1
+    User deploy
+    Port 2222
+    IdentityFile "~/.ssh/my key"
+    ProxyJump bastion
+`
+	if b.String() != want {
+		t.Errorf("Write =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	parsed, _, err := Parse(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries[0].Line, entries[1].Line = 1, 5
+	if !reflect.DeepEqual(parsed, entries) {
+		t.Errorf("Parse(Write) = %+v, want %+v", parsed, entries)
+	}
+}
@@ -0,0 +1,138 @@
+// Package sshkeys generates SSH key pairs and derives the public half of stored private keys.
+package sshkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Key types that can be generated.
+const (
+	TypeEd25519 = "ed25519"
+	TypeECDSA   = "ecdsa"
+	TypeRSA     = "rsa"
+)
+
+// Errors of parsing a passphrase protected key.
+var (
+	ErrPassphraseRequired = errors.New("the private key is protected by a passphrase")
+	ErrWrongPassphrase    = errors.New("wrong passphrase for the private key")
+)
+
+// rsaBits the size of generated RSA keys.
+const rsaBits = 4096
+
+// Info the public half of a key.
+type Info struct {
+	PublicKey   string // authorized_keys line, with the comment if there is one
+	Fingerprint string // SHA256:...
+	Type        string // e.g. ssh-ed25519
+}
+
+// Generate creates a key pair of the type and returns the private key in the OpenSSH format.
+// ECDSA keys use bits as the curve size (256, 384 or 521, 256 if zero), the other types ignore it.
+func Generate(keyType string, bits int, comment string) (string, Info, error) {
+	var key crypto.PrivateKey
+	var err error
+	switch keyType {
+	case TypeEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case TypeECDSA:
+		var curve elliptic.Curve
+		switch bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return "", Info{}, fmt.Errorf("unsupported ECDSA size %d", bits)
+		}
+		key, err = ecdsa.GenerateKey(curve, rand.Reader)
+	case TypeRSA:
+		key, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	default:
+		return "", Info{}, fmt.Errorf("unsupported key type %q", keyType)
+	}
+	if err != nil {
+		return "", Info{}, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return "", Info{}, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return "", Info{}, err
+	}
+	return string(pem.EncodeToMemory(block)), describe(signer.PublicKey(), comment), nil
+}
+
+// Parse parses a private key, the passphrase is only used if the key is protected.
+func Parse(privateKey, passphrase string) (interface{}, error) {
+	raw, err := ssh.ParseRawPrivateKey([]byte(privateKey))
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return raw, err
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+
+	raw, err = ssh.ParseRawPrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, ErrWrongPassphrase
+	}
+	return raw, err
+}
+
+// IsProtected reports whether the private key needs a passphrase.
+func IsProtected(privateKey string) bool {
+	_, err := ssh.ParseRawPrivateKey([]byte(privateKey))
+	var missing *ssh.PassphraseMissingError
+	return errors.As(err, &missing)
+}
+
+// Inspect derives the public half of a private key. The OpenSSH format keeps the public key
+// unencrypted, so a protected key of that format is described even without the passphrase.
+func Inspect(privateKey, passphrase string) (Info, error) {
+	raw, err := Parse(privateKey, passphrase)
+	if errors.Is(err, ErrPassphraseRequired) {
+		_, err := ssh.ParseRawPrivateKey([]byte(privateKey))
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && missing.PublicKey != nil {
+			return describe(missing.PublicKey, ""), nil
+		}
+		return Info{}, ErrPassphraseRequired
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	signer, err := ssh.NewSignerFromKey(raw)
+	if err != nil {
+		return Info{}, err
+	}
+	return describe(signer.PublicKey(), ""), nil
+}
+
+// describe builds the Info of a public key.
+func describe(pub ssh.PublicKey, comment string) Info {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		line += " " + comment
+	}
+	return Info{PublicKey: line, Fingerprint: ssh.FingerprintSHA256(pub), Type: pub.Type()}
+}
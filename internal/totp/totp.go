@@ -0,0 +1,116 @@
+// Package totp implements time-based one-time passwords (RFC 6238) as used by authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters of the codes, the defaults of every authenticator app.
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	Skew   = 1 // Periods before and after the current one that are accepted, for clocks that are a bit off
+)
+
+// ErrInvalidSecret is returned for a seed that is not base32 or an otpauth:// URI.
+var ErrInvalidSecret = errors.New("invalid TOTP secret, expected base32 or an otpauth:// URI")
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NormalizeSecret accepts a base32 seed (spaces, dashes and padding are ignored, case too)
+// or an otpauth://totp/ URI and returns the canonical base32 seed.
+func NormalizeSecret(secret string) (string, error) {
+	secret = strings.TrimSpace(secret)
+	if strings.HasPrefix(strings.ToLower(secret), "otpauth://") {
+		u, err := url.Parse(secret)
+		if err != nil || u.Host != "totp" {
+			return "", ErrInvalidSecret
+		}
+		q := u.Query()
+		if (q.Get("digits") != "" && q.Get("digits") != fmt.Sprint(Digits)) ||
+			(q.Get("period") != "" && q.Get("period") != fmt.Sprint(int(Period.Seconds()))) ||
+			(q.Get("algorithm") != "" && !strings.EqualFold(q.Get("algorithm"), "SHA1")) {
+			return "", fmt.Errorf("%w: only 6 digit SHA1 codes with a 30s period are supported", ErrInvalidSecret)
+		}
+		secret = q.Get("secret")
+	}
+
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	if secret == "" {
+		return "", ErrInvalidSecret
+	}
+	if _, err := encoding.DecodeString(secret); err != nil {
+		return "", ErrInvalidSecret
+	}
+	return secret, nil
+}
+
+// NewSecret generates a random seed for enrollment.
+func NewSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(key), nil
+}
+
+// URI returns the otpauth:// URI authenticator apps import the seed from.
+func URI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + issuer + ":" + account, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// Validate checks the code against the periods around t. It returns the counter of the matching period,
+// codes of periods up to lastCounter are refused so that a code cannot be used twice.
+func Validate(secret, code string, t time.Time, lastCounter int64) (int64, bool) {
+	key, err := encoding.DecodeString(secret)
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	current := t.Unix() / int64(Period.Seconds())
+	for counter := current - Skew; counter <= current+Skew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		if hmac.Equal([]byte(hotp(key, uint64(counter))), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// Code returns the code of the seed for the moment t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+	return hotp(key, uint64(t.Unix()/int64(Period.Seconds()))), nil
+}
+
+// hotp computes the HOTP value (RFC 4226) for the counter.
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
@@ -0,0 +1,119 @@
+package totp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// rfcSecret the SHA1 seed of the RFC 6238 test vectors, "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, the last 6 of the 8 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / int64(Period.Seconds())
+	code := func(offset time.Duration) string {
+		c, err := Code(rfcSecret, now.Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name        string
+		secret      string
+		code        string
+		lastCounter int64
+		wantCounter int64
+		wantOK      bool
+	}{
+		{"current period", rfcSecret, code(0), 0, current, true},
+		{"with spaces", rfcSecret, " 050 471 ", 0, current, true},
+		{"previous period", rfcSecret, code(-Period), 0, current - 1, true},
+		{"next period", rfcSecret, code(Period), 0, current + 1, true},
+		{"outside the skew", rfcSecret, code(-2 * Period), 0, 0, false},
+		{"already used", rfcSecret, code(0), current, 0, false},
+		{"later period used", rfcSecret, code(-Period), current, 0, false},
+		{"wrong code", rfcSecret, "000000", 0, 0, false},
+		{"too short", rfcSecret, "05047", 0, 0, false},
+		{"invalid secret", "not base32!", code(0), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := Validate(tt.secret, tt.code, now, tt.lastCounter)
+			if ok != tt.wantOK || counter != tt.wantCounter {
+				t.Errorf("Validate = %d, %v, want %d, %v", counter, ok, tt.wantCounter, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNormalizeSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		want    string
+		wantErr bool
+	}{
+		{"base32", rfcSecret, rfcSecret, false},
+		{"lower case with spaces", "gezd gnbv gy3t qojq gezd gnbv gy3t qojq", rfcSecret, false},
+		{"dashes and padding", "GEZD-GNBV-GY3T-QOJQ-GEZD-GNBV-GY3T-QOJQ==", rfcSecret, false},
+		{"uri", "otpauth://totp/SSH%20Manager:alice?secret=" + rfcSecret + "&issuer=SSH%20Manager", rfcSecret, false},
+		{"uri with defaults", "otpauth://totp/x?secret=" + rfcSecret + "&digits=6&period=30&algorithm=sha1", rfcSecret, false},
+		{"uri with 8 digits", "otpauth://totp/x?secret=" + rfcSecret + "&digits=8", "", true},
+		{"uri with SHA256", "otpauth://totp/x?secret=" + rfcSecret + "&algorithm=SHA256", "", true},
+		{"hotp uri", "otpauth://hotp/x?secret=" + rfcSecret, "", true},
+		{"empty", "  ", "", true},
+		{"not base32", "GEZDGNBV1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeSecret(tt.secret)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSecret) {
+					t.Errorf("NormalizeSecret(%q) = %q, %v, want ErrInvalidSecret", tt.secret, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizeSecret(%q) = %q, %v, want %q", tt.secret, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NormalizeSecret(URI("SSH Manager", "alice", secret))
+	if err != nil || got != secret {
+		t.Errorf("NormalizeSecret(URI(...)) = %q, %v, want %q", got, err, secret)
+	}
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the address of the client. Behind a trusted reverse proxy it is the last address
+// of X-Forwarded-For, the one the proxy added; the ones before it come from the client and can be forged.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(addresses[len(addresses)-1]); net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
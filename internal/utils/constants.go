@@ -8,4 +8,29 @@ const (
 	IsAuthenticated = "authenticated"
 	UsernameKey     = "username"
 	UserIDKey       = "user_id"
+	// Session version of the user at the login, see models.User.SessionVersion
+	SessionVersionKey = "session_version"
+
+	// Between the password and the second factor of a login
+	PendingUserIDKey   = "pending_user_id"
+	PendingSinceKey    = "pending_since"
+	PendingAttemptsKey = "pending_attempts"
+
+	// Encrypted TOTP seed shown to the user until the first code confirms it
+	TOTPEnrollKey = "totp_enroll_secret"
+
+	// Challenge of a passkey registration or login until the browser answers it
+	WebAuthnSessionKey = "webauthn_session"
+	WebAuthnNameKey    = "webauthn_name"
+
+	// State, nonce and PKCE verifier of a single sign-on until the identity provider redirects back
+	OIDCStateKey = "oidc_state"
+	// Flash message shown on the login page
+	LoginErrorKey = "login_error"
 )
+
+// ContextKey type of the keys stored in the request context.
+type ContextKey string
+
+// CurrentUserKey the authorized *models.User in the request context.
+const CurrentUserKey ContextKey = "current_user"
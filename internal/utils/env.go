@@ -3,6 +3,7 @@ package utils
 import (
 	"log"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -27,3 +28,31 @@ func GetDurationEnv(key, fallback string) time.Duration {
 	}
 	return d
 }
+
+// GetBoolEnv parses a boolean from ENV or returns default.
+func GetBoolEnv(key string, fallback bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("Invalid boolean for %s, using fallback %t", key, fallback)
+		return fallback
+	}
+	return b
+}
+
+// GetIntEnv parses an integer from ENV or returns default.
+func GetIntEnv(key string, fallback int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("Invalid integer for %s, using fallback %d", key, fallback)
+		return fallback
+	}
+	return n
+}
@@ -10,7 +10,7 @@ var templates map[string]*template.Template
 // InitTemplates for a one-time call in the main file and caching of templates.
 func InitTemplates() {
 	templates = make(map[string]*template.Template)
-	pages := []string{"home.html", "keys.html", "login.html", "profile.html", "4xx.html", "5xx.html"}
+	pages := []string{"home.html", "keys.html", "login.html", "profile.html", "recordings.html", "users.html", "groups.html", "jobs.html", "snippets.html", "4xx.html", "5xx.html"}
 
 	for _, page := range pages {
 		// Parse once at startup
@@ -35,6 +35,9 @@ func RenderTemplate(w http.ResponseWriter, page string, data map[string]interfac
 		data = make(map[string]interface{})
 	}
 	data["CSRFToken"] = csrfToken
+	if user := r.Context().Value(CurrentUserKey); user != nil {
+		data["CurrentUser"] = user
+	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	err := tmpl.ExecuteTemplate(w, "base", data)
@@ -64,7 +64,207 @@ if (loginForm) {
                 password: document.getElementById('password').value,
                 csrf_token: document.getElementById('csrf_token').value
             })
-        }).then(r => r.json()).then(data => data.success ? window.location.href = '/' : showErrorModal(data.message));
+        }).then(r => r.json()).then(data => {
+            if (!data.success) {
+                showErrorModal(data.message);
+                return;
+            }
+            // With 2FA the password is followed by a code or a passkey
+            if (data.data && data.data.two_factor) {
+                const methods = data.data.methods || [];
+                loginForm.style.display = 'none';
+                document.getElementById('twoFactorForm').style.display = 'block';
+                document.getElementById('twoFactorCodeFields').style.display = methods.includes('totp') ? 'block' : 'none';
+                document.getElementById('twoFactorPasskeyButton').style.display = methods.includes('passkey') ? 'block' : 'none';
+                if (methods.includes('totp')) document.getElementById('twoFactorCode').focus();
+                return;
+            }
+            window.location.href = '/';
+        });
+    });
+
+    document.getElementById('twoFactorForm').addEventListener('submit', function(e) {
+        e.preventDefault();
+        fetch('/login/2fa', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                code: document.getElementById('twoFactorCode').value,
+                csrf_token: document.getElementById('csrf_token').value
+            })
+        }).then(r => r.json()).then(data => {
+            if (data.success) {
+                window.location.href = '/';
+                return;
+            }
+            document.getElementById('twoFactorCode').value = '';
+            showTwoFactorError(data.message);
+        });
+    });
+
+    document.getElementById('twoFactorPasskeyButton').addEventListener('click', () => {
+        passkeyCeremony('/login/2fa/passkey/begin', '/login/2fa/passkey/finish', 'get')
+            .then(data => data.success ? window.location.href = '/' : showTwoFactorError(data.message));
+    });
+
+    const passkeyLoginButton = document.getElementById('passkeyLoginButton');
+    if (passkeyLoginButton) {
+        passkeyLoginButton.addEventListener('click', () => {
+            passkeyCeremony('/login/passkey/begin', '/login/passkey/finish', 'get')
+                .then(data => data.success ? window.location.href = '/' : showErrorModal(data.message));
+        });
+    }
+
+    function showTwoFactorError(message) {
+        showErrorModal(message);
+        // Too many wrong codes, the password has to be entered again
+        if (message.includes('password')) {
+            document.getElementById('twoFactorForm').style.display = 'none';
+            loginForm.style.display = 'block';
+        }
+    }
+}
+
+/* --- PASSKEYS --- */
+function base64urlToBuffer(value) {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    return Uint8Array.from(atob(base64), c => c.charCodeAt(0)).buffer;
+}
+
+function bufferToBase64url(buffer) {
+    const bytes = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(bytes).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+// passkeyCeremony asks the server for a challenge, lets the browser answer it
+// with navigator.credentials.create or .get and sends the answer back.
+function passkeyCeremony(beginURL, finishURL, kind, data = {}) {
+    if (!window.PublicKeyCredential) {
+        return Promise.resolve({ success: false, message: 'This browser does not support passkeys' });
+    }
+    const post = (url, body) => {
+        const token = document.getElementById('csrf_token');
+        if (token) body.csrf_token = token.value;
+        return fetch(url, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        }).then(r => r.json());
+    };
+
+    return post(beginURL, data).then(res => {
+        if (!res.success) return res;
+        const options = res.data.publicKey;
+        options.challenge = base64urlToBuffer(options.challenge);
+        if (options.user) options.user.id = base64urlToBuffer(options.user.id);
+        (options.excludeCredentials || []).forEach(c => c.id = base64urlToBuffer(c.id));
+        (options.allowCredentials || []).forEach(c => c.id = base64urlToBuffer(c.id));
+
+        const request = kind === 'create'
+            ? navigator.credentials.create({ publicKey: options })
+            : navigator.credentials.get({ publicKey: options });
+        return request.then(credential => {
+            const response = {
+                clientDataJSON: bufferToBase64url(credential.response.clientDataJSON)
+            };
+            if (kind === 'create') {
+                response.attestationObject = bufferToBase64url(credential.response.attestationObject);
+                if (credential.response.getTransports) response.transports = credential.response.getTransports();
+            } else {
+                response.authenticatorData = bufferToBase64url(credential.response.authenticatorData);
+                response.signature = bufferToBase64url(credential.response.signature);
+                if (credential.response.userHandle) response.userHandle = bufferToBase64url(credential.response.userHandle);
+            }
+            return post(finishURL, {
+                id: credential.id,
+                rawId: bufferToBase64url(credential.rawId),
+                type: credential.type,
+                response: response
+            });
+        }, err => ({ success: false, message: 'The passkey was not confirmed: ' + err.message }));
+    });
+}
+
+const passkeyForm = document.getElementById('passkeyForm');
+if (passkeyForm) {
+    formatLocalTimes(document.getElementById('passkeysTable'));
+
+    passkeyForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        passkeyCeremony('/profile/passkeys/begin', '/profile/passkeys/finish', 'create', {
+            name: document.getElementById('passkeyName').value
+        }).then(res => res.success ? location.reload() : showErrorModal(res.message));
+    });
+}
+
+window.revokePasskey = function(id, name) {
+    if (!confirm(`Revoke the passkey "${name}"? It can no longer be used to log in.`)) return;
+    postAdminAction(`/profile/passkeys/delete/${id}`, {})
+        .then(res => res.success ? location.reload() : showErrorModal(res.message));
+};
+
+/* --- TWO-FACTOR AUTHENTICATION --- */
+let twoFactorPasswordAction = null;
+
+window.setupTwoFactor = function() {
+    postAdminAction('/profile/2fa/setup', {}).then(res => {
+        if (!res.success) {
+            showErrorModal(res.message);
+            return;
+        }
+        document.getElementById('twoFactorURI').value = res.data.uri;
+        document.getElementById('twoFactorSecret').value = res.data.secret;
+        document.getElementById('twoFactorEnableCode').value = '';
+        document.getElementById('twoFactorSetupModal').style.display = 'block';
+    });
+};
+
+window.openTwoFactorPasswordModal = function(action) {
+    twoFactorPasswordAction = action;
+    document.getElementById('twoFactorPasswordTitle').innerText =
+        action === 'disable' ? 'Disable Two-Factor Authentication' : 'New Recovery Codes';
+    document.getElementById('twoFactorPassword').value = '';
+    document.getElementById('twoFactorPasswordModal').style.display = 'block';
+};
+
+function showRecoveryCodes(codes) {
+    document.getElementById('recoveryCodesList').innerText = codes.join('\n');
+    document.getElementById('recoveryCodesModal').style.display = 'block';
+}
+
+const twoFactorEnableForm = document.getElementById('twoFactorEnableForm');
+if (twoFactorEnableForm) {
+    twoFactorEnableForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        postAdminAction('/profile/2fa/enable', {
+            code: document.getElementById('twoFactorEnableCode').value
+        }).then(res => {
+            if (!res.success) {
+                showErrorModal(res.message);
+                return;
+            }
+            closeModal('twoFactorSetupModal');
+            showRecoveryCodes(res.data.recovery_codes);
+        });
+    });
+
+    document.getElementById('twoFactorPasswordForm').addEventListener('submit', (e) => {
+        e.preventDefault();
+        const url = twoFactorPasswordAction === 'disable' ? '/profile/2fa/disable' : '/profile/2fa/recovery-codes';
+        postAdminAction(url, {
+            password: document.getElementById('twoFactorPassword').value
+        }).then(res => {
+            if (!res.success) {
+                showErrorModal(res.message);
+                return;
+            }
+            closeModal('twoFactorPasswordModal');
+            if (res.data && res.data.recovery_codes) {
+                showRecoveryCodes(res.data.recovery_codes);
+            } else {
+                location.reload();
+            }
+        });
     });
 }
 
@@ -110,7 +310,13 @@ window.openAddModal = async function() {
         hForm.action = '/hosts/add';
         hForm.reset();
         document.getElementById('port').value = 22;
+        document.getElementById('jumpHostID').value = '0';
+        document.getElementById('groupID').value = '0';
         document.getElementById('authType').value = 'key';
+        document.getElementById('hostTOTPSecret').placeholder = 'base32 or otpauth:// URI, optional';
+        document.getElementById('clearTOTPField').style.display = 'none';
+        toggleAgentKeys();
+        document.getElementById('hostKeysField').style.display = 'none';
         toggleAuthFields();
         document.getElementById('hostModal').style.display = 'block';
     } else if (kForm) {
@@ -118,6 +324,7 @@ window.openAddModal = async function() {
         if (document.getElementById('partialKeyHint')) document.getElementById('partialKeyHint').style.display = 'none';
         kForm.action = '/keys/add';
         kForm.reset();
+        document.getElementById('keyPassphrase').placeholder = '';
         document.getElementById('keyModal').style.display = 'block';
     }
 };
@@ -136,19 +343,38 @@ window.openEditModal = async function(id) {
                 document.getElementById('address').value = res.data.address;
                 const settings = res.data.settings || {};
                 document.getElementById('defaultPath').value = settings.default_path || "/";
+                document.getElementById('recordSessions').checked = !!settings.record_sessions;
+                document.getElementById('agentForwarding').checked = !!settings.agent_forwarding;
+                const agentKeys = (settings.agent_key_ids || []).map(String);
+                Array.from(document.getElementById('agentKeyIDs').options).forEach(o => {
+                    o.selected = agentKeys.includes(o.value);
+                });
+                toggleAgentKeys();
                 document.getElementById('port').value = res.data.port;
                 document.getElementById('username').value = res.data.username;
+                document.getElementById('jumpHostID').value = res.data.jump_host_id || 0;
+                document.getElementById('groupID').value = res.data.group_id || 0;
+                document.getElementById('folder').value = res.data.folder || '';
+                document.getElementById('tags').value = (res.data.tags || []).join(', ');
                 const aType = res.data.auth_type || 'key';
                 document.getElementById('authType').value = aType;
 
+                // The stored TOTP secret is never sent back, only whether there is one
+                const totpInput = document.getElementById('hostTOTPSecret');
+                totpInput.value = '';
+                totpInput.placeholder = res.data.has_totp ? '******** (leave empty to keep current)' : 'base32 or otpauth:// URI, optional';
+                document.getElementById('clearTOTP').checked = false;
+                document.getElementById('clearTOTPField').style.display = res.data.has_totp ? 'block' : 'none';
+
                 if (aType === 'password') {
                     const passInput = document.getElementById('hostPassword');
                     passInput.value = ''; 
                     passInput.placeholder = '******** (leave empty to keep current)';
-                } else {
+                } else if (aType === 'key') {
                     document.getElementById('keyID').value = res.data.key_id || 0;
                 }
 
+                renderHostKeys(id, res.data.host_keys || []);
                 toggleAuthFields();
                 document.getElementById('hostModal').style.display = 'block';
             }
@@ -160,12 +386,60 @@ window.openEditModal = async function(id) {
             kForm.action = `/keys/edit/${id}`;
             document.getElementById('keyName').value = key.name || "";
             document.getElementById('privateKey').value = key.key_data || "";
+            document.getElementById('keyGroupID').value = key.group_id || 0;
+            document.getElementById('keyPassphrase').value = '';
+            document.getElementById('keyPassphraseMode').value = key.passphrase_mode || 'stored';
+            document.getElementById('keyPassphrase').placeholder = key.passphrase_mode === 'stored' ? '******** (leave empty to keep current)' : '';
             if (document.getElementById('partialKeyHint')) document.getElementById('partialKeyHint').style.display = 'block';
             document.getElementById('keyModal').style.display = 'block';
         });
     }
 };
 
+window.openGenerateModal = function() {
+    document.getElementById('genName').value = '';
+    document.getElementById('genComment').value = '';
+    document.getElementById('genType').value = 'ed25519';
+    document.getElementById('genGroupID').value = '0';
+    document.getElementById('generateForm').style.display = 'block';
+    document.getElementById('generateResult').style.display = 'none';
+    document.getElementById('generateModal').style.display = 'block';
+};
+
+window.generateKey = function() {
+    const name = document.getElementById('genName').value.trim();
+    if (!name) {
+        showErrorModal('Name cannot be empty');
+        return;
+    }
+    const [type, bits] = document.getElementById('genType').value.split(':');
+    postAdminAction('/keys/generate', {
+        name: name,
+        type: type,
+        bits: bits || '0',
+        comment: document.getElementById('genComment').value.trim(),
+        group_id: document.getElementById('genGroupID').value
+    }).then(res => {
+        if (!res.success) {
+            showErrorModal(res.message);
+            return;
+        }
+        document.getElementById('genPublicKey').value = res.data.public_key;
+        document.getElementById('genFingerprint').textContent = `${res.data.key_type} ${res.data.fingerprint}`;
+        document.getElementById('generateForm').style.display = 'none';
+        document.getElementById('generateResult').style.display = 'block';
+    });
+};
+
+// copyPublicKey copies the public key of a button's data attribute or of a text field.
+window.copyPublicKey = function(el) {
+    const text = el.dataset.publicKey || el.value;
+    navigator.clipboard.writeText(text).then(
+        () => alert('Public key copied'),
+        () => prompt('Copy the public key:', text)
+    );
+};
+
 window.openDeleteModal = function(arg1, arg2) {
     const isHost = !!document.getElementById('deleteHostName');
     globalDelId = isHost ? arg1 : arg2;
@@ -193,6 +467,11 @@ window.confirmDelete = function() {
     }).then(r => r.json()).then(data => data.success ? location.reload() : showErrorModal(data.message));
 };
 
+window.toggleAgentKeys = function() {
+    const enabled = document.getElementById('agentForwarding').checked;
+    document.getElementById('agentKeysField').style.display = enabled ? 'block' : 'none';
+};
+
 window.toggleAuthFields = function() {
     const type = document.getElementById('authType').value;
     const keyField = document.getElementById('keyField');
@@ -202,6 +481,12 @@ window.toggleAuthFields = function() {
         keyField.style.display = 'block';
         passField.style.display = 'none';
         document.getElementById('hostPassword').value = '';
+    } else if (type === 'interactive') {
+        // Every answer comes from the user or the TOTP secret when connecting
+        keyField.style.display = 'none';
+        passField.style.display = 'none';
+        document.getElementById('hostPassword').value = '';
+        document.getElementById('keyID').value = '0';
     } else {
         keyField.style.display = 'none';
         passField.style.display = 'block';
@@ -209,6 +494,293 @@ window.toggleAuthFields = function() {
     }
 };
 
+/* --- HOST FOLDERS AND SEARCH --- */
+// toggleFolder collapses or expands a folder with all its subfolders
+window.toggleFolder = function(row) {
+    const path = row.dataset.folder;
+    const collapsed = row.classList.toggle('collapsed');
+    document.querySelectorAll('#hostsBody tr[data-folder]').forEach(tr => {
+        if (tr === row) return;
+        const folder = tr.dataset.folder;
+        if (folder === path || folder.startsWith(path + '/')) {
+            tr.style.display = collapsed ? 'none' : '';
+            tr.classList.remove('collapsed');
+        }
+    });
+};
+
+const hostsBody = document.getElementById('hostsBody');
+if (hostsBody) {
+    let searchTimer = null;
+    const runSearch = () => {
+        clearTimeout(searchTimer);
+        searchTimer = setTimeout(filterHosts, 300);
+    };
+    document.getElementById('hostSearch').addEventListener('input', runSearch);
+    document.getElementById('hostTagFilter').addEventListener('change', filterHosts);
+    document.getElementById('hostActiveFilter').addEventListener('change', filterHosts);
+}
+
+// filterHosts shows only the hosts found by /hosts/search together with their folders
+async function filterHosts() {
+    const q = document.getElementById('hostSearch').value.trim();
+    const tag = document.getElementById('hostTagFilter').value;
+    const active = document.getElementById('hostActiveFilter').checked;
+    const rows = document.querySelectorAll('#hostsBody tr[data-folder]');
+
+    if (!q && !tag && !active) {
+        rows.forEach(tr => {
+            tr.style.display = '';
+            tr.classList.remove('collapsed');
+        });
+        return;
+    }
+
+    const found = new Set();
+    for (let page = 1; ; page++) {
+        const params = new URLSearchParams({ q: q, tag: tag, page: page, per_page: 500 });
+        if (active) params.set('active', 'true');
+        const res = await fetch(`/hosts/search?${params}`).then(r => r.json());
+        if (!res.success) {
+            showErrorModal(res.message);
+            return;
+        }
+        res.data.hosts.forEach(h => found.add(String(h.id)));
+        if (page * res.data.per_page >= res.data.total) break;
+    }
+
+    // Folders stay visible when something inside them was found
+    const visibleFolders = new Set();
+    rows.forEach(tr => {
+        if (tr.classList.contains('host-row') && found.has(tr.dataset.hostId)) {
+            const parts = tr.dataset.folder.split('/');
+            for (let i = 1; i <= parts.length; i++) visibleFolders.add(parts.slice(0, i).join('/'));
+        }
+    });
+    rows.forEach(tr => {
+        tr.classList.remove('collapsed');
+        const visible = tr.classList.contains('host-row') ? found.has(tr.dataset.hostId) : visibleFolders.has(tr.dataset.folder);
+        tr.style.display = visible ? '' : 'none';
+    });
+}
+
+/* --- KEY INSTALLATION (ssh-copy-id) --- */
+let installKeyHostId = null;
+
+window.openInstallKeyModal = async function(hostID, name) {
+    installKeyHostId = hostID;
+    document.getElementById('installKeyHostName').innerText = name;
+    const select = document.getElementById('installKeyID');
+    select.innerHTML = '';
+    const res = await fetch('/keys/list').then(r => r.json());
+    (res.data || []).filter(k => k.public_key).forEach(k => {
+        const option = document.createElement('option');
+        option.value = k.id;
+        option.textContent = `${k.name} (${k.key_type})`;
+        select.appendChild(option);
+    });
+    if (!select.options.length) {
+        select.innerHTML = '<option value="">-- No keys with a known public key --</option>';
+    }
+    document.getElementById('installKeyModal').style.display = 'block';
+};
+
+window.installKey = function() {
+    const keyID = document.getElementById('installKeyID').value;
+    if (!keyID) {
+        showErrorModal('Select a key');
+        return;
+    }
+    const btn = document.getElementById('installKeyBtn');
+    btn.disabled = true;
+    postAdminAction(`/hosts/install-key/${installKeyHostId}`, { key_id: keyID }).then(res => {
+        btn.disabled = false;
+        if (!res.success) {
+            showErrorModal(res.message);
+            return;
+        }
+        alert(`${res.message}.\n${res.data.authorized_keys}`);
+        location.reload();
+    }).catch(() => { btn.disabled = false; });
+};
+
+/* --- SSH_CONFIG IMPORT --- */
+window.openImportModal = function() {
+    document.getElementById('importConfig').value = '';
+    document.getElementById('importFile').value = '';
+    document.getElementById('importPreview').style.display = 'none';
+    document.getElementById('importModal').style.display = 'block';
+};
+
+window.readImportFile = function(input) {
+    if (!input.files.length) return;
+    input.files[0].text().then(text => { document.getElementById('importConfig').value = text; });
+};
+
+function renderImportWarnings(warnings) {
+    const list = document.getElementById('importWarnings');
+    list.innerHTML = '';
+    (warnings || []).forEach(w => {
+        const li = document.createElement('li');
+        li.textContent = w;
+        list.appendChild(li);
+    });
+}
+
+window.previewImport = function() {
+    postAdminAction('/hosts/import/preview', {
+        config: document.getElementById('importConfig').value
+    }).then(res => {
+        if (!res.success) {
+            showErrorModal(res.message);
+            return;
+        }
+        renderImportWarnings(res.data.warnings);
+
+        const body = document.getElementById('importBody');
+        body.innerHTML = '';
+        res.data.hosts.forEach(c => {
+            const tr = document.createElement('tr');
+            const check = document.createElement('td');
+            const cb = document.createElement('input');
+            cb.type = 'checkbox';
+            cb.className = 'import-host';
+            cb.value = c.alias;
+            cb.checked = c.status === 'new';
+            cb.disabled = c.status !== 'new';
+            check.appendChild(cb);
+            tr.appendChild(check);
+
+            const notes = [c.error, ...c.warnings].filter(n => n).join('; ');
+            [c.alias, `${c.address}:${c.port}`, c.username, c.key_name || '-', c.jump_host || '-', notes].forEach(text => {
+                const td = document.createElement('td');
+                td.textContent = text;
+                tr.appendChild(td);
+            });
+            body.appendChild(tr);
+        });
+        if (res.data.hosts.length === 0) {
+            body.innerHTML = '<tr><td colspan="7">No hosts found in the config</td></tr>';
+        }
+        document.getElementById('importPreview').style.display = 'block';
+    });
+};
+
+window.runImport = function() {
+    const aliases = Array.from(document.querySelectorAll('.import-host:checked')).map(cb => cb.value);
+    if (aliases.length === 0) {
+        showErrorModal('Select at least one host');
+        return;
+    }
+    postAdminAction('/hosts/import', {
+        config: document.getElementById('importConfig').value,
+        aliases: aliases,
+        folder: document.getElementById('importFolder').value
+    }).then(res => {
+        if (!res.success) {
+            showErrorModal(res.message);
+            return;
+        }
+        if (res.data.warnings && res.data.warnings.length) {
+            alert(`${res.message}:\n${res.data.warnings.join('\n')}`);
+        }
+        location.reload();
+    });
+};
+
+/* --- INVENTORY EXPORT AND IMPORT --- */
+let inventoryData = '';
+
+window.openInventoryModal = function(mode) {
+    const exporting = mode === 'export';
+    inventoryData = '';
+    document.getElementById('inventoryTitle').textContent = exporting ? 'Export Inventory' : 'Import Inventory';
+    document.getElementById('inventoryExport').style.display = exporting ? 'block' : 'none';
+    document.getElementById('inventoryExportActions').style.display = exporting ? 'block' : 'none';
+    document.getElementById('inventoryImport').style.display = exporting ? 'none' : 'block';
+    document.getElementById('inventoryImportActions').style.display = exporting ? 'none' : 'block';
+    document.getElementById('inventoryHint').textContent = exporting
+        ? 'Passwords and private keys are encrypted with this passphrase. Without one they are left out.'
+        : 'The passphrase the secrets were exported with.';
+    document.getElementById('inventoryPassphrase').value = '';
+    document.getElementById('inventoryFile').value = '';
+    document.getElementById('inventoryReport').style.display = 'none';
+    document.getElementById('inventoryDone').style.display = 'none';
+    document.getElementById('inventoryModal').style.display = 'block';
+};
+
+window.readInventoryFile = function(input) {
+    if (!input.files.length) return;
+    input.files[0].text().then(text => { inventoryData = text; });
+};
+
+window.exportInventory = function() {
+    const format = document.getElementById('inventoryFormat').value;
+    fetch('/inventory/export', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+            format: format,
+            type: document.getElementById('inventoryType').value,
+            passphrase: document.getElementById('inventoryPassphrase').value,
+            csrf_token: document.getElementById('csrf_token').value
+        })
+    }).then(async r => {
+        if ((r.headers.get('Content-Type') || '').startsWith('application/json') && !r.headers.get('Content-Disposition')) {
+            const res = await r.json();
+            showErrorModal(res.message);
+            return;
+        }
+        const name = (r.headers.get('Content-Disposition') || '').match(/filename="([^"]+)"/);
+        const url = URL.createObjectURL(await r.blob());
+        const a = document.createElement('a');
+        a.href = url;
+        a.download = name ? name[1] : `inventory.${format}`;
+        a.click();
+        URL.revokeObjectURL(url);
+        closeModal('inventoryModal');
+    });
+};
+
+window.importInventory = function(dryRun) {
+    if (!inventoryData) {
+        showErrorModal('Choose a file to import');
+        return;
+    }
+    postAdminAction('/inventory/import', {
+        data: inventoryData,
+        passphrase: document.getElementById('inventoryPassphrase').value,
+        dry_run: dryRun
+    }).then(res => {
+        if (!res.success) {
+            showErrorModal(res.message);
+            return;
+        }
+        document.getElementById('inventorySummary').textContent = res.message;
+        const body = document.getElementById('inventoryBody');
+        body.innerHTML = '';
+        res.data.items.forEach(item => {
+            const tr = document.createElement('tr');
+            let result = item.status;
+            if (item.conflicts && item.conflicts.length) result += ` (${item.conflicts.join(', ')})`;
+            [item.kind, item.name, result, (item.messages || []).join('; ')].forEach(text => {
+                const td = document.createElement('td');
+                td.textContent = text;
+                tr.appendChild(td);
+            });
+            body.appendChild(tr);
+        });
+        if (res.data.items.length === 0) {
+            body.innerHTML = '<tr><td colspan="4">Nothing to import</td></tr>';
+        }
+        document.getElementById('inventoryReport').style.display = 'block';
+        if (!dryRun) {
+            document.getElementById('inventoryImportActions').style.display = 'none';
+            document.getElementById('inventoryDone').style.display = 'block';
+        }
+    });
+};
+
 /* --- SOME EVENTS AND VALIDATIONS --- */
 document.addEventListener('input', (e) => {
     if (e.target.id === 'deleteHostName' || e.target.id === 'confirmName') {
@@ -234,9 +806,18 @@ document.addEventListener('submit', (e) => {
                 port: document.getElementById('port').value.toString(),
                 username: document.getElementById('username').value,
                 auth_type: authType,
+                jump_host_id: document.getElementById('jumpHostID').value.toString(),
+                group_id: document.getElementById('groupID').value.toString(),
+                folder: document.getElementById('folder').value,
+                tags: document.getElementById('tags').value.split(',').map(t => t.trim()).filter(t => t),
                 settings: {
-                    default_path: document.getElementById('defaultPath').value.trim() || "/"
+                    default_path: document.getElementById('defaultPath').value.trim() || "/",
+                    record_sessions: document.getElementById('recordSessions').checked,
+                    agent_forwarding: document.getElementById('agentForwarding').checked,
+                    agent_key_ids: Array.from(document.getElementById('agentKeyIDs').selectedOptions).map(o => parseInt(o.value))
                 },
+                totp_secret: document.getElementById('hostTOTPSecret').value.trim(),
+                clear_totp: document.getElementById('clearTOTP').checked,
                 csrf_token: csrfToken
             };
 
@@ -248,6 +829,9 @@ document.addEventListener('submit', (e) => {
                 }
                 payload.key_id = kVal.toString();
                 payload.password = ""; 
+            } else if (authType === 'interactive') {
+                payload.key_id = "0";
+                payload.password = "";
             } else {
                 const pVal = document.getElementById('hostPassword').value.trim();
                 
@@ -270,6 +854,9 @@ document.addEventListener('submit', (e) => {
             payload = {
                 name: kname,
                 key_data: kdata,
+                passphrase: document.getElementById('keyPassphrase').value,
+                passphrase_mode: document.getElementById('keyPassphraseMode').value,
+                group_id: document.getElementById('keyGroupID').value.toString(),
                 csrf_token: csrfToken
             };
         }
@@ -286,8 +873,29 @@ document.addEventListener('submit', (e) => {
     }
 });
 
+function renderHostKeys(id, hostKeys) {
+    const field = document.getElementById('hostKeysField');
+    const list = document.getElementById('hostKeysList');
+    list.innerHTML = '';
+    hostKeys.forEach(k => {
+        const li = document.createElement('li');
+        li.textContent = `${k.key_type} ${k.fingerprint} (since ${new Date(k.first_seen).toLocaleString()})`;
+        list.appendChild(li);
+    });
+    field.style.display = hostKeys.length > 0 ? 'block' : 'none';
+
+    document.getElementById('resetHostKeysBtn').onclick = () => {
+        fetch(`/hosts/host-keys/reset/${id}`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ csrf_token: document.getElementById('csrf_token').value })
+        }).then(r => r.json()).then(data => data.success ? renderHostKeys(id, []) : showErrorModal(data.message));
+    };
+}
+
 async function loadKeysForSelect() {
     const select = document.getElementById('keyID');
+    const agentSelect = document.getElementById('agentKeyIDs');
     if (!select) return;
 
     try {
@@ -296,19 +904,205 @@ async function loadKeysForSelect() {
  
         const keys = (res && res.data && Array.isArray(res.data)) ? res.data : [];
         select.innerHTML = '<option value="0">-- No selected Keys --</option>';
+        if (agentSelect) agentSelect.innerHTML = '';
 
         // If there are keys, we render them.
         keys.forEach(k => {
             const option = document.createElement('option');
             option.value = k.id;
-            option.textContent = k.name;
+            option.textContent = k.group_name ? `${k.name} (${k.group_name})` : k.name;
             select.appendChild(option);
+            if (agentSelect) agentSelect.appendChild(option.cloneNode(true));
         });
     } catch (err) {
         select.innerHTML = '<option value="0">-- Error loading keys --</option>';
     }
 }
 
+/* --- CONNECTION PROMPTS --- */
+/* --- PORT FORWARDING TUNNELS AND SOCKS PROXIES --- */
+let tunnelsHostId = null;
+let tunnelsTimer = null;
+
+window.openTunnelsModal = function(hostID, name) {
+    tunnelsHostId = hostID;
+    document.getElementById('tunnelsHostName').innerText = name;
+    document.getElementById('tunnelsModal').style.display = 'block';
+    loadTunnels();
+    // Live connection and traffic counters
+    clearInterval(tunnelsTimer);
+    tunnelsTimer = setInterval(loadTunnels, 2000);
+};
+
+window.closeTunnelsModal = function() {
+    clearInterval(tunnelsTimer);
+    tunnelsTimer = null;
+    document.getElementById('tunnelsModal').style.display = 'none';
+};
+
+async function loadTunnels() {
+    try {
+        const res = await fetch(`/tunnels?host_id=${tunnelsHostId}`).then(r => r.json());
+        if (!res.success) {
+            closeTunnelsModal();
+            showErrorModal(res.message);
+            return;
+        }
+        renderTunnels(res.data || []);
+
+        const proxies = await fetch('/proxies').then(r => r.json());
+        if (proxies.success) renderProxies((proxies.data || []).filter(p => p.host_id === tunnelsHostId));
+    } catch (err) {
+        console.error("Failed to load tunnels:", err);
+    }
+}
+
+function renderTunnels(tunnels) {
+    const body = document.getElementById('tunnelsBody');
+    const canWrite = !!document.getElementById('tunnelForm');
+    body.innerHTML = '';
+    if (tunnels.length === 0) {
+        body.innerHTML = '<tr><td colspan="5">No tunnels defined</td></tr>';
+        return;
+    }
+
+    tunnels.forEach(t => {
+        const tr = document.createElement('tr');
+        const cells = [
+            t.name,
+            `${t.direction === 'remote' ? '-R' : '-L'} ${t.bind_address}:${t.bind_port} → ${t.target_host}:${t.target_port}`,
+            t.running ? `${t.connections} open / ${t.total_connections} total` : 'stopped',
+            t.running ? `↑ ${formatSize(t.bytes_sent)} ↓ ${formatSize(t.bytes_received)}` : ''
+        ];
+        cells.forEach(text => {
+            const td = document.createElement('td');
+            td.textContent = text;
+            tr.appendChild(td);
+        });
+
+        const actions = document.createElement('td');
+        if (canWrite) {
+            const toggle = document.createElement('button');
+            toggle.textContent = t.running ? 'Stop' : 'Start';
+            toggle.onclick = () => tunnelAction(`/tunnels/${t.running ? 'stop' : 'start'}/${t.id}`);
+            const del = document.createElement('button');
+            del.textContent = 'Delete';
+            del.onclick = () => confirm(`Delete tunnel "${t.name}"?`) && tunnelAction(`/tunnels/delete/${t.id}`);
+            actions.append(toggle, del);
+        }
+        tr.appendChild(actions);
+        body.appendChild(tr);
+    });
+}
+
+function renderProxies(proxies) {
+    const body = document.getElementById('proxiesBody');
+    const canWrite = !!document.getElementById('proxyForm');
+    body.innerHTML = '';
+    if (proxies.length === 0) {
+        body.innerHTML = '<tr><td colspan="5">No running proxies</td></tr>';
+        return;
+    }
+
+    proxies.forEach(p => {
+        const tr = document.createElement('tr');
+        const cells = [
+            `${p.bind_address}:${p.bind_port}`,
+            p.username ? p.username : 'none',
+            `${p.connections} open / ${p.total_connections} total`,
+            `↑ ${formatSize(p.bytes_sent)} ↓ ${formatSize(p.bytes_received)}`
+        ];
+        cells.forEach(text => {
+            const td = document.createElement('td');
+            td.textContent = text;
+            tr.appendChild(td);
+        });
+
+        const actions = document.createElement('td');
+        if (canWrite) {
+            const stop = document.createElement('button');
+            stop.textContent = 'Stop';
+            stop.onclick = () => tunnelAction('/proxies/stop', { host_id: p.host_id, bind_port: p.bind_port });
+            actions.appendChild(stop);
+        }
+        tr.appendChild(actions);
+        body.appendChild(tr);
+    });
+}
+
+function tunnelAction(url, data = {}) {
+    return postAdminAction(url, data).then(res => {
+        if (!res.success) showErrorModal(res.message);
+        loadTunnels();
+        return res;
+    });
+}
+
+const proxyForm = document.getElementById('proxyForm');
+if (proxyForm) {
+    proxyForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        tunnelAction('/proxies/start', {
+            host_id: tunnelsHostId,
+            bind_address: document.getElementById('proxyBindAddress').value,
+            bind_port: parseInt(document.getElementById('proxyBindPort').value),
+            username: document.getElementById('proxyUsername').value,
+            password: document.getElementById('proxyPassword').value
+        }).then(res => res.success && proxyForm.reset());
+    });
+}
+
+const tunnelForm = document.getElementById('tunnelForm');
+if (tunnelForm) {
+    tunnelForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        tunnelAction('/tunnels/add', {
+            host_id: tunnelsHostId,
+            name: document.getElementById('tunnelName').value,
+            direction: document.getElementById('tunnelDirection').value,
+            bind_address: document.getElementById('tunnelBindAddress').value,
+            bind_port: parseInt(document.getElementById('tunnelBindPort').value),
+            target_host: document.getElementById('tunnelTargetHost').value,
+            target_port: parseInt(document.getElementById('tunnelTargetPort').value)
+        }).then(res => res.success && tunnelForm.reset());
+    });
+}
+
+const PROMPT_PREFIX = "[PROMPT]";
+const SESSION_PREFIX = "[SESSION]";
+
+// The server asks a question while connecting (e.g. an unknown host key).
+function handlePrompt(ws, raw) {
+    const prompt = JSON.parse(raw.substring(PROMPT_PREFIX.length));
+    const modal = document.getElementById('promptModal');
+    document.getElementById('promptTitle').innerText = prompt.title;
+    document.getElementById('promptMessage').innerText = prompt.message;
+
+    // Prompts asking for text show an input, the others are yes/no questions
+    const input = document.getElementById('promptInput');
+    const asksText = prompt.kind === 'passphrase' || prompt.kind === 'challenge';
+    input.type = prompt.echo ? 'text' : 'password';
+    input.value = '';
+    input.style.display = asksText ? 'block' : 'none';
+    document.getElementById('promptAcceptBtn').innerText = asksText ? 'OK' : 'Trust';
+
+    const answer = (reply) => {
+        modal.style.display = 'none';
+        input.value = '';
+        if (ws.readyState === WebSocket.OPEN) {
+            ws.send(JSON.stringify(Object.assign({ type: "prompt_reply" }, reply)));
+        }
+    };
+    document.getElementById('promptAcceptBtn').onclick = () => answer({ accept: true, value: input.value });
+    document.getElementById('promptRejectBtn').onclick = () => answer({ accept: false });
+    input.onkeydown = (e) => { if (e.key === 'Enter') answer({ accept: true, value: input.value }); };
+
+    maxZIndex++;
+    modal.style.zIndex = maxZIndex;
+    modal.style.display = 'block';
+    if (asksText) input.focus();
+}
+
 /* --- TERMINAL AND SSH --- */
 window.connectToHost = function(id, name, defaultPath = "/") {
     if (activeTerminals[id]) {
@@ -407,6 +1201,10 @@ window.connectToHost = function(id, name, defaultPath = "/") {
                     <button id="sel-btn-${id}" class="term-btn term-btn-action" onclick="toggleSelectMode(${id})">Sel Off</button>
                     <button class="term-btn term-btn-action" onclick="pasteToTerminal(${id})">Paste</button>
                 </div>
+                <div class="term-divider"></div>
+                <div class="term-toolbar-group">
+                    <button class="term-btn term-btn-action" onclick="openSnippetPicker(${id})">Snippets</button>
+                </div>
             </div>
         </div>`;
 
@@ -462,6 +1260,15 @@ window.connectToHost = function(id, name, defaultPath = "/") {
             setTimeout(() => window.closeTerminal(id), 800);
             return;
         }
+        if (e.data.startsWith(PROMPT_PREFIX)) {
+            handlePrompt(ws, e.data);
+            return;
+        }
+        if (e.data.startsWith(SESSION_PREFIX)) {
+            // Remember the shell so that a reconnect attaches to the same one.
+            if (activeTerminals[id]) activeTerminals[id].sessionId = e.data.substring(SESSION_PREFIX.length);
+            return;
+        }
         term.write(e.data);
     };
 
@@ -758,7 +1565,8 @@ function silentReconnect(id) {
 
     console.log(`Reconnecting to host ${id}...`);
     const protocol = window.location.protocol === 'https:' ? 'wss' : 'ws';
-    const ws = new WebSocket(`${protocol}://${window.location.host}/ws/ssh?id=${id}`);
+    const session = tData.sessionId ? `&session=${tData.sessionId}` : '';
+    const ws = new WebSocket(`${protocol}://${window.location.host}/ws/ssh?id=${id}${session}`);
 
     ws.onopen = () => {
         tData.ws = ws; // Replace the socket in object.
@@ -772,6 +1580,14 @@ function silentReconnect(id) {
             window.closeTerminal(id);
             return;
         }
+        if (e.data.startsWith(PROMPT_PREFIX)) {
+            handlePrompt(ws, e.data);
+            return;
+        }
+        if (e.data.startsWith(SESSION_PREFIX)) {
+            tData.sessionId = e.data.substring(SESSION_PREFIX.length);
+            return;
+        }
         tData.term.write(e.data);
     };
 
@@ -1078,3 +1894,494 @@ window.handleUpload = async function(hostID, input) {
     }
     input.value = '';
 };
+
+/* --- SESSION RECORDINGS --- */
+let player = null;
+
+function formatLocalTimes(root) {
+    root.querySelectorAll('.local-time').forEach(td => {
+        td.textContent = td.dataset.time ? new Date(td.dataset.time).toLocaleString() : '-';
+    });
+}
+
+// Renders the recordings, with their user when an admin reviews other users.
+function renderRecordings(recordings, adminView) {
+    const showUser = !!document.getElementById('recUserID');
+    recordingsBody.innerHTML = '';
+    if (recordings.length === 0) {
+        recordingsBody.innerHTML = `<tr><td colspan="${showUser ? 6 : 5}">No recordings found</td></tr>`;
+        return;
+    }
+
+    recordings.forEach(rec => {
+        const tr = document.createElement('tr');
+        const started = document.createElement('td');
+        started.className = 'local-time';
+        started.dataset.time = rec.started_at;
+        tr.appendChild(started);
+        if (showUser) {
+            const user = document.createElement('td');
+            user.textContent = rec.username || `deleted user #${rec.user_id}`;
+            tr.appendChild(user);
+        }
+        const host = document.createElement('td');
+        host.textContent = rec.host_name;
+        const ended = document.createElement('td');
+        ended.className = 'local-time';
+        ended.dataset.time = rec.ended_at || '';
+        const size = document.createElement('td');
+        size.textContent = rec.size;
+
+        const actions = document.createElement('td');
+        const play = document.createElement('button');
+        play.textContent = 'Play';
+        play.onclick = () => playRecording(rec.id, adminView);
+        actions.appendChild(play);
+
+        tr.append(host, ended, size, actions);
+        recordingsBody.appendChild(tr);
+    });
+}
+
+const recordingsBody = document.getElementById('recordingsBody');
+if (recordingsBody) {
+    formatLocalTimes(recordingsBody);
+
+    document.getElementById('recordingsFilter').addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const params = new URLSearchParams();
+        const hostID = document.getElementById('recHostID').value;
+        const from = document.getElementById('recFrom').value;
+        const to = document.getElementById('recTo').value;
+        if (hostID) params.set('host_id', hostID);
+        if (from) params.set('from', from);
+        if (to) params.set('to', to);
+
+        // Admins review other users through the admin list, "all" leaves the user out
+        const userSelect = document.getElementById('recUserID');
+        const adminView = !!(userSelect && userSelect.value);
+        if (adminView && userSelect.value !== 'all') params.set('user_id', userSelect.value);
+
+        const url = adminView ? '/admin/recordings/list' : '/recordings/list';
+        const res = await (await fetch(`${url}?${params}`)).json();
+        if (!res.success) {
+            showErrorModal(res.message);
+            return;
+        }
+
+        renderRecordings(res.data || [], adminView);
+        formatLocalTimes(recordingsBody);
+    });
+}
+
+window.closePlayer = function() {
+    if (player) {
+        clearTimeout(player.timer);
+        player.term.dispose();
+        player = null;
+    }
+    document.getElementById('playerModal').style.display = 'none';
+};
+
+// Replays an asciicast v2 recording in xterm.js.
+window.playRecording = async function(id, adminView) {
+    const r = await fetch(`${adminView ? '/admin' : ''}/recordings/cast/${id}`);
+    if (!r.ok) {
+        showErrorModal("Recording not found");
+        return;
+    }
+    const lines = (await r.text()).split('\n').filter(l => l.trim());
+    const header = JSON.parse(lines[0]);
+    const events = lines.slice(1).map(l => JSON.parse(l));
+
+    window.closePlayer();
+    document.getElementById('playerTitle').innerText = header.title || 'Replay';
+    document.getElementById('playerModal').style.display = 'block';
+
+    const term = new Terminal({
+        cols: header.width,
+        rows: header.height,
+        disableStdin: true,
+        fontSize: 14,
+        fontFamily: 'Consolas, "Courier New", monospace',
+        theme: { background: '#1e1e1e', foreground: '#ffffff' }
+    });
+    term.open(document.getElementById('player-term'));
+
+    player = { term: term, timer: null, position: 0, index: 0 };
+    let last = performance.now();
+
+    const tick = () => {
+        const now = performance.now();
+        const speed = parseFloat(document.getElementById('playerSpeed').value) || 1;
+        player.position += (now - last) / 1000 * speed;
+        last = now;
+
+        while (player.index < events.length && events[player.index][0] <= player.position) {
+            const [, type, data] = events[player.index];
+            if (type === 'o') {
+                term.write(data);
+            } else if (type === 'r') {
+                const [cols, rows] = data.split('x').map(Number);
+                if (cols && rows) term.resize(cols, rows);
+            }
+            player.index++;
+        }
+        if (player.index < events.length) {
+            player.timer = setTimeout(tick, 30);
+        }
+    };
+    tick();
+};
+
+/* --- BATCH COMMANDS --- */
+let jobEvents = null;
+
+const jobsBody = document.getElementById('jobsBody');
+if (jobsBody) {
+    formatLocalTimes(jobsBody);
+
+    const jobForm = document.getElementById('jobForm');
+    if (jobForm) {
+        jobForm.addEventListener('submit', (e) => {
+            e.preventDefault();
+            const hostIDs = Array.from(document.querySelectorAll('.job-host:checked')).map(cb => parseInt(cb.value));
+            postAdminAction('/jobs/run', {
+                host_ids: hostIDs,
+                tag: document.getElementById('jobTag').value,
+                command: document.getElementById('jobCommand').value,
+                parallelism: parseInt(document.getElementById('jobParallelism').value),
+                timeout_seconds: parseInt(document.getElementById('jobTimeout').value)
+            }).then(res => res.success ? openJob(res.data.id) : showErrorModal(res.message));
+        });
+    }
+}
+
+window.openJob = function(id) {
+    if (jobEvents) jobEvents.close();
+    document.getElementById('jobView').style.display = 'block';
+    document.getElementById('jobResults').innerHTML = '';
+
+    // Running jobs stream their results, finished ones arrive as a single "done" event
+    jobEvents = new EventSource(`/jobs/${id}/events`);
+    const renderJob = (e) => {
+        const job = JSON.parse(e.data);
+        document.getElementById('jobViewID').innerText = job.id;
+        document.getElementById('jobViewCommand').innerText = job.command;
+        document.getElementById('jobViewStatus').innerText = job.status;
+        (job.results || []).forEach(renderJobResult);
+    };
+    jobEvents.addEventListener('job', renderJob);
+    jobEvents.addEventListener('result', (e) => renderJobResult(JSON.parse(e.data)));
+    jobEvents.addEventListener('done', (e) => {
+        renderJob(e);
+        jobEvents.close();
+        jobEvents = null;
+    });
+    jobEvents.onerror = () => {
+        if (jobEvents) jobEvents.close();
+        jobEvents = null;
+    };
+};
+
+function renderJobResult(res) {
+    let box = document.getElementById(`job-result-${res.id}`);
+    if (!box) {
+        box = document.createElement('div');
+        box.id = `job-result-${res.id}`;
+        box.className = 'job-result';
+        box.innerHTML = '<strong class="job-host-name"></strong> <span class="job-status"></span>' +
+            '<pre class="job-stdout"></pre><pre class="job-stderr"></pre>';
+        document.getElementById('jobResults').appendChild(box);
+    }
+
+    let status = res.status;
+    if (res.exit_code !== null && res.exit_code !== undefined) status += ` (exit ${res.exit_code})`;
+    if (res.error) status += `: ${res.error}`;
+
+    box.querySelector('.job-host-name').textContent = res.host_name;
+    const statusEl = box.querySelector('.job-status');
+    statusEl.textContent = status;
+    statusEl.className = `job-status job-status-${res.status}`;
+
+    const stdout = box.querySelector('.job-stdout');
+    const stderr = box.querySelector('.job-stderr');
+    stdout.textContent = res.stdout;
+    stderr.textContent = res.stderr;
+    stdout.style.display = res.stdout ? 'block' : 'none';
+    stderr.style.display = res.stderr ? 'block' : 'none';
+}
+
+/* --- SNIPPETS --- */
+let snippetsByID = {};
+let snippetActionId = null;
+let snippetTerminalId = null;
+
+function loadSnippets() {
+    return fetch('/snippets/list').then(r => r.json()).then(res => {
+        snippetsByID = {};
+        (res.data || []).forEach(sn => { snippetsByID[sn.id] = sn; });
+        return res.data || [];
+    });
+}
+
+// renderSnippetVariables shows an input for every placeholder of the snippet
+window.renderSnippetVariables = function(containerId, snippetId) {
+    const container = document.getElementById(containerId);
+    container.innerHTML = '';
+    const snippet = snippetsByID[snippetId];
+    if (!snippet) return;
+
+    snippet.variables.forEach(name => {
+        const label = document.createElement('label');
+        label.textContent = `${name}:`;
+        const input = document.createElement('input');
+        input.type = 'text';
+        input.className = 'snippet-variable';
+        input.dataset.name = name;
+        container.appendChild(label);
+        container.appendChild(input);
+    });
+};
+
+function snippetVariables(containerId) {
+    const values = {};
+    document.querySelectorAll(`#${containerId} .snippet-variable`).forEach(input => {
+        values[input.dataset.name] = input.value;
+    });
+    return values;
+}
+
+window.openSnippetPicker = function(id) {
+    snippetTerminalId = id;
+    loadSnippets().then(snippets => {
+        const select = document.getElementById('snippetPickerSelect');
+        select.innerHTML = '';
+        snippets.forEach(sn => select.add(new Option(sn.name, sn.id)));
+        if (snippets.length === 0) {
+            showErrorModal('No snippets yet, add them on the Snippets page');
+            return;
+        }
+        showPickedSnippet();
+        document.getElementById('snippetPickerModal').style.display = 'block';
+    });
+};
+
+window.showPickedSnippet = function() {
+    const id = document.getElementById('snippetPickerSelect').value;
+    document.getElementById('snippetPickerCommand').textContent = snippetsByID[id] ? snippetsByID[id].command : '';
+    renderSnippetVariables('snippetPickerVariables', id);
+};
+
+// insertSnippet types the snippet into the terminal, the server fills in the variables
+window.insertSnippet = function(execute) {
+    const t = activeTerminals[snippetTerminalId];
+    if (!t || !t.ws || t.ws.readyState !== WebSocket.OPEN) {
+        showErrorModal('The terminal is not connected');
+        return;
+    }
+    t.ws.send(JSON.stringify({
+        type: 'snippet',
+        snippet_id: parseInt(document.getElementById('snippetPickerSelect').value),
+        variables: snippetVariables('snippetPickerVariables'),
+        execute: execute
+    }));
+    closeModal('snippetPickerModal');
+    t.term.focus();
+};
+
+const snippetsBody = document.getElementById('snippetsBody');
+if (snippetsBody) {
+    loadSnippets();
+
+    const snippetForm = document.getElementById('snippetForm');
+    if (snippetForm) {
+        snippetForm.addEventListener('submit', (e) => {
+            e.preventDefault();
+            const url = snippetActionId ? `/snippets/edit/${snippetActionId}` : '/snippets/add';
+            postAdminAction(url, {
+                name: document.getElementById('snippetName').value,
+                command: document.getElementById('snippetCommand').value,
+                description: document.getElementById('snippetDescription').value,
+                group_id: document.getElementById('snippetGroupID').value.toString()
+            }).then(res => res.success ? location.reload() : showErrorModal(res.message));
+        });
+
+        document.getElementById('runSnippetForm').addEventListener('submit', (e) => {
+            e.preventDefault();
+            const status = document.getElementById('runSnippetStatus');
+            document.getElementById('runSnippetResult').style.display = 'block';
+            status.className = 'job-status job-status-running';
+            status.textContent = 'running';
+            document.getElementById('runSnippetStdout').textContent = '';
+            document.getElementById('runSnippetStderr').textContent = '';
+
+            postAdminAction(`/snippets/run/${snippetActionId}`, {
+                host_id: parseInt(document.getElementById('runSnippetHost').value),
+                variables: snippetVariables('runSnippetVariables'),
+                timeout_seconds: parseInt(document.getElementById('runSnippetTimeout').value)
+            }).then(res => {
+                const out = res.data || {};
+                let text = res.success ? (out.exit_code === 0 ? 'success' : 'failed') : 'error';
+                status.className = `job-status job-status-${text}`;
+                if (out.exit_code !== undefined) text += ` (exit ${out.exit_code})`;
+                if (!res.success) text += `: ${res.message}`;
+                status.textContent = text;
+                document.getElementById('runSnippetStdout').textContent = out.stdout || '';
+                document.getElementById('runSnippetStderr').textContent = out.stderr || '';
+            });
+        });
+    }
+}
+
+window.openSnippetModal = function(id) {
+    snippetActionId = id || null;
+    const snippet = snippetsByID[id] || {};
+    document.getElementById('snippetModalTitle').innerText = id ? 'Edit Snippet' : 'Add Snippet';
+    document.getElementById('snippetName').value = snippet.name || '';
+    document.getElementById('snippetCommand').value = snippet.command || '';
+    document.getElementById('snippetDescription').value = snippet.description || '';
+    document.getElementById('snippetGroupID').value = snippet.group_id || 0;
+    document.getElementById('snippetModal').style.display = 'block';
+};
+
+window.openRunSnippetModal = function(id) {
+    snippetActionId = id;
+    document.getElementById('runSnippetName').innerText = snippetsByID[id] ? snippetsByID[id].name : '';
+    document.getElementById('runSnippetResult').style.display = 'none';
+    renderSnippetVariables('runSnippetVariables', id);
+    document.getElementById('runSnippetModal').style.display = 'block';
+};
+
+window.deleteSnippet = function(id, name) {
+    if (!confirm(`Delete snippet "${name}"?`)) return;
+    postAdminAction(`/snippets/delete/${id}`, {})
+        .then(res => res.success ? location.reload() : showErrorModal(res.message));
+};
+
+/* --- USER ADMINISTRATION --- */
+let userActionId = null;
+
+function postAdminAction(url, data) {
+    data.csrf_token = document.getElementById('csrf_token').value;
+    return fetch(url, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(data)
+    }).then(r => r.json());
+}
+
+const usersBody = document.getElementById('usersBody');
+if (usersBody) {
+    formatLocalTimes(usersBody);
+    formatLocalTimes(document.getElementById('failedLogins'));
+
+    document.getElementById('userForm').addEventListener('submit', (e) => {
+        e.preventDefault();
+        postAdminAction('/admin/users/add', {
+            username: document.getElementById('newUsername').value,
+            password: document.getElementById('newUserPassword').value,
+            role: document.getElementById('newUserRole').value
+        }).then(res => res.success ? location.reload() : showErrorModal(res.message));
+    });
+
+    document.getElementById('resetPasswordForm').addEventListener('submit', (e) => {
+        e.preventDefault();
+        postAdminAction(`/admin/users/reset-password/${userActionId}`, {
+            new_password: document.getElementById('resetPassword').value
+        }).then(res => {
+            if (!res.success) {
+                showErrorModal(res.message);
+                return;
+            }
+            closeModal('resetPasswordModal');
+        });
+    });
+
+    document.getElementById('confirmUsername').addEventListener('input', (e) => {
+        document.getElementById('confirmUserDeleteBtn').disabled =
+            e.target.value !== document.getElementById('deleteUsername').innerText;
+    });
+}
+
+window.openUserModal = function() {
+    document.getElementById('userForm').reset();
+    document.getElementById('userModal').style.display = 'block';
+};
+
+window.saveUser = function(id) {
+    const row = usersBody.querySelector(`tr[data-user-id="${id}"]`);
+    postAdminAction(`/admin/users/edit/${id}`, {
+        role: row.querySelector('.user-role').value,
+        disabled: row.querySelector('.user-disabled').checked
+    }).then(res => res.success ? location.reload() : showErrorModal(res.message));
+};
+
+window.openResetPasswordModal = function(id, username) {
+    userActionId = id;
+    document.getElementById('resetUsername').innerText = username;
+    document.getElementById('resetPassword').value = '';
+    document.getElementById('resetPasswordModal').style.display = 'block';
+};
+
+window.setRequire2FA = function(checkbox) {
+    postAdminAction('/admin/users/require-2fa', { required: checkbox.checked }).then(res => {
+        if (!res.success) {
+            checkbox.checked = !checkbox.checked;
+            showErrorModal(res.message);
+        }
+    });
+};
+
+window.resetUserTwoFactor = function(id, username) {
+    if (!confirm(`Turn off two-factor authentication for "${username}"? Their authenticator app, recovery codes and passkeys stop working.`)) return;
+    postAdminAction(`/admin/users/reset-2fa/${id}`, {})
+        .then(res => res.success ? location.reload() : showErrorModal(res.message));
+};
+
+window.unlockLogin = function(kind, subject) {
+    postAdminAction('/admin/users/unlock', { kind: kind, subject: subject })
+        .then(res => res.success ? location.reload() : showErrorModal(res.message));
+};
+
+window.openUserDeleteModal = function(id, username) {
+    userActionId = id;
+    document.getElementById('deleteUsername').innerText = username;
+    document.getElementById('confirmUsername').value = '';
+    document.getElementById('confirmUserDeleteBtn').disabled = true;
+    document.getElementById('userDeleteModal').style.display = 'block';
+};
+
+window.confirmUserDelete = function() {
+    postAdminAction(`/admin/users/delete/${userActionId}`, {})
+        .then(res => res.success ? location.reload() : showErrorModal(res.message));
+};
+
+/* --- GROUPS --- */
+const groupForm = document.getElementById('groupForm');
+if (groupForm) {
+    groupForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        postAdminAction('/admin/groups/add', {
+            name: document.getElementById('newGroupName').value
+        }).then(res => res.success ? location.reload() : showErrorModal(res.message));
+    });
+}
+
+window.addGroupMember = function(groupID) {
+    const row = document.querySelector(`tr[data-group-id="${groupID}"]`);
+    postAdminAction(`/admin/groups/${groupID}/members/add`, {
+        user_id: row.querySelector('.group-new-member').value
+    }).then(res => res.success ? location.reload() : showErrorModal(res.message));
+};
+
+window.removeGroupMember = function(groupID, userID) {
+    postAdminAction(`/admin/groups/${groupID}/members/remove`, { user_id: userID.toString() })
+        .then(res => res.success ? location.reload() : showErrorModal(res.message));
+};
+
+window.deleteGroup = function(groupID, name) {
+    if (!confirm(`Delete group "${name}"?`)) return;
+    postAdminAction(`/admin/groups/delete/${groupID}`, {})
+        .then(res => res.success ? location.reload() : showErrorModal(res.message));
+};